@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"wine-shop-api/pkg/config"
+)
+
+// runCommand runs a subcommand and returns the process exit code
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		return printConfig()
+	default:
+		fmt.Fprintln(os.Stderr, "usage: server [config print]")
+		return 2
+	}
+}
+
+// printConfig writes the effective configuration with secrets redacted,
+// then reports any validation errors
+func printConfig() int {
+	cfg, err := config.Read()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out, err := cfg.Redacted()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	os.Stdout.Write(out)
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\ninvalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/internal/handler"
+	"wine-shop-api/internal/metrics"
 	"wine-shop-api/internal/middleware"
 	"wine-shop-api/internal/service"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/problem"
+	"wine-shop-api/pkg/tracing"
 	"wine-shop-api/pkg/utils"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
 	_ "wine-shop-api/docs"
 )
@@ -41,81 +51,387 @@ import (
 // @name Authorization
 
 func main() {
-	// Load .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	// Subcommands, e.g. "config print"
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
 	}
 
-	// Connect to Database
-	config.ConnectDatabase()
+	// Load configuration from defaults, CONFIG_FILE, .env and the environment
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal("Invalid configuration:\n", err)
+	}
+	utils.ConfigureTokens(cfg.Auth.APISecret, cfg.Auth.TokenLifespan())
+
+	// Structured JSON logging with redaction; the standard log package is
+	// routed through it too
+	logger, err := logging.New(os.Stdout, cfg.Log)
+	if err != nil {
+		log.Fatal("Invalid log configuration: ", err)
+	}
+	slog.SetDefault(logger)
+
+	// OpenTelemetry tracing with W3C trace-context propagation
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("Failed to set up tracing: ", err)
+	}
+	tracingEnabled := cfg.Tracing.Exporter != "none"
+
+	// SIGINT/SIGTERM cancel ctx: startup retries stop and the server drains
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Auto Migrate
-	err := config.DB.AutoMigrate(
+	// Connect to Database, retrying with backoff while it comes up
+	if err := config.ConnectDatabase(ctx, cfg.Database, logging.NewGormLogger(cfg.Log)); err != nil {
+		log.Fatal(err)
+	}
+	defer config.CloseDatabase()
+
+	// Auto Migrate; readiness reports any of these tables or columns missing
+	models := []any{
 		&domain.User{},
 		&domain.Product{},
 		&domain.Cart{},
 		&domain.CartItem{},
+		&domain.Address{},
+		&domain.ShippingZone{},
+		&domain.ShippingMethod{},
+		&domain.ComplianceRuleSet{},
 		&domain.Order{},
 		&domain.OrderItem{},
+		&domain.Payment{},
+		&domain.Refund{},
+		&domain.ReturnRequest{},
+		&domain.ReturnItem{},
+		&domain.ReturnPhoto{},
 		&domain.Review{},
-	)
-	if err != nil {
+		&domain.AgeAttestation{},
+		&domain.LoginEvent{},
+		&domain.MFARecoveryCode{},
+		&domain.UserIdentity{},
+		&domain.APIKey{},
+		&domain.AuditLog{},
+	}
+	if err := config.DB.AutoMigrate(models...); err != nil {
 		log.Fatal("Failed to migrate database: ", err)
 	}
 
+	// Audit log is append-only at the database level
+	auditService := &service.AuditService{}
+	if err := auditService.EnsureImmutable(ctx); err != nil {
+		log.Fatal("Failed to protect audit log: ", err)
+	}
+
+	// A span per GORM query, under the request's span
+	if tracingEnabled {
+		if err := config.DB.Use(tracing.GormPlugin{}); err != nil {
+			log.Fatal("Failed to register tracing plugin: ", err)
+		}
+	}
+
+	// Query timings and connection pool statistics for /metrics
+	if cfg.Metrics.Enabled {
+		if err := metrics.RegisterDatabase(config.DB); err != nil {
+			log.Fatal("Failed to register database metrics: ", err)
+		}
+	}
+
 	// Initialize Gin engine
-	r := gin.Default()
-
-	// CORS Middleware
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000", "https://*.vercel.app"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			// Allow any Vercel preview or production domain
-			return true
-		},
+	r := gin.New()
+	r.Use(middleware.RecoveryMiddleware())
+	r.NoRoute(func(c *gin.Context) {
+		problem.Error(c, http.StatusNotFound, problem.CodeNotFound, "Route not found")
+	})
+
+	// Health probes are registered before the middleware below, so access
+	// logs, CORS and rate limiting never apply to load balancer checks
+	healthService := service.NewHealthService(
+		service.DatabaseHealthCheck(config.DB),
+		service.MigrationsHealthCheck(config.DB, models),
+	)
+	healthHandler := &handler.HealthHandler{Service: healthService}
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+
+	// Prometheus metrics: on their own listener, or on the API behind a token
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Addr != "" {
+			metricsRouter := gin.New()
+			metricsRouter.Use(middleware.RecoveryMiddleware())
+			metricsRouter.GET("/metrics", middleware.MetricsHandler(cfg.Metrics.Token))
+			metricsServer = &http.Server{
+				Addr:              cfg.Metrics.Addr,
+				Handler:           metricsRouter,
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+			}
+		} else {
+			r.GET("/metrics", middleware.MetricsHandler(cfg.Metrics.Token))
+		}
+	}
+
+	// A server span per request, continuing any inbound traceparent
+	if tracingEnabled {
+		r.Use(otelgin.Middleware(cfg.Tracing.ServiceName))
+	}
+
+	// Request IDs and request-scoped loggers, then one access log per request
+	r.Use(middleware.RequestIDMiddleware(logger))
+	r.Use(middleware.RequestLoggerMiddleware())
+	if cfg.Metrics.Enabled {
+		r.Use(middleware.MetricsMiddleware())
+	}
+
+	// CORS Middleware: only allowlisted origins may send credentialed requests
+	allowedOrigins, err := middleware.NewOriginAllowlist(cfg.CORS.AllowedOrigins)
+	if err != nil {
+		log.Fatal("Invalid CORS_ALLOWED_ORIGINS: ", err)
+	}
+	r.Use(middleware.CORSMiddleware(allowedOrigins))
+
+	// Security headers, with a relaxed CSP for the Swagger UI
+	r.Use(middleware.SecurityHeadersMiddleware(middleware.DefaultSecurityHeaders(), map[string]middleware.SecurityHeaders{
+		"/swagger/": middleware.SwaggerSecurityHeaders(),
 	}))
 
-	// Global Middleware
-	r.Use(gin.Recovery())
+	// Only trust X-Forwarded-For from these proxies, so client IPs used for
+	// rate limiting and the allowlist cannot be spoofed
+	if len(cfg.Server.TrustedProxies) > 0 {
+		if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+			log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+		}
+	}
+
+	// Rate limit store: "memory" (per replica) or "postgres" (shared across replicas)
+	var rateLimitStore middleware.RateLimitStore
+	switch cfg.RateLimit.Store {
+	case "memory":
+		rateLimitStore = middleware.NewMemoryStore()
+	case "postgres":
+		rateLimitStore, err = middleware.NewPostgresStore(config.DB)
+		if err != nil {
+			log.Fatal("Failed to initialize rate limit store: ", err)
+		}
+	}
+
+	// API keys for integration clients, accepted alongside JWTs
+	apiKeyService := &service.APIKeyService{}
+
+	// Rate limit policies: route patterns and roles mapped to limits, reloaded on SIGHUP
+	rateLimiter, err := middleware.NewPolicyRateLimiter(cfg.RateLimit.PolicyFile, rateLimitStore)
+	if err != nil {
+		log.Fatal("Failed to load rate limit policies: ", err)
+	}
+	rateLimiter.APIKeys = apiKeyService
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	defer signal.Stop(reload)
+	go func() {
+		for range reload {
+			if err := rateLimiter.Reload(); err != nil {
+				slog.Error("failed to reload rate limit policies, keeping current ones", "error", err)
+				continue
+			}
+			slog.Info("rate limit policies reloaded")
+		}
+	}()
+	r.Use(middleware.RateLimitPolicyMiddleware(rateLimiter))
+
+	// Idempotency keys let clients safely retry mutations such as checkout
+	idempotencyStore, err := middleware.NewPostgresIdempotencyStore(config.DB, cfg.Idempotency.TTL, cfg.Idempotency.LockTimeout)
+	if err != nil {
+		log.Fatal("Failed to initialize idempotency store: ", err)
+	}
+
+	// Minimum drinking age per shipping country
+	agePolicy, err := service.NewAgePolicy(cfg.Age.MinimumAge, cfg.Age.ByCountry)
+	if err != nil {
+		log.Fatal("Invalid drinking age configuration: ", err)
+	}
+
+	// Two-factor policy: force MFA for every admin account
+	mfaRequiredForAdmins := cfg.Auth.MFARequiredForAdmins
 
-	// Rate Limiter: 100 requests per minute for general routes
-	generalLimiter := middleware.NewRateLimiter(100, time.Minute)
-	// Rate Limiter: 10 requests per minute for auth routes (prevent brute force)
-	authLimiter := middleware.NewRateLimiter(10, time.Minute)
+	// Session mode: bearer tokens (default) or HttpOnly cookies with CSRF tokens
+	sessions := &utils.SessionCookieConfig{
+		Enabled:  cfg.Session.Mode == "cookie",
+		Secure:   cfg.Session.CookieSecure,
+		SameSite: cfg.Session.SameSite(),
+		Domain:   cfg.Session.CookieDomain,
+	}
 
 	// Initialize Handlers
+	userService := &service.UserService{
+		AgePolicy:            agePolicy,
+		Notifier:             &service.LogNotifier{},
+		MFARequiredForAdmins: mfaRequiredForAdmins,
+	}
 	authHandler := &handler.AuthHandler{
-		Service: &service.UserService{},
+		Service:  userService,
+		Sessions: sessions,
+	}
+	mfaHandler := &handler.MFAHandler{
+		Service: &service.MFAService{
+			Users:  userService,
+			Issuer: cfg.Auth.MFAIssuer,
+		},
+		Sessions: sessions,
+	}
+	// Anonymous catalogue reads are served from memory until a product or
+	// its stock changes
+	var responseCache *middleware.ResponseCache
+	var catalogueCache service.CatalogueCache
+	if cfg.Cache.Entries > 0 {
+		responseCache = middleware.NewResponseCache(cfg.Cache.Entries, cfg.Cache.TTL)
+		catalogueCache = responseCache
 	}
+	productService := &service.ProductService{Cache: catalogueCache}
 	productHandler := &handler.ProductHandler{
-		Service: &service.ProductService{},
+		Service: productService,
+		Audit:   auditService,
+	}
+	oidcProviders, err := service.NewOIDCProviders(cfg.OIDC.Providers)
+	if err != nil {
+		log.Fatal("Invalid OIDC provider configuration: ", err)
+	}
+	oauthHandler := &handler.OAuthHandler{
+		Service: &service.OAuthService{
+			Users:     userService,
+			Providers: oidcProviders,
+		},
+		FrontendRedirectURL: cfg.OIDC.FrontendRedirectURL,
+		Sessions:            sessions,
 	}
 	cartService := &service.CartService{}
 	cartHandler := &handler.CartHandler{
 		Service: cartService,
 	}
+	// Payments go through the mock provider, which signs its own webhooks.
+	// It only runs with PAYMENT_MOCK_ENABLED set; otherwise the shop stays
+	// up with checkout answering 503.
+	paymentService := &service.PaymentService{
+		Currency: cfg.Payment.Currency,
+		Cache:    catalogueCache,
+	}
+	var mockPayments *service.MockPaymentProvider
+	if cfg.Payment.MockEnabled {
+		webhookSecret := []byte(cfg.Payment.WebhookSecret)
+		if len(webhookSecret) == 0 {
+			webhookSecret = make([]byte, 32)
+			if _, err := rand.Read(webhookSecret); err != nil {
+				log.Fatal("Failed to generate payment webhook secret: ", err)
+			}
+		}
+		mockPayments = service.NewMockPaymentProvider(cfg.Payment.MockScenario, webhookSecret, cfg.Payment.MockAPIURL)
+		paymentService.Provider = mockPayments
+		// Payments abandoned without an outcome release their order's stock
+		go paymentService.RunExpiry(ctx, cfg.Payment.PendingTimeout)
+	} else {
+		slog.Warn("payments are disabled, checkout returns 503; set PAYMENT_MOCK_ENABLED=true to simulate them in development")
+	}
+	paymentHandler := &handler.PaymentHandler{
+		Service: paymentService,
+		Mock:    mockPayments,
+	}
+	addressService := &service.AddressService{}
+	addressHandler := &handler.AddressHandler{
+		Service: addressService,
+	}
+	shippingService := &service.ShippingService{}
+	// Checkout needs a zone covering the destination; seed one on first start
+	if created, err := shippingService.EnsureDefaultZone(ctx, cfg.Shipping.DefaultCountries); err != nil {
+		log.Fatal("Failed to seed the default shipping zone: ", err)
+	} else if created {
+		slog.Info("created a default shipping zone with free standard shipping", "countries", cfg.Shipping.DefaultCountries)
+	}
+	shippingHandler := &handler.ShippingHandler{
+		Service:   shippingService,
+		Cart:      cartService,
+		Addresses: addressService,
+		Audit:     auditService,
+	}
+	complianceService := &service.ComplianceService{}
+	complianceHandler := &handler.ComplianceHandler{
+		Service: complianceService,
+		Audit:   auditService,
+	}
 	orderHandler := &handler.OrderHandler{
 		Service: &service.OrderService{
 			CartService: cartService,
+			AgePolicy:   agePolicy,
+			Payments:    paymentService,
+			Addresses:   addressService,
+			Shipping:    shippingService,
+			Compliance:  complianceService,
+			Cache:       catalogueCache,
 		},
 	}
+	// Returns are refunded through the order's payment
+	returnHandler := &handler.ReturnHandler{
+		Service: &service.ReturnService{Payments: paymentService, Cache: catalogueCache},
+		Audit:   auditService,
+	}
 	reviewHandler := &handler.ReviewHandler{
 		Service: &service.ReviewService{},
 	}
 
 	// Initialize Cloudinary Service (optional - if env vars not set, skip)
 	var uploadHandler *handler.UploadHandler
-	cloudinaryService, err := service.NewCloudinaryService()
+	cloudinaryService, err := service.NewCloudinaryService(cfg.Cloudinary)
 	if err == nil {
 		uploadHandler = &handler.UploadHandler{
 			CloudinaryService: cloudinaryService,
+			Audit:             auditService,
 		}
-		log.Println("Cloudinary service initialized")
+		returnHandler.Media = cloudinaryService
+		healthService.AddCheck(service.HealthCheck{
+			Name:     "media_storage",
+			Optional: true,
+			Check:    cloudinaryService.Ping,
+		})
 	} else {
-		log.Println("Cloudinary not configured - image upload disabled")
+		slog.Info("cloudinary not configured, image upload disabled", "error", err)
+	}
+
+	apiKeyHandler := &handler.APIKeyHandler{
+		Service: apiKeyService,
+		Audit:   auditService,
+	}
+	authenticator := &middleware.Authenticator{
+		APIKeys:    apiKeyService,
+		RateLimits: rateLimitStore,
+		// Routes that accept short-lived signed download links in ?token=
+		SignedURLRoutes: map[string]bool{
+			"GET /api/admin/audit/export": true,
+		},
+		// Routes reachable with an API key and the scope each requires
+		Scopes: map[string]string{
+			"GET /api/me":                                "profile:read",
+			"GET /api/me/addresses":                      "profile:read",
+			"GET /api/cart":                              "cart:read",
+			"POST /api/cart":                             "cart:write",
+			"GET /api/cart/shipping-options":             "cart:read",
+			"GET /api/orders":                            "orders:read",
+			"POST /api/orders":                           "orders:write",
+			"GET /api/returns":                           "orders:read",
+			"POST /api/orders/:id/returns":               "orders:write",
+			"POST /api/products/:id/reviews":             "reviews:write",
+			"POST /api/admin/products":                   "products:write",
+			"PUT /api/admin/products/:id":                "products:write",
+			"PATCH /api/admin/products/:id":              "products:write",
+			"DELETE /api/admin/products/:id":             "products:write",
+			"POST /api/admin/upload":                     "uploads:write",
+			"GET /api/admin/analytics/stats":             "analytics:read",
+			"GET /api/admin/analytics/sales-by-category": "analytics:read",
+			"GET /api/admin/analytics/top-products":      "analytics:read",
+			"GET /api/admin/analytics/sales-by-day":      "analytics:read",
+			"GET /api/admin/analytics/recent-orders":     "analytics:read",
+		},
+	}
+
+	auditHandler := &handler.AuditHandler{
+		Service: auditService,
 	}
 
 	// Initialize Analytics Handler
@@ -126,40 +442,56 @@ func main() {
 	// Swagger Route
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Catalogue reads may be reused by browsers and CDNs; everything else is
+	// per user or changes on every request
+	noStore := middleware.CacheControl("no-store")
+	catalogue := middleware.CacheControl("public, max-age=" + strconv.Itoa(int(cfg.Cache.MaxAge.Seconds())))
+
 	// Public Routes
 	public := r.Group("/api")
-	public.Use(middleware.RateLimitMiddleware(generalLimiter))
+	public.Use(noStore)
 	{
-		// Auth Routes with stricter rate limit
-		public.POST("/register", middleware.RateLimitMiddleware(authLimiter), authHandler.Register)
-		public.POST("/login", middleware.RateLimitMiddleware(authLimiter), authHandler.Login)
-		public.GET("/health", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"status":  "ok",
-				"message": "Wine Shop API is running",
-			})
-		})
+		// Auth Routes
+		public.POST("/register", authHandler.Register)
+		public.POST("/login", authHandler.Login)
+		public.POST("/login/mfa", mfaHandler.VerifyLogin)
+		public.POST("/logout", middleware.CSRFMiddleware(), authHandler.Logout)
+
+		// Social Login Routes (OpenID Connect)
+		public.GET("/auth/oidc/providers", oauthHandler.ListProviders)
+		public.GET("/auth/oidc/:provider/login", oauthHandler.StartLogin)
+		public.GET("/auth/oidc/:provider/callback", oauthHandler.Callback)
+		public.POST("/auth/oidc/:provider/callback", oauthHandler.Callback)
+		public.GET("/health", healthHandler.Readyz)
 
 		// Product Routes (Public)
-		public.GET("/products", productHandler.GetAllProducts)
-		public.GET("/products/:id", productHandler.GetProduct)
+		public.GET("/products", catalogue, responseCache.Middleware(), productHandler.GetAllProducts)
+		public.GET("/products/:id", catalogue, responseCache.Middleware(), productHandler.GetProduct)
 
 		// Review Routes (Public - Read)
 		public.GET("/products/:id/reviews", reviewHandler.GetProductReviews)
+
+		// Payment Routes (signed by the payment provider)
+		public.POST("/payments/webhook", paymentHandler.Webhook)
 	}
 
 	// Protected Routes (Admin) - Requires admin role
 	protectedAdmin := r.Group("/api/admin")
-	protectedAdmin.Use(middleware.AdminMiddleware())
+	protectedAdmin.Use(noStore, middleware.AdminMiddleware(authenticator))
+	if mfaRequiredForAdmins {
+		protectedAdmin.Use(middleware.RequireAdminMFAMiddleware())
+	}
+	protectedAdmin.Use(middleware.IdempotencyMiddleware(idempotencyStore, int64(cfg.Idempotency.MaxBodyBytes)))
 	{
 		protectedAdmin.GET("/profile", func(c *gin.Context) {
-			userID, _ := utils.ExtractTokenID(c)
+			userID := c.GetUint("user_id")
 			c.JSON(http.StatusOK, gin.H{"message": "Admin access granted", "user_id": userID})
 		})
 
 		// Product Routes (Admin)
 		protectedAdmin.POST("/products", productHandler.CreateProduct)
 		protectedAdmin.PUT("/products/:id", productHandler.UpdateProduct)
+		protectedAdmin.PATCH("/products/:id", productHandler.PatchProduct)
 		protectedAdmin.DELETE("/products/:id", productHandler.DeleteProduct)
 
 		// Image Upload Route (Admin)
@@ -167,28 +499,90 @@ func main() {
 			protectedAdmin.POST("/upload", uploadHandler.UploadImage)
 		}
 
+		// Shipping Routes (Admin)
+		protectedAdmin.GET("/shipping/zones", shippingHandler.GetShippingZones)
+		protectedAdmin.POST("/shipping/zones", shippingHandler.CreateShippingZone)
+		protectedAdmin.PUT("/shipping/zones/:id", shippingHandler.UpdateShippingZone)
+		protectedAdmin.DELETE("/shipping/zones/:id", shippingHandler.DeleteShippingZone)
+		protectedAdmin.POST("/shipping/zones/:id/methods", shippingHandler.CreateShippingMethod)
+		protectedAdmin.PUT("/shipping/methods/:id", shippingHandler.UpdateShippingMethod)
+		protectedAdmin.DELETE("/shipping/methods/:id", shippingHandler.DeleteShippingMethod)
+
+		// Compliance Routes (Admin)
+		protectedAdmin.GET("/compliance/rules", complianceHandler.GetComplianceRules)
+		protectedAdmin.PUT("/compliance/rules", complianceHandler.PublishComplianceRules)
+		protectedAdmin.GET("/compliance/rules/versions", complianceHandler.GetComplianceRuleVersions)
+		protectedAdmin.GET("/compliance/rules/versions/:version", complianceHandler.GetComplianceRuleVersion)
+
+		// Return Routes (Admin)
+		protectedAdmin.GET("/returns", returnHandler.GetReturns)
+		protectedAdmin.POST("/returns/:id/approve", returnHandler.ApproveReturn)
+		protectedAdmin.POST("/returns/:id/reject", returnHandler.RejectReturn)
+		protectedAdmin.POST("/returns/:id/receive", returnHandler.ReceiveReturn)
+		protectedAdmin.POST("/returns/:id/refunds", returnHandler.RefundReturn)
+
 		// Analytics Routes (Admin)
 		protectedAdmin.GET("/analytics/stats", analyticsHandler.GetDashboardStats)
 		protectedAdmin.GET("/analytics/sales-by-category", analyticsHandler.GetSalesByCategory)
 		protectedAdmin.GET("/analytics/top-products", analyticsHandler.GetTopProducts)
 		protectedAdmin.GET("/analytics/sales-by-day", analyticsHandler.GetSalesByDay)
 		protectedAdmin.GET("/analytics/recent-orders", analyticsHandler.GetRecentOrders)
+
+		// API Key Routes (Admin)
+		protectedAdmin.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+		protectedAdmin.GET("/api-keys", apiKeyHandler.GetAPIKeys)
+		protectedAdmin.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+
+		// Audit Log Routes (Admin)
+		protectedAdmin.GET("/audit", auditHandler.GetAuditLogs)
+		protectedAdmin.GET("/audit/verify", auditHandler.VerifyAuditLog)
+		protectedAdmin.GET("/audit/export-link", auditHandler.GetAuditExportLink)
+		protectedAdmin.GET("/audit/export", auditHandler.ExportAuditLogs)
 	}
 
 	// Protected Routes (User)
 	protectedUser := r.Group("/api")
-	protectedUser.Use(middleware.JwtAuthMiddleware())
+	protectedUser.Use(noStore, middleware.JwtAuthMiddleware(authenticator))
+	protectedUser.Use(middleware.IdempotencyMiddleware(idempotencyStore, int64(cfg.Idempotency.MaxBodyBytes)))
 	{
 		// User Info Route
 		protectedUser.GET("/me", authHandler.GetMe)
+		protectedUser.POST("/me/age-verification", authHandler.VerifyAge)
+		protectedUser.GET("/me/logins", authHandler.GetLoginHistory)
+		protectedUser.GET("/me/identities", oauthHandler.GetIdentities)
+
+		// Address Book Routes
+		protectedUser.GET("/me/addresses", addressHandler.GetAddresses)
+		protectedUser.POST("/me/addresses", addressHandler.CreateAddress)
+		protectedUser.GET("/me/addresses/:id", addressHandler.GetAddress)
+		protectedUser.PUT("/me/addresses/:id", addressHandler.UpdateAddress)
+		protectedUser.DELETE("/me/addresses/:id", addressHandler.DeleteAddress)
+
+		// Two-Factor Authentication Routes
+		protectedUser.POST("/me/mfa/enroll", mfaHandler.Enroll)
+		protectedUser.POST("/me/mfa/confirm", mfaHandler.Confirm)
+		protectedUser.POST("/me/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
+		protectedUser.POST("/me/mfa/disable", mfaHandler.Disable)
 
 		// Cart Routes
 		protectedUser.POST("/cart", cartHandler.AddToCart)
 		protectedUser.GET("/cart", cartHandler.GetCart)
+		protectedUser.GET("/cart/shipping-options", shippingHandler.GetShippingOptions)
 
 		// Order Routes
 		protectedUser.POST("/orders", orderHandler.CreateOrder)
 		protectedUser.GET("/orders", orderHandler.GetOrders)
+		if paymentHandler.Mock != nil {
+			protectedUser.POST("/payments/mock/:ref/challenge", paymentHandler.CompleteMockChallenge)
+		}
+
+		// Return Routes
+		protectedUser.POST("/orders/:id/returns", returnHandler.CreateReturn)
+		protectedUser.GET("/returns", returnHandler.GetMyReturns)
+		protectedUser.GET("/returns/:id", returnHandler.GetMyReturn)
+		if returnHandler.Media != nil {
+			protectedUser.POST("/returns/:id/photos", returnHandler.AddReturnPhoto)
+		}
 
 		// Review Routes (Protected - Write)
 		protectedUser.POST("/products/:id/reviews", reviewHandler.CreateReview)
@@ -196,7 +590,59 @@ func main() {
 	}
 
 	// Start server
-	if err := r.Run(":8080"); err != nil {
-		panic(err)
+	srv := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           r,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("listening", "addr", cfg.Server.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+	if metricsServer != nil {
+		go func() {
+			slog.Info("serving metrics", "addr", cfg.Metrics.Addr)
+			serveErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		rateLimitStore.Close()
+		idempotencyStore.Close()
+		config.CloseDatabase()
+		log.Fatal("Server failed: ", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Fail readiness first and give load balancers time to notice before
+	// the listener closes
+	healthService.SetShuttingDown()
+	if cfg.Server.DrainDelay > 0 {
+		slog.Info("readiness failing, waiting for load balancers", "drain_delay", cfg.Server.DrainDelay.String())
+		time.Sleep(cfg.Server.DrainDelay)
+	}
+
+	// Drain in-flight requests, then stop background work. The deferred
+	// CloseDatabase runs last so draining requests can still use the pool.
+	slog.Info("shutting down, draining requests", "shutdown_timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("graceful shutdown incomplete", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+	rateLimitStore.Close()
+	idempotencyStore.Close()
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
+	slog.Info("server stopped")
 }
@@ -27,6 +27,11 @@ const routes = [
         name: 'Register',
         component: () => import('../views/RegisterView.vue')
     },
+    {
+        path: '/auth/callback',
+        name: 'AuthCallback',
+        component: () => import('../views/AuthCallbackView.vue')
+    },
     {
         path: '/cart',
         name: 'Cart',
@@ -76,7 +81,8 @@ const router = createRouter({
 
 // Navigation Guard
 router.beforeEach(async (to, from, next) => {
-    const token = localStorage.getItem('token')
+    // Either a bearer token or, in cookie session mode, the CSRF token
+    const token = localStorage.getItem('token') || localStorage.getItem('csrf_token')
 
     // Requires authentication
     if (to.meta.requiresAuth && !token) {
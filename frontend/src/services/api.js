@@ -5,18 +5,29 @@ const API_BASE_URL = import.meta.env.VITE_API_URL || '/api'
 
 const api = axios.create({
     baseURL: API_BASE_URL,
+    // Send the HttpOnly session cookie when the API runs in cookie session mode
+    withCredentials: true,
     headers: {
         'Content-Type': 'application/json'
     }
 })
 
-// Add token to requests
+// Add token to requests, or the CSRF token to mutating requests in cookie session mode
 api.interceptors.request.use((config) => {
     const token = localStorage.getItem('token')
     if (token) {
         config.headers.Authorization = `Bearer ${token}`
     }
+    const csrfToken = localStorage.getItem('csrf_token')
+    if (csrfToken && !['get', 'head', 'options'].includes(config.method)) {
+        config.headers['X-CSRF-Token'] = csrfToken
+    }
     return config
 })
 
 export default api
+
+// Errors are RFC 7807 problem documents; detail is the message to show
+export function errorMessage(err, fallback) {
+    return err.response?.data?.detail || fallback
+}
@@ -4,31 +4,52 @@ import api from '../services/api'
 export const useAuthStore = defineStore('auth', {
     state: () => ({
         user: null,
-        token: localStorage.getItem('token') || null
+        token: localStorage.getItem('token') || null,
+        // Set instead of token when the API keeps the session in an HttpOnly cookie
+        csrfToken: localStorage.getItem('csrf_token') || null
     }),
 
     getters: {
-        isLoggedIn: (state) => !!state.token,
+        isLoggedIn: (state) => !!state.token || !!state.csrfToken,
         isAdmin: (state) => state.user?.role === 'admin'
     },
 
     actions: {
         async login(email, password) {
             const response = await api.post('/login', { email, password })
-            this.token = response.data.token
-            localStorage.setItem('token', this.token)
+            // Accounts with two-factor auth must complete verifyMfa first
+            if (response.data.mfa_required) {
+                return response.data
+            }
+            await this.setSession(response.data)
+            return response.data
+        },
+
+        async verifyMfa(mfaToken, code) {
+            const response = await api.post('/login/mfa', { mfa_token: mfaToken, code })
+            await this.setSession(response.data)
+            return response.data
+        },
+
+        async setSession({ token, csrf_token: csrfToken }) {
+            if (token) {
+                this.token = token
+                localStorage.setItem('token', token)
+            } else {
+                this.csrfToken = csrfToken
+                localStorage.setItem('csrf_token', csrfToken)
+            }
             // Fetch user info after login
             await this.fetchUser()
-            return response.data
         },
 
-        async register(email, password) {
-            const response = await api.post('/register', { email, password })
+        async register(email, password, dateOfBirth) {
+            const response = await api.post('/register', { email, password, date_of_birth: dateOfBirth })
             return response.data
         },
 
         async fetchUser() {
-            if (!this.token) return
+            if (!this.isLoggedIn) return
             try {
                 const response = await api.get('/me')
                 this.user = response.data.data
@@ -42,14 +63,20 @@ export const useAuthStore = defineStore('auth', {
         },
 
         logout() {
+            if (this.csrfToken) {
+                // Clear the session cookies; the stored token is simply dropped otherwise
+                api.post('/logout').catch(() => {})
+            }
             this.token = null
+            this.csrfToken = null
             this.user = null
             localStorage.removeItem('token')
+            localStorage.removeItem('csrf_token')
         },
 
         // Initialize auth state on app load
         async init() {
-            if (this.token) {
+            if (this.isLoggedIn) {
                 await this.fetchUser()
             }
         }
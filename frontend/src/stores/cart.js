@@ -30,8 +30,8 @@ export const useCartStore = defineStore('cart', {
             await this.fetchCart()
         },
 
-        async checkout() {
-            const response = await api.post('/orders')
+        async checkout(details = {}) {
+            const response = await api.post('/orders', details)
             this.items = []
             return response.data
         }
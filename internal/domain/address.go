@@ -0,0 +1,28 @@
+package domain
+
+import "gorm.io/gorm"
+
+// PostalAddress is where an order is delivered or billed. Orders keep a copy,
+// so later edits to the address book do not change past orders.
+type PostalAddress struct {
+	Name     string `gorm:"size:100" json:"name"` // recipient
+	Line1    string `gorm:"size:200" json:"line1"`
+	Line2    string `gorm:"size:200" json:"line2,omitempty"`
+	City     string `gorm:"size:100" json:"city"`
+	Region   string `gorm:"size:100" json:"region,omitempty"` // state, province or county
+	Postcode string `gorm:"size:20" json:"postcode,omitempty"`
+	Country  string `gorm:"size:2" json:"country"` // ISO 3166-1 alpha-2
+	Phone    string `gorm:"size:30" json:"phone,omitempty"`
+}
+
+// Address is an entry in a customer's address book. At most one address per
+// user is the default for shipping and one for billing.
+type Address struct {
+	gorm.Model
+	PostalAddress `gorm:"embedded"`
+
+	UserID            uint   `gorm:"index;not null" json:"user_id"`
+	Label             string `gorm:"size:50" json:"label,omitempty"` // e.g. Home, Office
+	IsDefaultShipping bool   `gorm:"not null;default:false" json:"is_default_shipping"`
+	IsDefaultBilling  bool   `gorm:"not null;default:false" json:"is_default_billing"`
+}
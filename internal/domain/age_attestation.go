@@ -0,0 +1,19 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AgeAttestation is the compliance record of the age check performed at checkout
+type AgeAttestation struct {
+	gorm.Model
+	OrderID         uint      `gorm:"uniqueIndex" json:"order_id"`
+	UserID          uint      `json:"user_id"`
+	DateOfBirth     time.Time `gorm:"type:date" json:"date_of_birth"`
+	ShippingCountry string    `json:"shipping_country"`
+	MinimumAge      int       `json:"minimum_age"`
+	AgeAtCheckout   int       `json:"age_at_checkout"`
+	AttestedAt      time.Time `json:"attested_at"`
+}
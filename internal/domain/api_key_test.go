@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKey_IsActive(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		key    APIKey
+		active bool
+	}{
+		{"No expiry", APIKey{}, true},
+		{"Not yet expired", APIKey{ExpiresAt: &future}, true},
+		{"Expired", APIKey{ExpiresAt: &past}, false},
+		{"Revoked", APIKey{RevokedAt: &past}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.IsActive(now); got != tt.active {
+				t.Errorf("APIKey.IsActive() = %v, want %v", got, tt.active)
+			}
+		})
+	}
+}
+
+func TestAPIKey_HasScope(t *testing.T) {
+	key := APIKey{Scopes: []string{"orders:read", "orders:write"}}
+
+	if !key.HasScope("orders:write") {
+		t.Error("Key should have orders:write scope")
+	}
+	if key.HasScope("products:write") {
+		t.Error("Key should not have products:write scope")
+	}
+}
+
+func TestIsValidAPIKeyScope(t *testing.T) {
+	for _, scope := range APIKeyScopes {
+		if !IsValidAPIKeyScope(scope) {
+			t.Errorf("Scope %s should be valid", scope)
+		}
+	}
+	if IsValidAPIKeyScope("admin:*") {
+		t.Error("Unknown scope should be invalid")
+	}
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func buildAuditChain(n int) []AuditLog {
+	entries := make([]AuditLog, n)
+	prev := ""
+	for i := range entries {
+		entries[i] = AuditLog{
+			ID:         uint(i + 1),
+			CreatedAt:  time.Date(2026, 1, 1, 12, 0, i, 0, time.UTC),
+			ActorID:    1,
+			Action:     "product.update",
+			EntityType: "product",
+			EntityID:   "7",
+			Before:     `{"price":10}`,
+			After:      `{"price":12}`,
+			PrevHash:   prev,
+		}
+		entries[i].Hash = entries[i].ComputeHash()
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+func TestVerifyAuditChain_Valid(t *testing.T) {
+	entries := buildAuditChain(5)
+	if id, ok := VerifyAuditChain("", entries); !ok {
+		t.Errorf("Valid chain reported broken at entry %d", id)
+	}
+}
+
+func TestVerifyAuditChain_DetectsTampering(t *testing.T) {
+	entries := buildAuditChain(5)
+	entries[2].After = `{"price":1}`
+
+	id, ok := VerifyAuditChain("", entries)
+	if ok {
+		t.Fatal("Tampered chain should not verify")
+	}
+	if id != 3 {
+		t.Errorf("Expected tampering detected at entry 3, got %d", id)
+	}
+}
+
+func TestVerifyAuditChain_DetectsDeletion(t *testing.T) {
+	entries := buildAuditChain(5)
+	entries = append(entries[:1], entries[2:]...)
+
+	if id, ok := VerifyAuditChain("", entries); ok || id != 3 {
+		t.Errorf("Deleted entry should break the chain at entry 3, got %d (ok=%v)", id, ok)
+	}
+}
+
+func TestAuditLog_ComputeHash_TimeZoneIndependent(t *testing.T) {
+	entry := buildAuditChain(1)[0]
+	local := entry
+	local.CreatedAt = entry.CreatedAt.In(time.FixedZone("UTC+7", 7*3600))
+
+	if entry.ComputeHash() != local.ComputeHash() {
+		t.Error("Hash should not depend on the time zone of CreatedAt")
+	}
+}
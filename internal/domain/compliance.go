@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of compliance rule
+const (
+	// ComplianceRuleDeny refuses shipments to matching destinations
+	ComplianceRuleDeny = "deny"
+	// ComplianceRuleAllow restricts each listed country to the destinations
+	// matched by its allow rules; unlisted countries are unaffected
+	ComplianceRuleAllow = "allow"
+	// ComplianceRuleLimit caps the bottles or litres of an order
+	ComplianceRuleLimit = "limit"
+	// ComplianceRuleAdultSignature requires an adult to sign for delivery
+	ComplianceRuleAdultSignature = "adult_signature"
+)
+
+// Codes of compliance violations
+const (
+	ComplianceDestinationDenied     = "destination_prohibited"
+	ComplianceDestinationNotAllowed = "destination_not_allowed"
+	ComplianceMaxBottlesExceeded    = "max_bottles_exceeded"
+	ComplianceMaxLitresExceeded     = "max_litres_exceeded"
+)
+
+// ComplianceRuleSet is a published version of the alcohol shipping rules.
+// Rule sets are never edited; publishing creates the next version, and
+// orders record the version they were checked against.
+type ComplianceRuleSet struct {
+	gorm.Model
+	Version uint             `gorm:"uniqueIndex;not null" json:"version"`
+	Note    string           `gorm:"size:500" json:"note,omitempty"` // why this version was published
+	Rules   []ComplianceRule `gorm:"serializer:json" json:"rules"`
+}
+
+// ComplianceRule applies to destinations in Countries, narrowed to Regions
+// and PostcodeRanges when given. Limit and adult signature rules without
+// countries apply everywhere.
+type ComplianceRule struct {
+	Name           string          `json:"name"`
+	Kind           string          `json:"kind"` // deny, allow, limit or adult_signature
+	Countries      []string        `json:"countries,omitempty"`
+	Regions        []string        `json:"regions,omitempty"`
+	PostcodeRanges []PostcodeRange `json:"postcode_ranges,omitempty"`
+	MaxBottles     int             `json:"max_bottles,omitempty"` // limit rules; 0 is no cap
+	MaxLitres      float64         `json:"max_litres,omitempty"`  // limit rules; 0 is no cap
+	// Message is shown to customers whose order breaks the rule, in place
+	// of a generated one
+	Message string `json:"message,omitempty"`
+}
+
+// Applies reports whether the rule covers dest
+func (r *ComplianceRule) Applies(dest PostalAddress) bool {
+	if len(r.Countries) == 0 {
+		return r.Kind == ComplianceRuleLimit || r.Kind == ComplianceRuleAdultSignature
+	}
+	_, ok := matchArea(r.Countries, r.Regions, r.PostcodeRanges, dest)
+	return ok
+}
+
+// ComplianceCheck is the outcome of checking an order against a rule set
+type ComplianceCheck struct {
+	Version        uint
+	AdultSignature bool
+	Violations     []ComplianceViolation
+}
+
+// ComplianceViolation is a rule an order breaks
+type ComplianceViolation struct {
+	Rule    string
+	Code    string
+	Message string
+}
+
+// Evaluate checks an order of bottles holding millilitres of wine against
+// every rule that applies to dest
+func (s *ComplianceRuleSet) Evaluate(dest PostalAddress, bottles, millilitres int) ComplianceCheck {
+	check := ComplianceCheck{Version: s.Version}
+	place := dest.Country
+	if dest.Region != "" {
+		place = dest.Region + ", " + dest.Country
+	}
+	litres := float64(millilitres) / 1000
+
+	// Whether allow rules name dest's country, and whether one matched it
+	var allowListed, allowed bool
+	var allowRule *ComplianceRule
+
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if rule.Kind == ComplianceRuleAllow {
+			if containsFold(rule.Countries, dest.Country) {
+				if allowRule == nil {
+					allowRule = rule
+				}
+				allowListed = true
+				allowed = allowed || rule.Applies(dest)
+			}
+			continue
+		}
+		if !rule.Applies(dest) {
+			continue
+		}
+
+		switch rule.Kind {
+		case ComplianceRuleDeny:
+			check.add(rule, ComplianceDestinationDenied, "wine cannot be shipped to "+place)
+		case ComplianceRuleLimit:
+			if rule.MaxBottles > 0 && bottles > rule.MaxBottles {
+				check.add(rule, ComplianceMaxBottlesExceeded,
+					fmt.Sprintf("orders to %s are limited to %d bottles; this order has %d", place, rule.MaxBottles, bottles))
+			}
+			if rule.MaxLitres > 0 && litres > rule.MaxLitres {
+				check.add(rule, ComplianceMaxLitresExceeded,
+					fmt.Sprintf("orders to %s are limited to %g litres; this order has %g", place, rule.MaxLitres, litres))
+			}
+		case ComplianceRuleAdultSignature:
+			check.AdultSignature = true
+		}
+	}
+
+	if allowListed && !allowed {
+		check.add(allowRule, ComplianceDestinationNotAllowed, "wine can only be shipped to approved destinations in "+dest.Country)
+	}
+	return check
+}
+
+func (c *ComplianceCheck) add(rule *ComplianceRule, code, message string) {
+	if rule.Message != "" {
+		message = rule.Message
+	}
+	c.Violations = append(c.Violations, ComplianceViolation{Rule: rule.Name, Code: code, Message: message})
+}
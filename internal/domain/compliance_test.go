@@ -0,0 +1,67 @@
+package domain
+
+import "testing"
+
+func TestComplianceRuleSet_Evaluate(t *testing.T) {
+	ruleSet := ComplianceRuleSet{
+		Version: 3,
+		Rules: []ComplianceRule{
+			{Name: "No shipping to Utah", Kind: ComplianceRuleDeny, Countries: []string{"US"}, Regions: []string{"UT"}},
+			{Name: "Licensed US states", Kind: ComplianceRuleAllow, Countries: []string{"US"}, Regions: []string{"CA", "NY", "UT"}},
+			{Name: "US shipment cap", Kind: ComplianceRuleLimit, Countries: []string{"US"}, MaxBottles: 12, MaxLitres: 9},
+			{Name: "Adult signature", Kind: ComplianceRuleAdultSignature, Countries: []string{"US", "CA"}},
+			{Name: "Global cap", Kind: ComplianceRuleLimit, MaxBottles: 60, Message: "Orders are limited to 60 bottles"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		dest      PostalAddress
+		bottles   int
+		ml        int
+		codes     []string
+		signature bool
+	}{
+		{"allowed state", PostalAddress{Country: "US", Region: "CA"}, 6, 4500, nil, true},
+		{"denied state", PostalAddress{Country: "US", Region: "UT"}, 1, 750, []string{ComplianceDestinationDenied}, true},
+		{"unlisted state", PostalAddress{Country: "US", Region: "TX"}, 1, 750, []string{ComplianceDestinationNotAllowed}, true},
+		{"too many bottles", PostalAddress{Country: "US", Region: "NY"}, 13, 9000, []string{ComplianceMaxBottlesExceeded}, true},
+		{"too many litres", PostalAddress{Country: "US", Region: "NY"}, 7, 10500, []string{ComplianceMaxLitresExceeded}, true},
+		{"country without allow rules", PostalAddress{Country: "FR"}, 24, 18000, nil, false},
+		{"everywhere cap", PostalAddress{Country: "GB"}, 61, 45750, []string{ComplianceMaxBottlesExceeded}, false},
+	}
+
+	for _, tt := range tests {
+		check := ruleSet.Evaluate(tt.dest, tt.bottles, tt.ml)
+		if check.Version != 3 || check.AdultSignature != tt.signature {
+			t.Errorf("%s: expected version 3 and adult signature %v, got %+v", tt.name, tt.signature, check)
+		}
+		if len(check.Violations) != len(tt.codes) {
+			t.Errorf("%s: expected violations %v, got %+v", tt.name, tt.codes, check.Violations)
+			continue
+		}
+		for i, code := range tt.codes {
+			if check.Violations[i].Code != code {
+				t.Errorf("%s: expected violation %s, got %+v", tt.name, code, check.Violations[i])
+			}
+		}
+	}
+}
+
+func TestComplianceRuleSet_EvaluateMessages(t *testing.T) {
+	ruleSet := ComplianceRuleSet{Rules: []ComplianceRule{
+		{Name: "US cap", Kind: ComplianceRuleLimit, Countries: []string{"US"}, MaxBottles: 12},
+		{Name: "Global cap", Kind: ComplianceRuleLimit, MaxBottles: 12, Message: "Orders are limited to 12 bottles"},
+	}}
+
+	check := ruleSet.Evaluate(PostalAddress{Country: "US", Region: "NY"}, 18, 13500)
+	if len(check.Violations) != 2 {
+		t.Fatalf("Expected both caps to be broken, got %+v", check.Violations)
+	}
+	if v := check.Violations[0]; v.Rule != "US cap" || v.Message != "orders to NY, US are limited to 12 bottles; this order has 18" {
+		t.Errorf("Expected a generated message, got %+v", v)
+	}
+	if v := check.Violations[1]; v.Message != "Orders are limited to 12 bottles" {
+		t.Errorf("Expected the rule's own message, got %+v", v)
+	}
+}
@@ -0,0 +1,15 @@
+package domain
+
+import "gorm.io/gorm"
+
+// LoginEvent is an entry in the login history of an account
+type LoginEvent struct {
+	gorm.Model
+	UserID    *uint  `gorm:"index" json:"user_id"` // nil when the email did not match an account
+	Email     string `gorm:"index" json:"email"`
+	IPAddress string `json:"ip_address"`
+	UserAgent string `json:"user_agent"`
+	Success   bool   `json:"success"`
+	Reason    string `json:"reason,omitempty"` // why the attempt failed
+	NewDevice bool   `json:"new_device"`
+}
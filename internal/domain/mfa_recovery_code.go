@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MFARecoveryCode is a hashed one-time code that can replace a TOTP code
+type MFARecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at,omitempty"`
+}
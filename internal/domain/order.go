@@ -2,12 +2,32 @@ package domain
 
 import "gorm.io/gorm"
 
+// Order statuses. Orders are pending until their payment succeeds and are
+// cancelled, with their stock released, if it fails.
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusCancelled = "cancelled"
+)
+
 type Order struct {
 	gorm.Model
-	UserID uint        `json:"user_id"`
-	Total  float64     `json:"total"`
-	Status string      `json:"status"` // pending, paid, shipped, cancelled
-	Items  []OrderItem `json:"items"`
+	UserID            uint            `json:"user_id"`
+	Subtotal          float64         `json:"subtotal"`
+	ShippingMethod    string          `json:"shipping_method"`
+	ShippingCost      float64         `json:"shipping_cost"`
+	Total             float64         `json:"total"`  // subtotal plus shipping
+	Status            string          `json:"status"` // pending, paid, shipped, cancelled
+	ShippingCountry   string          `json:"shipping_country"`
+	ShippingAddress   PostalAddress   `gorm:"embedded;embeddedPrefix:shipping_" json:"shipping_address"`
+	BillingAddress    PostalAddress   `gorm:"embedded;embeddedPrefix:billing_" json:"billing_address"`
+	ComplianceVersion uint            `json:"compliance_version"`                            // shipping rule set checked against; 0 if none was published
+	AdultSignature    bool            `gorm:"not null;default:false" json:"adult_signature"` // an adult must sign for delivery
+	Items             []OrderItem     `json:"items"`
+	Payments          []Payment       `json:"payments,omitempty"`
+	Refunds           []Refund        `json:"refunds,omitempty"`
+	AgeAttestation    *AgeAttestation `json:"age_attestation,omitempty"`
 }
 
 type OrderItem struct {
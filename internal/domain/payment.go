@@ -0,0 +1,31 @@
+package domain
+
+import "gorm.io/gorm"
+
+// Payment statuses. A payment starts processing, or requires_action while
+// the customer completes a challenge such as 3-D Secure, and ends succeeded
+// or failed once the provider's webhook reports the outcome.
+const (
+	PaymentStatusRequiresAction = "requires_action"
+	PaymentStatusProcessing     = "processing"
+	PaymentStatusSucceeded      = "succeeded"
+	PaymentStatusFailed         = "failed"
+)
+
+// Payment is an attempt to pay for an order through a payment provider
+type Payment struct {
+	gorm.Model
+	OrderID       uint    `gorm:"index;not null" json:"order_id"`
+	Provider      string  `gorm:"size:32;not null;uniqueIndex:idx_payments_provider_ref" json:"provider"`
+	ProviderRef   string  `gorm:"size:255;not null;uniqueIndex:idx_payments_provider_ref" json:"provider_ref"` // the provider's payment intent ID
+	Amount        float64 `gorm:"not null" json:"amount"`
+	Currency      string  `gorm:"size:3;not null" json:"currency"`
+	Status        string  `gorm:"size:32;not null" json:"status"`
+	NextActionURL string  `json:"next_action_url,omitempty"` // where the customer completes a challenge
+	FailureReason string  `json:"failure_reason,omitempty"`
+}
+
+// IsFinal reports whether the provider has reported the payment's outcome
+func (p *Payment) IsFinal() bool {
+	return p.Status == PaymentStatusSucceeded || p.Status == PaymentStatusFailed
+}
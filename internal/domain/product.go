@@ -2,6 +2,14 @@ package domain
 
 import "gorm.io/gorm"
 
+// DefaultBottleGrams is the shipping weight of a 75cl bottle, used for
+// products without a weight
+const DefaultBottleGrams = 1300
+
+// DefaultBottleML is the volume of a standard bottle, used for products
+// without a volume
+const DefaultBottleML = 750
+
 type Product struct {
 	gorm.Model
 	Name        string  `json:"name"`
@@ -10,6 +18,28 @@ type Product struct {
 	Stock       int     `json:"stock"`
 	ImageURL    string  `json:"image_url"`
 	Category    string  `json:"category"` // e.g., "Red", "White", "Sparkling"
+	// WeightGrams is the packed weight for shipping; 0 means a 75cl bottle
+	WeightGrams int `json:"weight_grams"`
+	// VolumeML is the wine per unit, e.g. 1500 for a magnum; 0 means 75cl
+	VolumeML int `json:"volume_ml"`
+	// Version is incremented on every change and is the product's ETag
+	Version uint `json:"version" gorm:"not null;default:1"`
+}
+
+// ShippingWeight returns the weight of one unit in grams
+func (p *Product) ShippingWeight() int {
+	if p.WeightGrams > 0 {
+		return p.WeightGrams
+	}
+	return DefaultBottleGrams
+}
+
+// Volume returns the wine in one unit in millilitres
+func (p *Product) Volume() int {
+	if p.VolumeML > 0 {
+		return p.VolumeML
+	}
+	return DefaultBottleML
 }
 
 // IsValid validates the product fields
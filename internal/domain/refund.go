@@ -0,0 +1,28 @@
+package domain
+
+import "gorm.io/gorm"
+
+// Refund statuses. A refund is reserved as pending before the provider is
+// asked, then succeeds or fails with the provider's answer. Pending refunds
+// count against what can still be refunded, so a refund whose outcome is
+// unknown, e.g. after a crash, must be checked with the provider.
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund is money returned to the customer against an order's payment.
+// Analytics count succeeded refunds as negative revenue on the day they were
+// made.
+type Refund struct {
+	gorm.Model
+	OrderID         uint    `gorm:"index;not null" json:"order_id"`
+	PaymentID       uint    `gorm:"index;not null" json:"payment_id"`
+	ReturnRequestID *uint   `gorm:"index" json:"return_request_id,omitempty"`
+	Amount          float64 `gorm:"not null" json:"amount"`
+	Currency        string  `gorm:"size:3;not null" json:"currency"`
+	Status          string  `gorm:"size:16;not null;default:succeeded" json:"status"`
+	ProviderRef     string  `gorm:"size:255;not null" json:"provider_ref"` // the provider's refund ID, empty until it succeeds
+	Reason          string  `json:"reason,omitempty"`
+}
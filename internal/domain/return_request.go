@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Return statuses. A customer's request is approved or rejected by an
+// admin, and an approved return is received once the bottles are back.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+)
+
+// Reasons a customer can give for a return
+const (
+	ReturnReasonCorked    = "corked"
+	ReturnReasonBroken    = "broken"
+	ReturnReasonWrongItem = "wrong_item"
+	ReturnReasonOther     = "other"
+)
+
+// ReturnRequest asks to send back some of the items of an order
+type ReturnRequest struct {
+	gorm.Model
+	OrderID    uint          `gorm:"index;not null" json:"order_id"`
+	UserID     uint          `gorm:"index;not null" json:"user_id"`
+	Reason     string        `gorm:"size:32;not null" json:"reason"`
+	Details    string        `json:"details,omitempty"`
+	Status     string        `gorm:"size:32;not null;index" json:"status"`
+	AdminNote  string        `json:"admin_note,omitempty"`
+	ReceivedAt *time.Time    `json:"received_at,omitempty"`
+	Restocked  bool          `gorm:"not null;default:false" json:"restocked"`
+	Items      []ReturnItem  `json:"items"`
+	Photos     []ReturnPhoto `json:"photos"`
+	Refunds    []Refund      `json:"refunds,omitempty"`
+}
+
+// ReturnItem is a quantity of one order item being returned
+type ReturnItem struct {
+	gorm.Model
+	ReturnRequestID uint      `gorm:"index;not null" json:"return_request_id"`
+	OrderItemID     uint      `gorm:"index;not null" json:"order_item_id"`
+	OrderItem       OrderItem `json:"order_item"`
+	Quantity        int       `gorm:"not null" json:"quantity"`
+}
+
+// ReturnPhoto shows the state of the returned bottles
+type ReturnPhoto struct {
+	gorm.Model
+	ReturnRequestID uint   `gorm:"index;not null" json:"return_request_id"`
+	URL             string `gorm:"not null" json:"url"`
+}
+
+// Value is what the returned items were bought for. OrderItem must be loaded.
+func (r *ReturnRequest) Value() float64 {
+	var value float64
+	for _, item := range r.Items {
+		value += item.OrderItem.Price * float64(item.Quantity)
+	}
+	return value
+}
+
+// Refunded is the total of the refunds recorded against the return that
+// did not fail, including pending ones
+func (r *ReturnRequest) Refunded() float64 {
+	var refunded float64
+	for _, refund := range r.Refunds {
+		if refund.Status != RefundStatusFailed {
+			refunded += refund.Amount
+		}
+	}
+	return refunded
+}
@@ -0,0 +1,24 @@
+package domain
+
+import "testing"
+
+func TestReturnRequest_ValueAndRefunded(t *testing.T) {
+	request := ReturnRequest{
+		Items: []ReturnItem{
+			{Quantity: 2, OrderItem: OrderItem{Quantity: 3, Price: 45.00}},
+			{Quantity: 1, OrderItem: OrderItem{Quantity: 1, Price: 12.50}},
+		},
+		Refunds: []Refund{
+			{Amount: 50, Status: RefundStatusSucceeded},
+			{Amount: 20, Status: RefundStatusPending},
+			{Amount: 30, Status: RefundStatusFailed},
+		},
+	}
+
+	if value := request.Value(); value != 102.50 {
+		t.Errorf("Expected the returned items to be worth 102.50, got %.2f", value)
+	}
+	if refunded := request.Refunded(); refunded != 70 {
+		t.Errorf("Expected 70 refunded, not counting the failed refund, got %.2f", refunded)
+	}
+}
@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Shipping methods offered by the shop
+const (
+	ShippingMethodStandard = "standard"
+	ShippingMethodExpress  = "express"
+	// ShippingMethodChilled is a temperature-controlled courier
+	ShippingMethodChilled = "chilled"
+)
+
+// What a shipping method's rates are charged by
+const (
+	RateBasisBottles = "bottles"
+	RateBasisWeight  = "weight" // kilograms
+)
+
+// ShippingZone is an area shipped to at the same rates. A destination is in
+// the zone when its country is listed and, if the zone has them, its region
+// and postcode match one of Regions and PostcodeRanges.
+type ShippingZone struct {
+	gorm.Model
+	Name           string           `gorm:"size:100;not null" json:"name"`
+	Countries      []string         `gorm:"serializer:json" json:"countries"` // ISO 3166-1 alpha-2
+	Regions        []string         `gorm:"serializer:json" json:"regions,omitempty"`
+	PostcodeRanges []PostcodeRange  `gorm:"serializer:json" json:"postcode_ranges,omitempty"`
+	Methods        []ShippingMethod `gorm:"foreignKey:ZoneID" json:"methods,omitempty"`
+}
+
+// PostcodeRange matches postcodes whose first len(From) characters, ignoring
+// spaces, sort between From and To inclusive, e.g. 90000-96199 or EH1-EH99
+type PostcodeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Contains reports whether a normalised postcode falls in the range
+func (r PostcodeRange) Contains(postcode string) bool {
+	compact := strings.ReplaceAll(postcode, " ", "")
+	if len(compact) < len(r.From) {
+		return false
+	}
+	prefix := compact[:len(r.From)]
+	return prefix >= r.From && prefix <= r.To
+}
+
+// Match reports whether a destination is in the zone, and how specifically:
+// zones matched by postcode beat those matched by region, which beat those
+// matched by country alone
+func (z *ShippingZone) Match(dest PostalAddress) (specificity int, ok bool) {
+	return matchArea(z.Countries, z.Regions, z.PostcodeRanges, dest)
+}
+
+// matchArea reports whether dest is in one of countries and, when given, one
+// of regions and postcode ranges. Specificity is 0 for a country match, 1
+// for a region and 2 for a postcode range.
+func matchArea(countries, regions []string, ranges []PostcodeRange, dest PostalAddress) (specificity int, ok bool) {
+	if !containsFold(countries, dest.Country) {
+		return 0, false
+	}
+	if len(regions) > 0 {
+		if !containsFold(regions, dest.Region) {
+			return 0, false
+		}
+		specificity = 1
+	}
+	if len(ranges) > 0 {
+		matched := false
+		for _, r := range ranges {
+			if r.Contains(dest.Postcode) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+		specificity = 2
+	}
+	return specificity, true
+}
+
+func containsFold(values []string, value string) bool {
+	value = strings.TrimSpace(value)
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShippingMethod is a way of shipping to a zone and what it costs
+type ShippingMethod struct {
+	gorm.Model
+	ZoneID    uint           `gorm:"index;not null" json:"zone_id"`
+	Code      string         `gorm:"size:32;not null" json:"code"` // standard, express or chilled
+	Name      string         `gorm:"size:100;not null" json:"name"`
+	RateBasis string         `gorm:"size:16;not null" json:"rate_basis"` // bottles or weight
+	Rates     []ShippingRate `gorm:"serializer:json" json:"rates"`
+	// FreeOver waives the cost for order subtotals of at least this amount;
+	// zero never waives it
+	FreeOver float64 `json:"free_over,omitempty"`
+	MinDays  int     `json:"min_days,omitempty"`
+	MaxDays  int     `json:"max_days,omitempty"`
+	Disabled bool    `gorm:"not null;default:false" json:"disabled"`
+}
+
+// ShippingRate is the price for shipments of up to UpTo bottles, or UpTo
+// kilograms for weight-based methods
+type ShippingRate struct {
+	UpTo  float64 `json:"up_to"`
+	Price float64 `json:"price"`
+}
+
+// Cost returns the price of shipping quantity bottles or kilograms with an
+// order subtotal of subtotal. It reports false when the shipment is larger
+// than the highest rate allows.
+func (m *ShippingMethod) Cost(quantity, subtotal float64) (float64, bool) {
+	best := -1
+	for i, rate := range m.Rates {
+		if quantity <= rate.UpTo && (best < 0 || rate.UpTo < m.Rates[best].UpTo) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	if m.FreeOver > 0 && subtotal >= m.FreeOver {
+		return 0, true
+	}
+	return m.Rates[best].Price, true
+}
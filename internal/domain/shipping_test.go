@@ -0,0 +1,73 @@
+package domain
+
+import "testing"
+
+func TestShippingZone_Match(t *testing.T) {
+	country := ShippingZone{Countries: []string{"US"}}
+	region := ShippingZone{Countries: []string{"US"}, Regions: []string{"CA", "OR"}}
+	postcode := ShippingZone{Countries: []string{"US"}, PostcodeRanges: []PostcodeRange{{From: "900", To: "961"}}}
+
+	tests := []struct {
+		zone        ShippingZone
+		dest        PostalAddress
+		specificity int
+		ok          bool
+	}{
+		{country, PostalAddress{Country: "US", Region: "NY"}, 0, true},
+		{country, PostalAddress{Country: "CA"}, 0, false},
+		{region, PostalAddress{Country: "US", Region: "ca"}, 1, true},
+		{region, PostalAddress{Country: "US", Region: "NY"}, 0, false},
+		{postcode, PostalAddress{Country: "US", Postcode: "94105"}, 2, true},
+		{postcode, PostalAddress{Country: "US", Postcode: "10001"}, 0, false},
+		{postcode, PostalAddress{Country: "US"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		specificity, ok := tt.zone.Match(tt.dest)
+		if ok != tt.ok || specificity != tt.specificity {
+			t.Errorf("%+v in %+v: expected (%d, %v), got (%d, %v)", tt.dest, tt.zone, tt.specificity, tt.ok, specificity, ok)
+		}
+	}
+}
+
+func TestPostcodeRange_Contains(t *testing.T) {
+	r := PostcodeRange{From: "EH1", To: "EH9"}
+
+	for postcode, expected := range map[string]bool{
+		"EH1 1YZ": true,
+		"EH9 9ZZ": true,
+		"G1 1AA":  false,
+		"EH":      false,
+	} {
+		if got := r.Contains(postcode); got != expected {
+			t.Errorf("Expected %s in %+v to be %v", postcode, r, expected)
+		}
+	}
+}
+
+func TestShippingMethod_Cost(t *testing.T) {
+	method := ShippingMethod{
+		Rates:    []ShippingRate{{UpTo: 12, Price: 18}, {UpTo: 3, Price: 9.50}, {UpTo: 6, Price: 12}},
+		FreeOver: 200,
+	}
+
+	tests := []struct {
+		quantity, subtotal float64
+		cost               float64
+		ok                 bool
+	}{
+		{1, 40, 9.50, true},
+		{3, 90, 9.50, true},
+		{4, 120, 12, true},
+		{12, 199.99, 18, true},
+		{6, 200, 0, true},
+		{13, 500, 0, false},
+	}
+
+	for _, tt := range tests {
+		cost, ok := method.Cost(tt.quantity, tt.subtotal)
+		if cost != tt.cost || ok != tt.ok {
+			t.Errorf("%v bottles for %.2f: expected (%.2f, %v), got (%.2f, %v)", tt.quantity, tt.subtotal, tt.cost, tt.ok, cost, ok)
+		}
+	}
+}
@@ -1,10 +1,77 @@
 package domain
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Account lockout settings: after MaxFailedLogins consecutive failures the
+// account is locked for BaseLockout, doubling with each further failure up to MaxLockout
+const (
+	MaxFailedLogins = 5
+	BaseLockout     = time.Minute
+	MaxLockout      = 24 * time.Hour
+)
 
 type User struct {
 	gorm.Model
-	Email    string `gorm:"uniqueIndex;not null" json:"email"`
-	Password string `gorm:"not null" json:"-"`
-	Role     string `gorm:"default:'customer'" json:"role"` // 'admin' or 'customer'
+	Email               string     `gorm:"uniqueIndex;not null" json:"email"`
+	Password            string     `gorm:"not null" json:"-"`
+	Role                string     `gorm:"default:'customer'" json:"role"` // 'admin' or 'customer'
+	DateOfBirth         *time.Time `gorm:"type:date" json:"date_of_birth,omitempty"`
+	FailedLoginAttempts int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil         *time.Time `json:"-"`
+	MFAEnabled          bool       `gorm:"not null;default:false" json:"mfa_enabled"`
+	MFASecret           string     `json:"-"` // base32 TOTP secret, pending until MFAEnabled
+	MFAEnrolledAt       *time.Time `json:"mfa_enrolled_at,omitempty"`
+	MFALastStep         int64      `gorm:"not null;default:0" json:"-"` // last accepted TOTP time step; codes up to it are replays
+}
+
+// IsAdmin reports whether the user has the admin role
+func (u *User) IsAdmin() bool {
+	return u.Role == "admin"
+}
+
+// IsLocked reports whether the account is locked out at the given time
+func (u *User) IsLocked(at time.Time) bool {
+	return u.LockedUntil != nil && at.Before(*u.LockedUntil)
+}
+
+// LockoutDuration returns how long an account is locked after the given
+// number of consecutive failed logins, or zero if it should not be locked
+func LockoutDuration(failedAttempts int) time.Duration {
+	if failedAttempts < MaxFailedLogins {
+		return 0
+	}
+	lockout := BaseLockout
+	for i := MaxFailedLogins; i < failedAttempts; i++ {
+		lockout *= 2
+		if lockout >= MaxLockout {
+			return MaxLockout
+		}
+	}
+	return lockout
+}
+
+// IsAgeVerified reports whether the user has attested a date of birth
+func (u *User) IsAgeVerified() bool {
+	return u.DateOfBirth != nil
+}
+
+// AgeOn returns the user's age in whole years on the given date
+func (u *User) AgeOn(at time.Time) int {
+	if u.DateOfBirth == nil {
+		return 0
+	}
+	return AgeOn(*u.DateOfBirth, at)
+}
+
+// AgeOn returns the age in whole years of someone born on dob at the given date
+func AgeOn(dob, at time.Time) int {
+	age := at.Year() - dob.Year()
+	if at.Month() < dob.Month() || (at.Month() == dob.Month() && at.Day() < dob.Day()) {
+		age--
+	}
+	return age
 }
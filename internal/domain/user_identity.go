@@ -0,0 +1,12 @@
+package domain
+
+import "gorm.io/gorm"
+
+// UserIdentity links an external OpenID Connect identity to a user
+type UserIdentity struct {
+	gorm.Model
+	UserID   uint   `gorm:"index;not null" json:"user_id"`
+	Provider string `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"provider"`
+	Subject  string `gorm:"uniqueIndex:idx_identity_provider_subject;not null" json:"-"`
+	Email    string `json:"email"`
+}
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgeOn(t *testing.T) {
+	dob := time.Date(2005, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int
+	}{
+		{"Day before birthday", time.Date(2026, time.June, 14, 0, 0, 0, 0, time.UTC), 20},
+		{"On birthday", time.Date(2026, time.June, 15, 0, 0, 0, 0, time.UTC), 21},
+		{"Earlier month", time.Date(2026, time.January, 30, 0, 0, 0, 0, time.UTC), 20},
+		{"Later month", time.Date(2026, time.December, 1, 0, 0, 0, 0, time.UTC), 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AgeOn(dob, tt.at); got != tt.want {
+				t.Errorf("AgeOn() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUser_IsAgeVerified(t *testing.T) {
+	u := User{Email: "test@example.com"}
+	if u.IsAgeVerified() {
+		t.Error("User without date of birth should not be age verified")
+	}
+
+	dob := time.Date(1990, time.March, 1, 0, 0, 0, 0, time.UTC)
+	u.DateOfBirth = &dob
+	if !u.IsAgeVerified() {
+		t.Error("User with date of birth should be age verified")
+	}
+}
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 0},
+		{MaxFailedLogins - 1, 0},
+		{MaxFailedLogins, BaseLockout},
+		{MaxFailedLogins + 1, 2 * BaseLockout},
+		{MaxFailedLogins + 3, 8 * BaseLockout},
+		{MaxFailedLogins + 50, MaxLockout},
+	}
+
+	for _, tt := range tests {
+		if got := LockoutDuration(tt.attempts); got != tt.want {
+			t.Errorf("LockoutDuration(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestUser_IsLocked(t *testing.T) {
+	now := time.Now()
+	u := User{}
+	if u.IsLocked(now) {
+		t.Error("User without lockout should not be locked")
+	}
+
+	until := now.Add(time.Minute)
+	u.LockedUntil = &until
+	if !u.IsLocked(now) {
+		t.Error("User should be locked before LockedUntil")
+	}
+	if u.IsLocked(until.Add(time.Second)) {
+		t.Error("User should be unlocked after LockedUntil")
+	}
+}
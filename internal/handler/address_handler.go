@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+)
+
+type AddressHandler struct {
+	Service *service.AddressService
+}
+
+// AddressInput is an address book entry. Postcodes are checked against the
+// country's format.
+type AddressInput struct {
+	Label             string `json:"label" binding:"max=50" example:"Home"`
+	Name              string `json:"name" binding:"required,max=100" example:"Ana Lima"`
+	Line1             string `json:"line1" binding:"required,max=200" example:"1 Market St"`
+	Line2             string `json:"line2" binding:"max=200" example:"Apt 4"`
+	City              string `json:"city" binding:"required,max=100" example:"San Francisco"`
+	Region            string `json:"region" binding:"max=100" example:"CA"`
+	Postcode          string `json:"postcode" binding:"max=20" example:"94105"`
+	Country           string `json:"country" binding:"required,len=2" example:"US"` // ISO 3166-1 alpha-2
+	Phone             string `json:"phone" binding:"max=30" example:"+1 415 555 0100"`
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+func (in *AddressInput) address() *domain.Address {
+	return &domain.Address{
+		Label: in.Label,
+		PostalAddress: domain.PostalAddress{
+			Name:     in.Name,
+			Line1:    in.Line1,
+			Line2:    in.Line2,
+			City:     in.City,
+			Region:   in.Region,
+			Postcode: in.Postcode,
+			Country:  in.Country,
+			Phone:    in.Phone,
+		},
+		IsDefaultShipping: in.IsDefaultShipping,
+		IsDefaultBilling:  in.IsDefaultBilling,
+	}
+}
+
+// GetAddresses godoc
+// @Summary      List my addresses
+// @Description  The address book of the authenticated user, defaults first
+// @Tags         Addresses
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Router       /me/addresses [get]
+func (h *AddressHandler) GetAddresses(c *gin.Context) {
+	addresses, err := h.Service.GetAddresses(c.Request.Context(), c.GetUint("user_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": addresses})
+}
+
+// GetAddress godoc
+// @Summary      Get one of my addresses
+// @Tags         Addresses
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int  true  "Address ID"
+// @Success      200    {object}  domain.Address
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /me/addresses/{id} [get]
+func (h *AddressHandler) GetAddress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "address")
+		return
+	}
+
+	address, err := h.Service.GetAddress(c.Request.Context(), c.GetUint("user_id"), uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": address})
+}
+
+// CreateAddress godoc
+// @Summary      Add an address
+// @Description  Add an address to the address book. The first address becomes the default for shipping and billing; setting a default flag clears it on the other addresses.
+// @Tags         Addresses
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      AddressInput  true  "Address"
+// @Success      201    {object}  domain.Address
+// @Failure      400    {object}  map[string]interface{}
+// @Router       /me/addresses [post]
+func (h *AddressHandler) CreateAddress(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input AddressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	address, err := h.Service.CreateAddress(c.Request.Context(), userID, input.address())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": address})
+}
+
+// UpdateAddress godoc
+// @Summary      Replace an address
+// @Description  Replace an address book entry. Orders keep the address as it was at checkout.
+// @Tags         Addresses
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int           true  "Address ID"
+// @Param        input  body      AddressInput  true  "Address"
+// @Success      200    {object}  domain.Address
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /me/addresses/{id} [put]
+func (h *AddressHandler) UpdateAddress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "address")
+		return
+	}
+
+	var input AddressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	address, err := h.Service.UpdateAddress(c.Request.Context(), c.GetUint("user_id"), uint(id), input.address())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": address})
+}
+
+// DeleteAddress godoc
+// @Summary      Delete an address
+// @Tags         Addresses
+// @Security     BearerAuth
+// @Param        id     path      int  true  "Address ID"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /me/addresses/{id} [delete]
+func (h *AddressHandler) DeleteAddress(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "address")
+		return
+	}
+
+	if err := h.Service.DeleteAddress(c.Request.Context(), c.GetUint("user_id"), uint(id)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
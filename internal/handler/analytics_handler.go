@@ -21,9 +21,9 @@ type AnalyticsHandler struct {
 // @Success      200 {object} service.DashboardStats
 // @Router       /admin/analytics/stats [get]
 func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
-	stats, err := h.Service.GetDashboardStats()
+	stats, err := h.Service.GetDashboardStats(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get stats"})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": stats})
@@ -37,9 +37,9 @@ func (h *AnalyticsHandler) GetDashboardStats(c *gin.Context) {
 // @Success      200 {array} service.SalesByCategory
 // @Router       /admin/analytics/sales-by-category [get]
 func (h *AnalyticsHandler) GetSalesByCategory(c *gin.Context) {
-	data, err := h.Service.GetSalesByCategory()
+	data, err := h.Service.GetSalesByCategory(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data"})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": data})
@@ -56,9 +56,9 @@ func (h *AnalyticsHandler) GetSalesByCategory(c *gin.Context) {
 func (h *AnalyticsHandler) GetTopProducts(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "5"))
 
-	data, err := h.Service.GetTopProducts(limit)
+	data, err := h.Service.GetTopProducts(c.Request.Context(), limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data"})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": data})
@@ -75,9 +75,9 @@ func (h *AnalyticsHandler) GetTopProducts(c *gin.Context) {
 func (h *AnalyticsHandler) GetSalesByDay(c *gin.Context) {
 	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
 
-	data, err := h.Service.GetSalesByDay(days)
+	data, err := h.Service.GetSalesByDay(c.Request.Context(), days)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data"})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": data})
@@ -94,9 +94,9 @@ func (h *AnalyticsHandler) GetSalesByDay(c *gin.Context) {
 func (h *AnalyticsHandler) GetRecentOrders(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 
-	data, err := h.Service.GetRecentOrders(limit)
+	data, err := h.Service.GetRecentOrders(c.Request.Context(), limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get data"})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"data": data})
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+)
+
+type APIKeyHandler struct {
+	Service *service.APIKeyService
+	Audit   *service.AuditService
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Issue a scoped API key that acts as the given user (Admin only). The key is only shown in this response.
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      service.CreateAPIKeyInput  true  "API key"
+// @Success      201    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Router       /admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var input service.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	plainKey, key, err := h.Service.CreateAPIKey(c.Request.Context(), &input, c.GetUint("user_id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "api_key.create", "api_key", key.ID, nil, key)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Store this key securely, it will not be shown again",
+		"key":     plainKey,
+		"data":    key,
+	})
+}
+
+// GetAPIKeys godoc
+// @Summary      List API keys
+// @Description  List all API keys with their scopes and last use (Admin only)
+// @Tags         API Keys
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {array} domain.APIKey
+// @Router       /admin/api-keys [get]
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.Service.GetAPIKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Permanently disable an API key (Admin only)
+// @Tags         API Keys
+// @Security     BearerAuth
+// @Param        id   path      int  true  "API key ID"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "API key")
+		return
+	}
+
+	if err := h.Service.RevokeAPIKey(c.Request.Context(), uint(id)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "api_key.revoke", "api_key", uint(id), nil, gin.H{"revoked": true})
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/utils"
+)
+
+type AuditHandler struct {
+	Service *service.AuditService
+}
+
+// GetAuditLogs godoc
+// @Summary      List audit log entries
+// @Description  Returns admin mutations, newest first, filtered by actor, entity and date range (Admin only)
+// @Tags         Audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        actor_id     query  int     false  "Actor user ID"
+// @Param        entity_type  query  string  false  "Entity type, e.g. product"
+// @Param        entity_id    query  string  false  "Entity ID"
+// @Param        from         query  string  false  "Start date (YYYY-MM-DD or RFC3339)"
+// @Param        to           query  string  false  "End date, exclusive (YYYY-MM-DD or RFC3339)"
+// @Param        page         query  int     false  "Page Number"
+// @Param        limit        query  int     false  "Limit per page"
+// @Success      200 {array} domain.AuditLog
+// @Failure      400 {object} map[string]interface{}
+// @Router       /admin/audit [get]
+func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	filter.Page = page
+	filter.Limit = limit
+
+	logs, total, err := h.Service.GetAuditLogs(c.Request.Context(), filter)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": logs,
+		"meta": gin.H{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// VerifyAuditLog godoc
+// @Summary      Verify the audit log
+// @Description  Recomputes the hash chain and reports the first tampered entry, if any (Admin only)
+// @Tags         Audit
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} service.AuditVerification
+// @Router       /admin/audit/verify [get]
+func (h *AuditHandler) VerifyAuditLog(c *gin.Context) {
+	result, err := h.Service.VerifyChain(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// GetAuditExportLink godoc
+// @Summary      Get an audit log export link
+// @Description  Returns a signed CSV download link, valid for a few minutes, that can be opened without an Authorization header (Admin only)
+// @Tags         Audit
+// @Produce      json
+// @Security     BearerAuth
+// @Param        actor_id     query  int     false  "Actor user ID"
+// @Param        entity_type  query  string  false  "Entity type, e.g. product"
+// @Param        entity_id    query  string  false  "Entity ID"
+// @Param        from         query  string  false  "Start date (YYYY-MM-DD or RFC3339)"
+// @Param        to           query  string  false  "End date, exclusive (YYYY-MM-DD or RFC3339)"
+// @Success      200 {object} map[string]interface{}
+// @Failure      400 {object} map[string]interface{}
+// @Router       /admin/audit/export-link [get]
+func (h *AuditHandler) GetAuditExportLink(c *gin.Context) {
+	if _, err := parseAuditFilter(c); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// The link is signed for exactly these filters
+	query := url.Values{}
+	for _, name := range []string{"actor_id", "entity_type", "entity_id", "from", "to"} {
+		if value := c.Query(name); value != "" {
+			query.Set(name, value)
+		}
+	}
+	path := strings.TrimSuffix(c.Request.URL.Path, "-link")
+	token, expiresAt, err := utils.GenerateDownloadToken(c.GetUint("user_id"), path, query)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	query.Set("token", token)
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"url":        path + "?" + query.Encode(),
+		"expires_at": expiresAt,
+	}})
+}
+
+// ExportAuditLogs godoc
+// @Summary      Export the audit log
+// @Description  Streams matching entries, oldest first, as CSV. Accepts a bearer token or the signed token from /admin/audit/export-link (Admin only)
+// @Tags         Audit
+// @Produce      text/csv
+// @Security     BearerAuth
+// @Param        token  query  string  false  "Signed download token"
+// @Success      200 {file} file
+// @Failure      400 {object} map[string]interface{}
+// @Router       /admin/audit/export [get]
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit-log.csv"`)
+	c.Header("Cache-Control", "no-store")
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "created_at", "actor_id", "api_key_id", "action", "entity_type", "entity_id", "changes", "ip_address", "request_id", "hash"})
+	err = h.Service.ExportAuditLogs(c.Request.Context(), filter, func(entry domain.AuditLog) error {
+		apiKeyID := ""
+		if entry.APIKeyID != nil {
+			apiKeyID = strconv.FormatUint(uint64(*entry.APIKeyID), 10)
+		}
+		return w.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatUint(uint64(entry.ActorID), 10),
+			apiKeyID,
+			entry.Action,
+			entry.EntityType,
+			entry.EntityID,
+			string(entry.Changes),
+			entry.IPAddress,
+			entry.RequestID,
+			entry.Hash,
+		})
+	})
+	w.Flush()
+	if err != nil {
+		// Headers are already sent, so the truncated file is all we can do
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to export audit log", "error", err)
+	}
+}
+
+// parseAuditFilter reads the actor, entity and date range query parameters
+func parseAuditFilter(c *gin.Context) (service.AuditFilter, error) {
+	filter := service.AuditFilter{
+		EntityType: c.Query("entity_type"),
+		EntityID:   c.Query("entity_id"),
+	}
+
+	if actor := c.Query("actor_id"); actor != "" {
+		actorID, err := strconv.Atoi(actor)
+		if err != nil {
+			return filter, invalidQuery("actor_id")
+		}
+		filter.ActorID = uint(actorID)
+	}
+
+	var err error
+	if filter.From, err = parseDateParam(c.Query("from")); err != nil {
+		return filter, invalidQuery("from")
+	}
+	if filter.To, err = parseDateParam(c.Query("to")); err != nil {
+		return filter, invalidQuery("to")
+	}
+	return filter, nil
+}
+
+func invalidQuery(name string) *service.Error {
+	message := "Invalid " + name
+	return service.Validation("validation_failed", message, service.FieldError{Field: name, Code: "invalid", Message: message})
+}
+
+// recordAudit appends an admin mutation to the audit log. The mutation has
+// already been applied, so failures are logged rather than failing the request.
+func recordAudit(c *gin.Context, audit *service.AuditService, action, entityType string, entityID uint, before, after interface{}) {
+	if audit == nil {
+		return
+	}
+
+	entry := service.AuditEntry{
+		ActorID:    c.GetUint("user_id"),
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   strconv.FormatUint(uint64(entityID), 10),
+		Before:     before,
+		After:      after,
+		IPAddress:  c.ClientIP(),
+		RequestID:  c.GetString("request_id"),
+	}
+	if value, ok := c.Get("api_key"); ok {
+		if key, ok := value.(*domain.APIKey); ok {
+			entry.APIKeyID = &key.ID
+		}
+	}
+
+	ctx := c.Request.Context()
+	if _, err := audit.Record(ctx, entry); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to record audit entry",
+			"action", action, "entity_type", entityType, "entity_id", entry.EntityID, "error", err)
+	}
+}
+
+// parseDateParam accepts YYYY-MM-DD or RFC3339; empty values return nil
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -2,20 +2,36 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/utils"
 )
 
 type AuthHandler struct {
 	Service *service.UserService
+	// Sessions enables HttpOnly cookie sessions; nil returns bearer tokens only
+	Sessions *utils.SessionCookieConfig
 }
 
+// dateOfBirthLayout is the expected format for dates of birth (YYYY-MM-DD)
+const dateOfBirthLayout = "2006-01-02"
+
+var errInvalidDateOfBirth = service.Validation("validation_failed", "date_of_birth must be in YYYY-MM-DD format",
+	service.FieldError{Field: "date_of_birth", Code: "format", Message: "must be in YYYY-MM-DD format"})
+
 type RegisterInput struct {
-	Email    string `json:"email" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Email       string `json:"email" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+	DateOfBirth string `json:"date_of_birth" binding:"required" example:"1990-05-21"`
+}
+
+type VerifyAgeInput struct {
+	DateOfBirth string `json:"date_of_birth" binding:"required" example:"1990-05-21"`
 }
 
 type LoginInput struct {
@@ -25,7 +41,7 @@ type LoginInput struct {
 
 // Register godoc
 // @Summary      Register a new user
-// @Description  Create a new user account with email and password
+// @Description  Create a new user account with email, password and date of birth (YYYY-MM-DD)
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -36,18 +52,25 @@ type LoginInput struct {
 func (h *AuthHandler) Register(c *gin.Context) {
 	var input RegisterInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	dob, err := time.Parse(dateOfBirthLayout, input.DateOfBirth)
+	if err != nil {
+		respondError(c, errInvalidDateOfBirth)
 		return
 	}
 
 	u := domain.User{
-		Email:    input.Email,
-		Password: input.Password,
+		Email:       input.Email,
+		Password:    input.Password,
+		DateOfBirth: &dob,
 	}
 
-	user, err := h.Service.Register(&u)
+	user, err := h.Service.Register(c.Request.Context(), &u)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -56,28 +79,48 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 // Login godoc
 // @Summary      Login user
-// @Description  Authenticate user and return JWT token
+// @Description  Authenticate user and return JWT token. Accounts with MFA enabled receive an mfa_token to complete via /login/mfa instead.
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param        input  body      LoginInput  true  "Login Input"
-// @Success      200    {object}  map[string]interface{}
+// @Success      200    {object}  service.LoginResult
 // @Failure      400    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Failure      429    {object}  map[string]interface{}
 // @Router       /login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var input LoginInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	token, err := h.Service.Login(input.Email, input.Password)
+	result, err := h.Service.Login(c.Request.Context(), input.Email, input.Password, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email or password"})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	if err := startSession(c, h.Sessions, result); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  Clears the session cookies in cookie session mode. Bearer tokens are stateless and are simply discarded by the client.
+// @Tags         Auth
+// @Success      200 {object} map[string]interface{}
+// @Router       /logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if h.Sessions != nil {
+		utils.ClearSessionCookies(c, h.Sessions)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
 }
 
 // GetMe godoc
@@ -91,15 +134,85 @@ func (h *AuthHandler) Login(c *gin.Context) {
 func (h *AuthHandler) GetMe(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		respondUnauthorized(c)
 		return
 	}
 
-	user, err := h.Service.GetUserByID(userID.(uint))
+	user, err := h.Service.GetUserByID(c.Request.Context(), userID.(uint))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": user})
 }
+
+// VerifyAge godoc
+// @Summary      Verify age
+// @Description  Record the date of birth for an account created before it was required
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      VerifyAgeInput  true  "Date of birth"
+// @Success      200    {object}  domain.User
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Router       /me/age-verification [post]
+func (h *AuthHandler) VerifyAge(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input VerifyAgeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	dob, err := time.Parse(dateOfBirthLayout, input.DateOfBirth)
+	if err != nil {
+		respondError(c, errInvalidDateOfBirth)
+		return
+	}
+
+	user, err := h.Service.VerifyAge(c.Request.Context(), userID.(uint), dob)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "age verified", "data": user})
+}
+
+// GetLoginHistory godoc
+// @Summary      Get login history
+// @Description  Returns recent login attempts for the authenticated user
+// @Tags         Auth
+// @Security     BearerAuth
+// @Param        limit query int false "Number of entries" default(20)
+// @Success      200 {array} domain.LoginEvent
+// @Failure      401 {object} map[string]interface{}
+// @Router       /me/logins [get]
+func (h *AuthHandler) GetLoginHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	events, err := h.Service.GetLoginHistory(c.Request.Context(), userID.(uint), limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": events})
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"wine-shop-api/internal/service"
-	"wine-shop-api/pkg/utils"
 )
 
 type CartHandler struct {
@@ -31,20 +30,20 @@ type AddToCartInput struct {
 // @Failure      401    {object}  map[string]interface{}
 // @Router       /cart [post]
 func (h *CartHandler) AddToCart(c *gin.Context) {
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
 	var input AddToCartInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	if err := h.Service.AddToCart(userID, input.ProductID, input.Quantity); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := h.Service.AddToCart(c.Request.Context(), userID, input.ProductID, input.Quantity); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -63,15 +62,15 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 // @Failure      500    {object}  map[string]interface{}
 // @Router       /cart [get]
 func (h *CartHandler) GetCart(c *gin.Context) {
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
-	cart, err := h.Service.GetCart(userID)
+	cart, err := h.Service.GetCart(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+)
+
+type ComplianceHandler struct {
+	Service *service.ComplianceService
+	Audit   *service.AuditService
+}
+
+// GetComplianceRules godoc
+// @Summary      Current shipping compliance rules (Admin)
+// @Description  The latest published rule set; version 0 with no rules when none has been published
+// @Tags         Compliance
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200    {object}  domain.ComplianceRuleSet
+// @Router       /admin/compliance/rules [get]
+func (h *ComplianceHandler) GetComplianceRules(c *gin.Context) {
+	ruleSet, err := h.Service.GetCurrentRuleSet(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": ruleSet})
+}
+
+// PublishComplianceRules godoc
+// @Summary      Publish shipping compliance rules (Admin)
+// @Description  Replaces the rules with a new version that applies to every later checkout. Rules are deny, allow, limit (max_bottles, max_litres) or adult_signature, for destinations given by countries, regions and postcode_ranges.
+// @Tags         Compliance
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      domain.ComplianceRuleSet  true  "Rules and an optional note"
+// @Success      201    {object}  domain.ComplianceRuleSet
+// @Failure      400    {object}  map[string]interface{}
+// @Router       /admin/compliance/rules [put]
+func (h *ComplianceHandler) PublishComplianceRules(c *gin.Context) {
+	var ruleSet domain.ComplianceRuleSet
+	if err := c.ShouldBindJSON(&ruleSet); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, err := h.Service.GetCurrentRuleSet(ctx)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	published, err := h.Service.PublishRuleSet(ctx, &ruleSet)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "compliance_rules.publish", "compliance_rule_set", published.ID, before, published)
+
+	c.JSON(http.StatusCreated, gin.H{"data": published})
+}
+
+// GetComplianceRuleVersions godoc
+// @Summary      List published compliance rule sets (Admin)
+// @Tags         Compliance
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200    {object}  map[string]interface{}
+// @Router       /admin/compliance/rules/versions [get]
+func (h *ComplianceHandler) GetComplianceRuleVersions(c *gin.Context) {
+	ruleSets, err := h.Service.GetRuleSets(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": ruleSets})
+}
+
+// GetComplianceRuleVersion godoc
+// @Summary      Get a published compliance rule set (Admin)
+// @Description  e.g. the version recorded on an order as compliance_version
+// @Tags         Compliance
+// @Produce      json
+// @Security     BearerAuth
+// @Param        version  path      int  true  "Rule set version"
+// @Success      200      {object}  domain.ComplianceRuleSet
+// @Failure      404      {object}  map[string]interface{}
+// @Router       /admin/compliance/rules/versions/{version} [get]
+func (h *ComplianceHandler) GetComplianceRuleVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		respondInvalidID(c, "rule set")
+		return
+	}
+
+	ruleSet, err := h.Service.GetRuleSet(c.Request.Context(), uint(version))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": ruleSet})
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/pkg/httpcache"
+	"wine-shop-api/pkg/problem"
+)
+
+// productETag is the strong ETag of a product version
+func productETag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+// notModified sets the ETag and Last-Modified validators and, when the
+// client's cached copy is still current, responds 304 and returns true
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if httpcache.NotModified(c.Request, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatchVersion reads the product version a write is conditional on from
+// If-Match. "*" matches whatever version exists and is returned as 0; the
+// service then updates against the version it reads. When the header is
+// missing it responds 428, and 412 when it cannot match any version, e.g. a
+// weak or malformed ETag.
+func ifMatchVersion(c *gin.Context) (uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		problem.Error(c, http.StatusPreconditionRequired, "precondition_required",
+			"If-Match is required; send the ETag from GET /api/products/:id")
+		return 0, false
+	}
+	if header == "*" {
+		return 0, true
+	}
+
+	version, err := strconv.ParseUint(strings.Trim(header, `"`), 10, 32)
+	if err != nil || version == 0 || header != productETag(uint(version)) {
+		problem.Error(c, http.StatusPreconditionFailed, "version_mismatch",
+			"If-Match does not match the current product version")
+		return 0, false
+	}
+	return uint(version), true
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header  string
+		version uint
+		status  int
+	}{
+		{`"3"`, 3, http.StatusOK},
+		{` "12" `, 12, http.StatusOK},
+		{`*`, 0, http.StatusOK},
+		{``, 0, http.StatusPreconditionRequired},
+		{`W/"3"`, 0, http.StatusPreconditionFailed},
+		{`3`, 0, http.StatusPreconditionFailed},
+		{`"0"`, 0, http.StatusPreconditionFailed},
+		{`"3", "4"`, 0, http.StatusPreconditionFailed},
+	}
+
+	gin.SetMode(gin.TestMode)
+	for _, tt := range tests {
+		var version uint
+		r := gin.New()
+		r.PUT("/products/:id", func(c *gin.Context) {
+			var ok bool
+			if version, ok = ifMatchVersion(c); ok {
+				c.Status(http.StatusOK)
+			}
+		})
+
+		req := httptest.NewRequest("PUT", "/products/1", nil)
+		if tt.header != "" {
+			req.Header.Set("If-Match", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status || version != tt.version {
+			t.Errorf("If-Match %q: expected %d with version %d, got %d with version %d", tt.header, tt.status, tt.version, w.Code, version)
+		}
+	}
+}
+
+func TestPatchProduct_RejectsOtherContentTypes(t *testing.T) {
+	h := &ProductHandler{}
+	w, p := serveError(t, func(c *gin.Context) {
+		c.Params = gin.Params{{Key: "id", Value: "1"}}
+		c.Request.Header.Set("Content-Type", "text/plain")
+		h.PatchProduct(c)
+	}, `name=Merlot`)
+	if w.Code != http.StatusUnsupportedMediaType || p.Code != "unsupported_media_type" {
+		t.Errorf("Expected 415 unsupported_media_type, got %d %s", w.Code, p.Code)
+	}
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/problem"
+)
+
+func init() {
+	// Report validation failures by JSON field name instead of Go field name
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			if name == "" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// statusForKind maps each domain error kind to its HTTP status
+var statusForKind = map[service.ErrorKind]int{
+	service.KindNotFound:           http.StatusNotFound,
+	service.KindConflict:           http.StatusConflict,
+	service.KindValidation:         http.StatusBadRequest,
+	service.KindInsufficientStock:  http.StatusConflict,
+	service.KindForbidden:          http.StatusForbidden,
+	service.KindUnauthorized:       http.StatusUnauthorized,
+	service.KindLocked:             http.StatusTooManyRequests,
+	service.KindUpstream:           http.StatusBadGateway,
+	service.KindPreconditionFailed: http.StatusPreconditionFailed,
+	service.KindUnavailable:        http.StatusServiceUnavailable,
+}
+
+// respondError writes err as a problem response. Domain errors carry their
+// own status and code; anything else is attached to the request for the
+// access log and reported as a generic 500, so database and driver messages
+// never reach clients.
+func respondError(c *gin.Context, err error) {
+	var domainErr *service.Error
+	if !errors.As(err, &domainErr) {
+		_ = c.Error(err)
+		problem.Error(c, http.StatusInternalServerError, problem.CodeInternal, "An internal error occurred")
+		return
+	}
+
+	status, ok := statusForKind[domainErr.Kind]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	p := problem.Problem{Status: status, Code: domainErr.Code, Detail: domainErr.Message}
+	for _, field := range domainErr.Fields {
+		p.Errors = append(p.Errors, problem.FieldError(field))
+	}
+	problem.Write(c, p)
+}
+
+// respondBindError reports a request body that could not be decoded or failed
+// validation, with one entry per offending field where possible
+func respondBindError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrs):
+		p := problem.Problem{
+			Status: http.StatusBadRequest,
+			Code:   problem.CodeValidationFailed,
+			Detail: "One or more fields are invalid",
+		}
+		for _, fe := range validationErrs {
+			p.Errors = append(p.Errors, problem.FieldError{
+				Field:   fieldPath(fe),
+				Code:    fe.Tag(),
+				Message: validationMessage(fe),
+			})
+		}
+		problem.Write(c, p)
+	case errors.As(err, &typeErr):
+		message := fmt.Sprintf("must be of type %s", typeErr.Type)
+		problem.Write(c, problem.Problem{
+			Status: http.StatusBadRequest,
+			Code:   problem.CodeValidationFailed,
+			Detail: typeErr.Field + " " + message,
+			Errors: []problem.FieldError{{Field: typeErr.Field, Code: "type", Message: message}},
+		})
+	default:
+		problem.Error(c, http.StatusBadRequest, problem.CodeMalformedBody, "Request body is not valid JSON")
+	}
+}
+
+// fieldPath drops the root struct name from the validator namespace, e.g.
+// "CreateAPIKeyInput.scopes[0]" becomes "scopes[0]"
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "min":
+		return "must be at least " + fe.Param()
+	case "max":
+		return "must be at most " + fe.Param()
+	case "email":
+		return "must be a valid email address"
+	case "oneof":
+		return "must be one of " + fe.Param()
+	default:
+		return "is invalid"
+	}
+}
+
+// respondInvalidID reports a malformed numeric path parameter
+func respondInvalidID(c *gin.Context, resource string) {
+	problem.Error(c, http.StatusBadRequest, "invalid_id", "Invalid "+resource+" ID")
+}
+
+// respondUnauthorized is used when a route expects an authenticated user but
+// none is set on the context
+func respondUnauthorized(c *gin.Context) {
+	problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/problem"
+)
+
+func serveError(t *testing.T, handle gin.HandlerFunc, body string) (*httptest.ResponseRecorder, problem.Problem) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/test", handle)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/test", strings.NewReader(body)))
+
+	var p problem.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("Expected a problem document, got %q: %v", w.Body.String(), err)
+	}
+	return w, p
+}
+
+func TestRespondError_MapsDomainErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{service.ErrProductNotFound, http.StatusNotFound, "product_not_found"},
+		{service.ErrEmailInUse, http.StatusConflict, "email_in_use"},
+		{service.ErrCartEmpty, http.StatusBadRequest, "cart_empty"},
+		{service.ErrInsufficientStock, http.StatusConflict, "insufficient_stock"},
+		{service.ErrUnderage, http.StatusForbidden, "underage"},
+		{service.ErrInvalidCredentials, http.StatusUnauthorized, "invalid_credentials"},
+		{service.ErrAccountLocked, http.StatusTooManyRequests, "account_locked"},
+		{service.ErrOAuthExchangeFailed.Wrap(errors.New("token endpoint returned 500")), http.StatusBadGateway, "oauth_exchange_failed"},
+		{service.ErrProductVersionMismatch, http.StatusPreconditionFailed, "version_mismatch"},
+		{service.ErrPaymentsUnavailable, http.StatusServiceUnavailable, "payments_unavailable"},
+	}
+
+	for _, tt := range tests {
+		w, p := serveError(t, func(c *gin.Context) { respondError(c, tt.err) }, "")
+		if w.Code != tt.status || p.Code != tt.code {
+			t.Errorf("%v: expected %d %s, got %d %s", tt.err, tt.status, tt.code, w.Code, p.Code)
+		}
+		if strings.Contains(p.Detail, "token endpoint") {
+			t.Errorf("Expected the wrapped cause to stay out of the response, got %q", p.Detail)
+		}
+	}
+}
+
+func TestRespondError_ListsComplianceViolations(t *testing.T) {
+	err := service.ErrShippingRestricted.WithFields(
+		service.FieldError{Field: "shipping_address_id", Code: "destination_prohibited", Message: "wine cannot be shipped to UT, US"},
+		service.FieldError{Field: "items", Code: "max_bottles_exceeded", Message: "orders to US are limited to 12 bottles; this order has 18"},
+	)
+
+	w, p := serveError(t, func(c *gin.Context) { respondError(c, err) }, "")
+	if w.Code != http.StatusForbidden || p.Code != "shipping_restricted" {
+		t.Fatalf("Expected 403 shipping_restricted, got %d %s", w.Code, p.Code)
+	}
+	if len(p.Errors) != 2 || p.Errors[0].Code != "destination_prohibited" || p.Errors[1].Field != "items" {
+		t.Errorf("Expected one entry per violated rule, got %+v", p.Errors)
+	}
+	if len(service.ErrShippingRestricted.Fields) != 0 {
+		t.Errorf("Expected WithFields to leave the shared error untouched")
+	}
+}
+
+func TestRespondError_SanitisesInternalErrors(t *testing.T) {
+	cause := errors.New(`ERROR: relation "products" does not exist (SQLSTATE 42P01)`)
+	w, p := serveError(t, func(c *gin.Context) {
+		respondError(c, cause)
+		if len(c.Errors) != 1 {
+			t.Errorf("Expected the cause to be attached for logging, got %v", c.Errors)
+		}
+	}, "")
+
+	if w.Code != http.StatusInternalServerError || p.Code != problem.CodeInternal {
+		t.Errorf("Expected 500 %s, got %d %s", problem.CodeInternal, w.Code, p.Code)
+	}
+	if strings.Contains(w.Body.String(), "SQLSTATE") {
+		t.Errorf("Expected the database error to be hidden, got %s", w.Body.String())
+	}
+}
+
+func TestRespondBindError_FieldDetails(t *testing.T) {
+	bind := func(c *gin.Context) {
+		var input AddToCartInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+		}
+	}
+
+	w, p := serveError(t, bind, `{"quantity": 0}`)
+	if w.Code != http.StatusBadRequest || p.Code != problem.CodeValidationFailed {
+		t.Fatalf("Expected 400 %s, got %d %s", problem.CodeValidationFailed, w.Code, p.Code)
+	}
+	fields := map[string]string{}
+	for _, fe := range p.Errors {
+		fields[fe.Field] = fe.Code
+	}
+	if fields["product_id"] != "required" || fields["quantity"] != "required" {
+		t.Errorf("Expected per-field errors by JSON name, got %+v", p.Errors)
+	}
+
+	_, p = serveError(t, bind, `{"product_id": "one", "quantity": 1}`)
+	if len(p.Errors) != 1 || p.Errors[0].Field != "product_id" || p.Errors[0].Code != "type" {
+		t.Errorf("Expected a type error for product_id, got %+v", p.Errors)
+	}
+
+	_, p = serveError(t, bind, `{"product_id": 1,`)
+	if p.Code != problem.CodeMalformedBody {
+		t.Errorf("Expected %s for truncated JSON, got %s", problem.CodeMalformedBody, p.Code)
+	}
+}
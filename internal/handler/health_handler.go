@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+)
+
+type HealthHandler struct {
+	Service *service.HealthService
+}
+
+// Livez godoc
+// @Summary      Liveness probe
+// @Description  Reports that the process is up; dependencies are not checked
+// @Tags         Health
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /livez [get]
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": service.HealthOK})
+}
+
+// Readyz godoc
+// @Summary      Readiness probe
+// @Description  Checks the database, pending migrations and optional dependencies. Returns 503 when a required check fails or the server is shutting down.
+// @Tags         Health
+// @Produce      json
+// @Success      200  {object}  service.HealthReport
+// @Failure      503  {object}  service.HealthReport
+// @Router       /readyz [get]
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.Service.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, report)
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/utils"
+)
+
+type MFAHandler struct {
+	Service *service.MFAService
+	// Sessions enables HttpOnly cookie sessions; nil returns bearer tokens only
+	Sessions *utils.SessionCookieConfig
+}
+
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required" example:"123456"` // TOTP or recovery code
+}
+
+type MFALoginInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required" example:"123456"` // TOTP or recovery code
+}
+
+// Enroll godoc
+// @Summary      Start two-factor enrolment
+// @Description  Generate a TOTP secret and otpauth:// provisioning URI to render as a QR code
+// @Tags         MFA
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200 {object} service.MFAEnrollment
+// @Failure      400 {object} map[string]interface{}
+// @Failure      401 {object} map[string]interface{}
+// @Router       /me/mfa/enroll [post]
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	enrollment, err := h.Service.BeginEnrollment(c.Request.Context(), userID.(uint))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": enrollment})
+}
+
+// Confirm godoc
+// @Summary      Confirm two-factor enrolment
+// @Description  Activate MFA with a code from the authenticator app. Returns recovery codes, which are shown only once.
+// @Tags         MFA
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      MFACodeInput  true  "Authenticator code"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Router       /me/mfa/confirm [post]
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	codes, err := h.Service.ConfirmEnrollment(c.Request.Context(), userID.(uint), input.Code)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication enabled", "recovery_codes": codes})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary      Regenerate recovery codes
+// @Description  Invalidate existing recovery codes and issue a new set
+// @Tags         MFA
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      MFACodeInput  true  "Authenticator code"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Router       /me/mfa/recovery-codes [post]
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	codes, err := h.Service.RegenerateRecoveryCodes(c.Request.Context(), userID.(uint), input.Code)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable godoc
+// @Summary      Disable two-factor authentication
+// @Description  Turn off MFA. Not allowed for admins when MFA is enforced by policy.
+// @Tags         MFA
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      MFACodeInput  true  "Authenticator or recovery code"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      403    {object}  map[string]interface{}
+// @Router       /me/mfa/disable [post]
+func (h *MFAHandler) Disable(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.Service.Disable(c.Request.Context(), userID.(uint), input.Code); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// VerifyLogin godoc
+// @Summary      Complete two-factor login
+// @Description  Exchange the MFA challenge token from /login and a TOTP or recovery code for an access token
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        input  body      MFALoginInput  true  "MFA challenge"
+// @Success      200    {object}  service.LoginResult
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Failure      429    {object}  map[string]interface{}
+// @Router       /login/mfa [post]
+func (h *MFAHandler) VerifyLogin(c *gin.Context) {
+	var input MFALoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	result, err := h.Service.VerifyLogin(c.Request.Context(), input.MFAToken, input.Code, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if err := startSession(c, h.Sessions, result); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/problem"
+	"wine-shop-api/pkg/utils"
+)
+
+// oauthFlowCookie holds the signed state between the login redirect and the callback
+const oauthFlowCookie = "oidc_flow"
+
+var errSignInDenied = service.Validation("oauth_access_denied", "Sign-in was cancelled or denied by the identity provider")
+
+type OAuthHandler struct {
+	Service *service.OAuthService
+	// FrontendRedirectURL receives the login result in the URL fragment. When
+	// empty the callback responds with JSON instead.
+	FrontendRedirectURL string
+	// Sessions enables HttpOnly cookie sessions; nil returns bearer tokens only
+	Sessions *utils.SessionCookieConfig
+}
+
+// ListProviders godoc
+// @Summary      List social login providers
+// @Description  Returns the names of the configured OpenID Connect providers
+// @Tags         Auth
+// @Produce      json
+// @Success      200 {object} map[string]interface{}
+// @Router       /auth/oidc/providers [get]
+func (h *OAuthHandler) ListProviders(c *gin.Context) {
+	names := h.Service.ProviderNames()
+	sort.Strings(names)
+	c.JSON(http.StatusOK, gin.H{"data": names})
+}
+
+// StartLogin godoc
+// @Summary      Start social login
+// @Description  Redirects to the identity provider using the authorization code flow with PKCE
+// @Tags         Auth
+// @Param        provider  path  string  true  "Provider name, e.g. google"
+// @Success      302
+// @Failure      404 {object} map[string]interface{}
+// @Router       /auth/oidc/{provider}/login [get]
+func (h *OAuthHandler) StartLogin(c *gin.Context) {
+	authURL, flowToken, err := h.Service.StartLogin(c.Request.Context(), c.Param("provider"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	h.setFlowCookie(c, flowToken, int(utils.OAuthFlowLifespan.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback godoc
+// @Summary      Social login callback
+// @Description  Completes the authorization code flow, links the identity to the account with the same verified email and issues a token
+// @Tags         Auth
+// @Param        provider  path   string  true  "Provider name"
+// @Param        code      query  string  true  "Authorization code"
+// @Param        state     query  string  true  "State"
+// @Success      200 {object} service.LoginResult
+// @Success      302
+// @Failure      400 {object} map[string]interface{}
+// @Router       /auth/oidc/{provider}/callback [get]
+func (h *OAuthHandler) Callback(c *gin.Context) {
+	flowToken, _ := c.Cookie(oauthFlowCookie)
+	h.setFlowCookie(c, "", -1)
+
+	// Providers using response_mode=form_post (e.g. Apple) send a POST body
+	if providerErr := c.Request.FormValue("error"); providerErr != "" {
+		h.respondError(c, errSignInDenied)
+		return
+	}
+
+	result, err := h.Service.CompleteLogin(
+		c.Request.Context(),
+		c.Param("provider"),
+		c.Request.FormValue("code"),
+		c.Request.FormValue("state"),
+		flowToken,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+	)
+	if err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	if err := startSession(c, h.Sessions, result); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	if h.FrontendRedirectURL == "" {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+
+	// The fragment is never sent to servers, keeping the token out of access logs
+	fragment := url.Values{}
+	if result.MFARequired {
+		fragment.Set("mfa_required", "true")
+		fragment.Set("mfa_token", result.MFAToken)
+	} else if result.CSRFToken != "" {
+		fragment.Set("csrf_token", result.CSRFToken)
+	} else {
+		fragment.Set("token", result.Token)
+	}
+	c.Redirect(http.StatusFound, h.FrontendRedirectURL+"#"+fragment.Encode())
+}
+
+// GetIdentities godoc
+// @Summary      Get linked identities
+// @Description  Lists the social login identities linked to the authenticated user
+// @Tags         Auth
+// @Security     BearerAuth
+// @Success      200 {array} domain.UserIdentity
+// @Failure      401 {object} map[string]interface{}
+// @Router       /me/identities [get]
+func (h *OAuthHandler) GetIdentities(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		respondUnauthorized(c)
+		return
+	}
+
+	identities, err := h.Service.GetIdentities(c.Request.Context(), userID.(uint))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": identities})
+}
+
+// respondError reports a failed sign-in as a problem response, or in the
+// redirect fragment when the callback hands off to the frontend
+func (h *OAuthHandler) respondError(c *gin.Context, err error) {
+	if h.FrontendRedirectURL == "" {
+		respondError(c, err)
+		return
+	}
+
+	fragment := url.Values{"error": {"Login failed"}, "error_code": {problem.CodeInternal}}
+	var domainErr *service.Error
+	if errors.As(err, &domainErr) {
+		fragment.Set("error", domainErr.Message)
+		fragment.Set("error_code", domainErr.Code)
+	} else {
+		_ = c.Error(err)
+	}
+	c.Redirect(http.StatusFound, h.FrontendRedirectURL+"#"+fragment.Encode())
+}
+
+// setFlowCookie stores the flow token. Over HTTPS it uses SameSite=None so the
+// cookie survives form_post callbacks; otherwise Lax for local development.
+func (h *OAuthHandler) setFlowCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	c.SetSameSite(sameSite)
+	c.SetCookie(oauthFlowCookie, value, maxAge, "/api/auth/oidc", "", secure, true)
+}
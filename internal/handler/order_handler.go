@@ -6,38 +6,68 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"wine-shop-api/internal/service"
-	"wine-shop-api/pkg/utils"
 )
 
 type OrderHandler struct {
 	Service *service.OrderService
 }
 
+type CreateOrderInput struct {
+	// ShippingAddressID and BillingAddressID are entries of the address
+	// book; when omitted the default shipping and billing addresses are used
+	ShippingAddressID uint   `json:"shipping_address_id" example:"3"`
+	BillingAddressID  uint   `json:"billing_address_id" example:"3"`
+	ShippingCountry   string `json:"shipping_country" example:"US"` // ISO 3166-1 alpha-2, must match the shipping address
+	// ShippingMethod is a method from GET /cart/shipping-options; when
+	// omitted the cheapest is used
+	ShippingMethod string `json:"shipping_method" binding:"omitempty,oneof=standard express chilled" example:"standard"`
+	// PaymentMethod is a token from the payment provider; the mock provider
+	// accepts mock_success, mock_failure and mock_3ds
+	PaymentMethod string `json:"payment_method" example:"mock_success"`
+}
+
 // CreateOrder godoc
 // @Summary      Checkout (Place Order)
-// @Description  Convert current cart into an order and clear the cart
+// @Description  Convert current cart into a pending order, clear the cart and start the payment. The order becomes paid once the payment provider confirms the payment; follow payments[0].next_action_url when set. The order ships to the chosen or default shipping address, which is copied onto the order, and its total includes the cost of the chosen shipping method. The customer must meet the minimum drinking age of the shipping country, and the cart must pass the destination's shipping compliance rules, whose version is recorded on the order.
 // @Tags         Orders
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
+// @Param        input  body      CreateOrderInput  false  "Checkout details"
 // @Success      201    {object}  map[string]interface{}
 // @Failure      400    {object}  map[string]interface{}
 // @Failure      401    {object}  map[string]interface{}
+// @Failure      403    {object}  map[string]interface{}
+// @Failure      502    {object}  map[string]interface{}
 // @Router       /orders [post]
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
-	order, err := h.Service.CreateOrder(userID)
+	var input CreateOrderInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	order, err := h.Service.CreateOrder(c.Request.Context(), userID, service.CheckoutRequest{
+		ShippingAddressID: input.ShippingAddressID,
+		BillingAddressID:  input.BillingAddressID,
+		ShippingCountry:   input.ShippingCountry,
+		ShippingMethod:    input.ShippingMethod,
+		PaymentMethod:     input.PaymentMethod,
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Order placed successfully", "data": order})
+	c.JSON(http.StatusCreated, gin.H{"message": "Order placed, awaiting payment", "data": order})
 }
 
 // GetOrders godoc
@@ -52,15 +82,15 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 // @Failure      500    {object}  map[string]interface{}
 // @Router       /orders [get]
 func (h *OrderHandler) GetOrders(c *gin.Context) {
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
-	orders, err := h.Service.GetOrders(userID)
+	orders, err := h.Service.GetOrders(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
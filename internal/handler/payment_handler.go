@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/problem"
+)
+
+type PaymentHandler struct {
+	Service *service.PaymentService
+	// Mock is set when the mock provider is in use, enabling its 3-D Secure
+	// challenge endpoint
+	Mock *service.MockPaymentProvider
+}
+
+// maxWebhookBytes bounds the size of a webhook delivery
+const maxWebhookBytes = 64 << 10
+
+type MockChallengeInput struct {
+	Approve bool `json:"approve"`
+}
+
+// Webhook godoc
+// @Summary      Payment provider webhook
+// @Description  Receives signed payment events from the payment provider. Orders become paid when their payment is authorised or succeeds, and are cancelled when it fails.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Success      200    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /payments/webhook [post]
+func (h *PaymentHandler) Webhook(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		problem.Error(c, http.StatusBadRequest, problem.CodeMalformedBody, "Request body could not be read")
+		return
+	}
+
+	if err := h.Service.HandleWebhook(c.Request.Context(), payload, c.Request.Header); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true})
+}
+
+// CompleteMockChallenge godoc
+// @Summary      Complete a mock 3-D Secure challenge
+// @Description  Passes or fails the challenge of a mock payment in the 3ds scenario, for the customer who placed the order. Only available with PAYMENT_PROVIDER=mock and PAYMENT_MOCK_ENABLED=true.
+// @Tags         Payments
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        ref    path      string              true  "Payment intent reference"
+// @Param        input  body      MockChallengeInput  true  "Challenge outcome"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /payments/mock/{ref}/challenge [post]
+func (h *PaymentHandler) CompleteMockChallenge(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input MockChallengeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	// Other customers' payments are reported as missing
+	payment, err := h.Service.GetUserPayment(c.Request.Context(), userID, c.Param("ref"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if err := h.Mock.CompleteChallenge(payment.ProviderRef, input.Approve); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Challenge completed, the outcome is sent by webhook"})
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompleteMockChallenge_RequiresCustomer(t *testing.T) {
+	h := &PaymentHandler{}
+	w, p := serveError(t, func(c *gin.Context) {
+		c.Params = gin.Params{{Key: "ref", Value: "mock_pi_1"}}
+		h.CompleteMockChallenge(c)
+	}, `{"approve": true}`)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a signed-in customer, got %d %s", w.Code, p.Code)
+	}
+}
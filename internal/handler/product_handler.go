@@ -1,17 +1,23 @@
 package handler
 
 import (
+	"io"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/httpcache"
+	"wine-shop-api/pkg/mergepatch"
+	"wine-shop-api/pkg/problem"
 )
 
 type ProductHandler struct {
 	Service *service.ProductService
+	Audit   *service.AuditService
 }
 
 // CreateProduct godoc
@@ -29,16 +35,19 @@ type ProductHandler struct {
 func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	var product domain.Product
 	if err := c.ShouldBindJSON(&product); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
-	createdProduct, err := h.Service.CreateProduct(&product)
+	createdProduct, err := h.Service.CreateProduct(c.Request.Context(), &product)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	recordAudit(c, h.Audit, "product.create", "product", createdProduct.ID, nil, createdProduct)
+
+	c.Header("ETag", productETag(createdProduct.Version))
 	c.JSON(http.StatusCreated, gin.H{"data": createdProduct})
 }
 
@@ -53,6 +62,9 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 // @Param        search    query     string  false  "Search by wine name"
 // @Param        category  query     string  false  "Filter by category (Red, White, Rosé)"
 // @Success      200    {object}  map[string]interface{}
+// @Success      304    "Not modified since If-None-Match / If-Modified-Since"
+// @Header       200    {string}  ETag           "Weak ETag of the catalogue"
+// @Header       200    {string}  Last-Modified  "When any product last changed"
 // @Failure      500    {object}  map[string]interface{}
 // @Router       /products [get]
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
@@ -61,9 +73,20 @@ func (h *ProductHandler) GetAllProducts(c *gin.Context) {
 	search := c.Query("search")
 	category := c.Query("category")
 
-	products, total, err := h.Service.GetAllProducts(page, limit, search, category)
+	// Answer revalidations from the catalogue's modification time alone,
+	// before loading the page
+	lastModified, err := h.Service.LastModified(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if notModified(c, httpcache.WeakETag(lastModified), lastModified) {
+		return
+	}
+
+	products, total, err := h.Service.GetAllProducts(c.Request.Context(), page, limit, search, category)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -87,56 +110,136 @@ func (h *ProductHandler) GetAllProducts(c *gin.Context) {
 // @Produce      json
 // @Param        id     path      int  true  "Product ID"
 // @Success      200    {object}  domain.Product
+// @Success      304    "Not modified since If-None-Match / If-Modified-Since"
+// @Header       200    {string}  ETag           "Product version, for If-Match"
+// @Header       200    {string}  Last-Modified  "When the product last changed"
 // @Failure      400    {object}  map[string]interface{}
 // @Failure      404    {object}  map[string]interface{}
 // @Router       /products/{id} [get]
 func (h *ProductHandler) GetProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondInvalidID(c, "product")
 		return
 	}
 
-	product, err := h.Service.GetProductByID(uint(id))
+	product, err := h.Service.GetProductByID(c.Request.Context(), uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		respondError(c, err)
 		return
 	}
 
+	if notModified(c, productETag(product.Version), product.UpdatedAt) {
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"data": product})
 }
 
 // UpdateProduct godoc
 // @Summary      Update a product
-// @Description  Update details of a wine (Admin only)
+// @Description  Replace the details of a wine (Admin only). If-Match must carry the ETag from the last read; a stale ETag gets 412.
 // @Tags         Products
 // @Accept       json
 // @Produce      json
 // @Security     BearerAuth
-// @Param        id     path      int             true  "Product ID"
-// @Param        input  body      domain.Product  true  "Product Data"
+// @Param        id        path      int             true  "Product ID"
+// @Param        If-Match  header    string          true  "ETag of the version being replaced, or *"
+// @Param        input     body      domain.Product  true  "Product Data"
 // @Success      200    {object}  domain.Product
 // @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      412    {object}  map[string]interface{}
+// @Failure      428    {object}  map[string]interface{}
 // @Router       /admin/products/{id} [put]
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondInvalidID(c, "product")
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
 	var input domain.Product
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	before, err := h.Service.GetProductByID(c.Request.Context(), uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	updatedProduct, err := h.Service.UpdateProduct(c.Request.Context(), uint(id), version, &input)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "product.update", "product", updatedProduct.ID, before, updatedProduct)
+
+	c.Header("ETag", productETag(updatedProduct.Version))
+	c.JSON(http.StatusOK, gin.H{"data": updatedProduct})
+}
+
+// PatchProduct godoc
+// @Summary      Partially update a product
+// @Description  Apply a JSON Merge Patch (RFC 7396) to a wine (Admin only). Fields left out keep their values. If-Match works as for PUT.
+// @Tags         Products
+// @Accept       application/merge-patch+json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id        path      int             true  "Product ID"
+// @Param        If-Match  header    string          true  "ETag of the version being patched, or *"
+// @Param        input     body      domain.Product  true  "Fields to change"
+// @Success      200    {object}  domain.Product
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      412    {object}  map[string]interface{}
+// @Failure      415    {object}  map[string]interface{}
+// @Failure      428    {object}  map[string]interface{}
+// @Router       /admin/products/{id} [patch]
+func (h *ProductHandler) PatchProduct(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "product")
+		return
+	}
+	if contentType := c.ContentType(); contentType != mergepatch.ContentType && contentType != binding.MIMEJSON {
+		problem.Error(c, http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"PATCH bodies must be "+mergepatch.ContentType)
+		return
+	}
+	version, ok := ifMatchVersion(c)
+	if !ok {
 		return
 	}
 
-	updatedProduct, err := h.Service.UpdateProduct(uint(id), &input)
+	patch, err := io.ReadAll(c.Request.Body)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		problem.Error(c, http.StatusBadRequest, problem.CodeMalformedBody, "Request body could not be read")
 		return
 	}
 
+	before, err := h.Service.GetProductByID(c.Request.Context(), uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	updatedProduct, err := h.Service.PatchProduct(c.Request.Context(), uint(id), version, patch)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "product.update", "product", updatedProduct.ID, before, updatedProduct)
+
+	c.Header("ETag", productETag(updatedProduct.Version))
 	c.JSON(http.StatusOK, gin.H{"data": updatedProduct})
 }
 
@@ -150,19 +253,25 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 // @Param        id     path      int  true  "Product ID"
 // @Success      200    {object}  map[string]interface{}
 // @Failure      400    {object}  map[string]interface{}
-// @Failure      500    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
 // @Router       /admin/products/{id} [delete]
 func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondInvalidID(c, "product")
 		return
 	}
 
-	if err := h.Service.DeleteProduct(uint(id)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	before, _ := h.Service.GetProductByID(c.Request.Context(), uint(id))
+
+	if err := h.Service.DeleteProduct(c.Request.Context(), uint(id)); err != nil {
+		respondError(c, err)
 		return
 	}
 
+	if before != nil {
+		recordAudit(c, h.Audit, "product.delete", "product", before.ID, before, nil)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
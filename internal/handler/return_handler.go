@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+)
+
+var errNoPhotoUploaded = service.Validation("validation_failed", "No photo uploaded",
+	service.FieldError{Field: "photo", Code: "required", Message: "is required"})
+
+type ReturnHandler struct {
+	Service *service.ReturnService
+	// Media stores customers' photos; without it photos cannot be added
+	Media *service.CloudinaryService
+	Audit *service.AuditService
+}
+
+type CreateReturnInput struct {
+	Reason  string                  `json:"reason" binding:"required,oneof=corked broken wrong_item other" example:"corked"`
+	Details string                  `json:"details" binding:"max=2000" example:"Smells of wet cardboard"`
+	Items   []CreateReturnItemInput `json:"items" binding:"required,min=1,dive"`
+}
+
+type CreateReturnItemInput struct {
+	OrderItemID uint `json:"order_item_id" binding:"required"`
+	Quantity    int  `json:"quantity" binding:"required,min=1" example:"1"`
+}
+
+type ReturnDecisionInput struct {
+	Note string `json:"note" binding:"max=2000"`
+}
+
+type ReceiveReturnInput struct {
+	// Restock puts the returned bottles back into stock
+	Restock bool `json:"restock"`
+}
+
+type RefundReturnInput struct {
+	// Amount to refund; omit to refund the rest of the returned items' value
+	Amount float64 `json:"amount" binding:"min=0" example:"45.00"`
+	Reason string  `json:"reason" binding:"max=500"`
+}
+
+// CreateReturn godoc
+// @Summary      Request a return
+// @Description  Open a return for items of a paid order, e.g. corked or broken bottles. Each item can be returned up to the quantity bought.
+// @Tags         Returns
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                true  "Order ID"
+// @Param        input  body      CreateReturnInput  true  "Items and reason"
+// @Success      201    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /orders/{id}/returns [post]
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "order")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
+		return
+	}
+
+	var input CreateReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	request := service.ReturnInput{Reason: input.Reason, Details: input.Details}
+	for _, item := range input.Items {
+		request.Items = append(request.Items, service.ReturnItemInput{OrderItemID: item.OrderItemID, Quantity: item.Quantity})
+	}
+
+	created, err := h.Service.CreateReturn(c.Request.Context(), userID, uint(orderID), request)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Return requested", "data": created})
+}
+
+// GetMyReturns godoc
+// @Summary      List my returns
+// @Tags         Returns
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200    {object}  map[string]interface{}
+// @Failure      401    {object}  map[string]interface{}
+// @Router       /returns [get]
+func (h *ReturnHandler) GetMyReturns(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
+		return
+	}
+
+	returns, err := h.Service.GetUserReturns(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": returns})
+}
+
+// GetMyReturn godoc
+// @Summary      Get one of my returns
+// @Tags         Returns
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int  true  "Return ID"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /returns/{id} [get]
+func (h *ReturnHandler) GetMyReturn(c *gin.Context) {
+	returnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "return")
+		return
+	}
+
+	request, err := h.Service.GetUserReturn(c.Request.Context(), c.GetUint("user_id"), uint(returnID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// AddReturnPhoto godoc
+// @Summary      Add a photo to a return
+// @Description  Upload a photo of the returned bottles, up to 5 per return, while the return is requested or approved
+// @Tags         Returns
+// @Accept       multipart/form-data
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int   true  "Return ID"
+// @Param        photo  formData  file  true  "Photo"
+// @Success      201    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /returns/{id}/photos [post]
+func (h *ReturnHandler) AddReturnPhoto(c *gin.Context) {
+	returnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "return")
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	ctx := c.Request.Context()
+
+	// Check the return can take a photo before uploading it
+	request, err := h.Service.GetUserReturn(ctx, userID, uint(returnID))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if len(request.Photos) >= service.MaxReturnPhotos {
+		respondError(c, service.ErrTooManyReturnPhotos)
+		return
+	}
+
+	file, _, err := c.Request.FormFile("photo")
+	if err != nil {
+		respondError(c, errNoPhotoUploaded)
+		return
+	}
+	defer file.Close()
+
+	url, err := h.Media.UploadImage(ctx, file, "wine-shop/returns")
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	photo, err := h.Service.AddPhoto(ctx, userID, uint(returnID), url)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": photo})
+}
+
+// GetReturns godoc
+// @Summary      List returns (Admin)
+// @Tags         Returns
+// @Produce      json
+// @Security     BearerAuth
+// @Param        status  query     string  false  "requested, approved, rejected or received"
+// @Success      200     {object}  map[string]interface{}
+// @Router       /admin/returns [get]
+func (h *ReturnHandler) GetReturns(c *gin.Context) {
+	returns, err := h.Service.GetReturns(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": returns})
+}
+
+// ApproveReturn godoc
+// @Summary      Approve a return (Admin)
+// @Tags         Returns
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                  true   "Return ID"
+// @Param        input  body      ReturnDecisionInput  false  "Note for the customer"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /admin/returns/{id}/approve [post]
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	h.decide(c, "return.approve", h.Service.Approve)
+}
+
+// RejectReturn godoc
+// @Summary      Reject a return (Admin)
+// @Tags         Returns
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                  true   "Return ID"
+// @Param        input  body      ReturnDecisionInput  false  "Note for the customer"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /admin/returns/{id}/reject [post]
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	h.decide(c, "return.reject", h.Service.Reject)
+}
+
+func (h *ReturnHandler) decide(c *gin.Context, action string, decide func(ctx context.Context, returnID uint, note string) (*domain.ReturnRequest, error)) {
+	returnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "return")
+		return
+	}
+
+	var input ReturnDecisionInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	request, err := decide(c.Request.Context(), uint(returnID), input.Note)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, action, "return", request.ID, nil, gin.H{"status": request.Status, "note": input.Note})
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// ReceiveReturn godoc
+// @Summary      Record receipt of a return (Admin)
+// @Description  Mark an approved return as received, optionally putting the bottles back into stock
+// @Tags         Returns
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                 true   "Return ID"
+// @Param        input  body      ReceiveReturnInput  false  "Restock option"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /admin/returns/{id}/receive [post]
+func (h *ReturnHandler) ReceiveReturn(c *gin.Context) {
+	returnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "return")
+		return
+	}
+
+	var input ReceiveReturnInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	request, err := h.Service.Receive(c.Request.Context(), uint(returnID), input.Restock)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "return.receive", "return", request.ID, nil, gin.H{"status": request.Status, "restocked": request.Restocked})
+
+	c.JSON(http.StatusOK, gin.H{"data": request})
+}
+
+// RefundReturn godoc
+// @Summary      Refund a return (Admin)
+// @Description  Refund all or part of an approved or received return through the order's payment. The refund is recorded against the order and counted as negative revenue.
+// @Tags         Returns
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                true   "Return ID"
+// @Param        input  body      RefundReturnInput  false  "Amount and reason"
+// @Success      201    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Failure      502    {object}  map[string]interface{}
+// @Router       /admin/returns/{id}/refunds [post]
+func (h *ReturnHandler) RefundReturn(c *gin.Context) {
+	returnID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "return")
+		return
+	}
+
+	var input RefundReturnInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	refund, err := h.Service.Refund(c.Request.Context(), uint(returnID), input.Amount, input.Reason)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "return.refund", "return", uint(returnID), nil, refund)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Refund issued", "data": refund})
+}
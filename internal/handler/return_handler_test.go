@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCreateReturn_ValidatesInput(t *testing.T) {
+	tests := []struct {
+		body  string
+		field string
+	}{
+		{`{"reason":"changed_mind","items":[{"order_item_id":1,"quantity":1}]}`, "reason"},
+		{`{"reason":"corked","items":[]}`, "items"},
+		{`{"reason":"corked","items":[{"order_item_id":1,"quantity":0}]}`, "items[0].quantity"},
+		{`{"reason":"broken","items":[{"order_item_id":1,"quantity":1},{"quantity":1}]}`, "items[1].order_item_id"},
+	}
+
+	h := &ReturnHandler{}
+	for _, tt := range tests {
+		w, p := serveError(t, func(c *gin.Context) {
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+			c.Set("user_id", uint(7))
+			h.CreateReturn(c)
+		}, tt.body)
+		if w.Code != http.StatusBadRequest || len(p.Errors) != 1 || p.Errors[0].Field != tt.field {
+			t.Errorf("%s: expected 400 for %s, got %d %+v", tt.body, tt.field, w.Code, p.Errors)
+		}
+	}
+}
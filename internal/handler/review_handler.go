@@ -8,7 +8,6 @@ import (
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/internal/service"
-	"wine-shop-api/pkg/utils"
 )
 
 type ReviewHandler struct {
@@ -30,13 +29,13 @@ type ReviewHandler struct {
 func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	productID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondInvalidID(c, "product")
 		return
 	}
 
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
@@ -46,7 +45,7 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
 
@@ -57,9 +56,9 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 		Comment:   input.Comment,
 	}
 
-	createdReview, err := h.Service.CreateReview(review)
+	createdReview, err := h.Service.CreateReview(c.Request.Context(), review)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -78,17 +77,17 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 	productID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		respondInvalidID(c, "product")
 		return
 	}
 
-	reviews, err := h.Service.GetProductReviews(uint(productID))
+	reviews, err := h.Service.GetProductReviews(c.Request.Context(), uint(productID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	avgRating, count, _ := h.Service.GetProductAverageRating(uint(productID))
+	avgRating, count, _ := h.Service.GetProductAverageRating(c.Request.Context(), uint(productID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": reviews,
@@ -112,18 +111,18 @@ func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 	reviewID, err := strconv.Atoi(c.Param("reviewId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		respondInvalidID(c, "review")
 		return
 	}
 
-	userID, err := utils.ExtractTokenID(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
 		return
 	}
 
-	if err := h.Service.DeleteReview(uint(reviewID), userID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := h.Service.DeleteReview(c.Request.Context(), uint(reviewID), userID); err != nil {
+		respondError(c, err)
 		return
 	}
 
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/utils"
+)
+
+// startSession moves the access token into HttpOnly session cookies when
+// cookie session mode is enabled, so scripts never see it. The result then
+// carries the CSRF token instead.
+func startSession(c *gin.Context, sessions *utils.SessionCookieConfig, result *service.LoginResult) error {
+	if sessions == nil || !sessions.Enabled || result.Token == "" {
+		return nil
+	}
+	csrfToken, err := utils.SetSessionCookies(c, sessions, result.Token)
+	if err != nil {
+		return err
+	}
+	result.Token = ""
+	result.CSRFToken = csrfToken
+	return nil
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/postcode"
+)
+
+type ShippingHandler struct {
+	Service   *service.ShippingService
+	Cart      *service.CartService
+	Addresses *service.AddressService
+	Audit     *service.AuditService
+}
+
+// GetShippingOptions godoc
+// @Summary      Quote shipping for the cart
+// @Description  Price each shipping method that can take the cart to a destination, cheapest first. The destination is address_id, else country (with region and postcode), else the default shipping address.
+// @Tags         Cart
+// @Produce      json
+// @Security     BearerAuth
+// @Param        address_id  query     int     false  "Address book entry"
+// @Param        country     query     string  false  "ISO 3166-1 alpha-2 country"
+// @Param        region      query     string  false  "State, province or county"
+// @Param        postcode    query     string  false  "Postcode"
+// @Success      200         {object}  map[string]interface{}
+// @Failure      400         {object}  map[string]interface{}
+// @Router       /cart/shipping-options [get]
+func (h *ShippingHandler) GetShippingOptions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	if userID == 0 {
+		respondUnauthorized(c)
+		return
+	}
+	ctx := c.Request.Context()
+
+	var dest domain.PostalAddress
+	switch {
+	case c.Query("address_id") != "":
+		id, err := strconv.Atoi(c.Query("address_id"))
+		if err != nil {
+			respondInvalidID(c, "address")
+			return
+		}
+		address, err := h.Addresses.GetAddress(ctx, userID, uint(id))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		dest = address.PostalAddress
+	case c.Query("country") != "":
+		dest = domain.PostalAddress{
+			Country:  c.Query("country"),
+			Region:   c.Query("region"),
+			Postcode: postcode.Normalize(c.Query("country"), c.Query("postcode")),
+		}
+	default:
+		var err error
+		if dest, _, err = h.Addresses.CheckoutAddresses(ctx, userID, 0, 0); err != nil {
+			respondError(c, err)
+			return
+		}
+	}
+
+	cart, err := h.Cart.GetCart(ctx, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if len(cart.Items) == 0 {
+		respondError(c, service.ErrCartEmpty)
+		return
+	}
+
+	options, err := h.Service.Quote(ctx, dest, service.NewShipment(cart.Items))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": options})
+}
+
+// GetShippingZones godoc
+// @Summary      List shipping zones (Admin)
+// @Tags         Shipping
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200    {object}  map[string]interface{}
+// @Router       /admin/shipping/zones [get]
+func (h *ShippingHandler) GetShippingZones(c *gin.Context) {
+	zones, err := h.Service.GetZones(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": zones})
+}
+
+// CreateShippingZone godoc
+// @Summary      Create a shipping zone (Admin)
+// @Description  A zone covers its countries, narrowed to regions and postcode ranges when given. Destinations use the most specific matching zone.
+// @Tags         Shipping
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input  body      domain.ShippingZone  true  "Zone"
+// @Success      201    {object}  domain.ShippingZone
+// @Failure      400    {object}  map[string]interface{}
+// @Router       /admin/shipping/zones [post]
+func (h *ShippingHandler) CreateShippingZone(c *gin.Context) {
+	var zone domain.ShippingZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	created, err := h.Service.CreateZone(c.Request.Context(), &zone)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "shipping_zone.create", "shipping_zone", created.ID, nil, created)
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// UpdateShippingZone godoc
+// @Summary      Replace a shipping zone (Admin)
+// @Tags         Shipping
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                  true  "Zone ID"
+// @Param        input  body      domain.ShippingZone  true  "Zone"
+// @Success      200    {object}  domain.ShippingZone
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /admin/shipping/zones/{id} [put]
+func (h *ShippingHandler) UpdateShippingZone(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "shipping zone")
+		return
+	}
+
+	var zone domain.ShippingZone
+	if err := c.ShouldBindJSON(&zone); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	before, err := h.Service.GetZone(c.Request.Context(), uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	updated, err := h.Service.UpdateZone(c.Request.Context(), uint(id), &zone)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "shipping_zone.update", "shipping_zone", updated.ID, before, updated)
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// DeleteShippingZone godoc
+// @Summary      Delete a shipping zone and its methods (Admin)
+// @Tags         Shipping
+// @Security     BearerAuth
+// @Param        id     path      int  true  "Zone ID"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /admin/shipping/zones/{id} [delete]
+func (h *ShippingHandler) DeleteShippingZone(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "shipping zone")
+		return
+	}
+
+	before, _ := h.Service.GetZone(c.Request.Context(), uint(id))
+
+	if err := h.Service.DeleteZone(c.Request.Context(), uint(id)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if before != nil {
+		recordAudit(c, h.Audit, "shipping_zone.delete", "shipping_zone", before.ID, before, nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping zone deleted"})
+}
+
+// CreateShippingMethod godoc
+// @Summary      Add a shipping method to a zone (Admin)
+// @Description  code is standard, express or chilled. Rates are tiers by bottles or kilograms (rate_basis); the smallest tier that fits the shipment applies, and free_over waives it for larger subtotals.
+// @Tags         Shipping
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                    true  "Zone ID"
+// @Param        input  body      domain.ShippingMethod  true  "Method"
+// @Success      201    {object}  domain.ShippingMethod
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /admin/shipping/zones/{id}/methods [post]
+func (h *ShippingHandler) CreateShippingMethod(c *gin.Context) {
+	zoneID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "shipping zone")
+		return
+	}
+
+	var method domain.ShippingMethod
+	if err := c.ShouldBindJSON(&method); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	created, err := h.Service.CreateMethod(c.Request.Context(), uint(zoneID), &method)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "shipping_method.create", "shipping_method", created.ID, nil, created)
+
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// UpdateShippingMethod godoc
+// @Summary      Replace a shipping method (Admin)
+// @Tags         Shipping
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id     path      int                    true  "Method ID"
+// @Param        input  body      domain.ShippingMethod  true  "Method"
+// @Success      200    {object}  domain.ShippingMethod
+// @Failure      400    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Failure      409    {object}  map[string]interface{}
+// @Router       /admin/shipping/methods/{id} [put]
+func (h *ShippingHandler) UpdateShippingMethod(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "shipping method")
+		return
+	}
+
+	var method domain.ShippingMethod
+	if err := c.ShouldBindJSON(&method); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	before, err := h.Service.GetMethod(c.Request.Context(), uint(id))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	updated, err := h.Service.UpdateMethod(c.Request.Context(), uint(id), &method)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	recordAudit(c, h.Audit, "shipping_method.update", "shipping_method", updated.ID, before, updated)
+
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// DeleteShippingMethod godoc
+// @Summary      Delete a shipping method (Admin)
+// @Tags         Shipping
+// @Security     BearerAuth
+// @Param        id     path      int  true  "Method ID"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      404    {object}  map[string]interface{}
+// @Router       /admin/shipping/methods/{id} [delete]
+func (h *ShippingHandler) DeleteShippingMethod(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respondInvalidID(c, "shipping method")
+		return
+	}
+
+	before, _ := h.Service.GetMethod(c.Request.Context(), uint(id))
+
+	if err := h.Service.DeleteMethod(c.Request.Context(), uint(id)); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if before != nil {
+		recordAudit(c, h.Audit, "shipping_method.delete", "shipping_method", before.ID, before, nil)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping method deleted"})
+}
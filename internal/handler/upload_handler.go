@@ -8,8 +8,12 @@ import (
 	"wine-shop-api/internal/service"
 )
 
+var errNoFileUploaded = service.Validation("validation_failed", "No file uploaded",
+	service.FieldError{Field: "file", Code: "required", Message: "is required"})
+
 type UploadHandler struct {
 	CloudinaryService *service.CloudinaryService
+	Audit             *service.AuditService
 }
 
 // UploadImage godoc
@@ -26,18 +30,20 @@ type UploadHandler struct {
 func (h *UploadHandler) UploadImage(c *gin.Context) {
 	file, _, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		respondError(c, errNoFileUploaded)
 		return
 	}
 	defer file.Close()
 
 	// Upload to Cloudinary
-	url, err := h.CloudinaryService.UploadImage(file, "wine-shop/products")
+	url, err := h.CloudinaryService.UploadImage(c.Request.Context(), file, "wine-shop/products")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image: " + err.Error()})
+		respondError(c, err)
 		return
 	}
 
+	recordAudit(c, h.Audit, "media.upload", "media", 0, nil, gin.H{"url": url})
+
 	c.JSON(http.StatusOK, gin.H{
 		"url":     url,
 		"message": "Image uploaded successfully",
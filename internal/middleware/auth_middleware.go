@@ -2,63 +2,199 @@ package middleware
 
 import (
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/problem"
 	"wine-shop-api/pkg/utils"
 )
 
-func JwtAuthMiddleware() gin.HandlerFunc {
+// Authenticator resolves the caller from a JWT bearer token or an API key
+type Authenticator struct {
+	APIKeys *service.APIKeyService
+	// Scopes maps "METHOD /route/pattern" to the scope an API key needs.
+	// Routes that are not listed cannot be called with an API key.
+	Scopes map[string]string
+	// RateLimits holds the per-key buckets; defaults to an in-memory store
+	RateLimits RateLimitStore
+	// SignedURLRoutes lists the "METHOD /route/pattern" entries that also
+	// accept a signed download token in the ?token= query parameter
+	SignedURLRoutes map[string]bool
+
+	once sync.Once
+}
+
+func JwtAuthMiddleware(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := utils.ValidateToken(c)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+		userID, ok := auth.authenticate(c)
+		if !ok {
 			return
 		}
 		// Set user_id in context for use in handlers
-		userID, _ := utils.ExtractTokenID(c)
 		c.Set("user_id", userID)
 		c.Next()
 	}
 }
 
 // AdminMiddleware checks if the authenticated user has admin role
-func AdminMiddleware() gin.HandlerFunc {
+func AdminMiddleware(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// First validate the token
-		err := utils.ValidateToken(c)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
-			return
-		}
-
-		// Get user ID from token
-		userID, err := utils.ExtractTokenID(c)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			c.Abort()
+		// First authenticate the token or API key
+		userID, ok := auth.authenticate(c)
+		if !ok {
 			return
 		}
 
 		// Get user from database to check role
 		var user domain.User
 		if err := config.DB.First(&user, userID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
+			problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "User not found")
 			return
 		}
 
 		// Check if user is admin
-		if user.Role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
+		if !user.IsAdmin() {
+			problem.Error(c, http.StatusForbidden, "admin_required", "Admin access required")
 			return
 		}
 
+		c.Set("user_id", userID)
+		c.Set("user", &user)
 		c.Next()
 	}
 }
+
+// RequireAdminMFAMiddleware blocks admins who have not enrolled in two-factor
+// authentication. It must run after AdminMiddleware. API keys are exempt as
+// they are issued by an admin and limited by scope.
+func RequireAdminMFAMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isAPIKey := c.Get("api_key"); isAPIKey {
+			c.Next()
+			return
+		}
+
+		value, exists := c.Get("user")
+		user, ok := value.(*domain.User)
+		if !exists || !ok {
+			problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		if user.IsAdmin() && !user.MFAEnabled {
+			problem.Error(c, http.StatusForbidden, "mfa_required", "Two-factor authentication is required for admin accounts. Enrol via /api/me/mfa/enroll")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// authenticate returns the caller's user ID. On failure it writes the error
+// response, aborts the request and returns false.
+func (a *Authenticator) authenticate(c *gin.Context) (uint, bool) {
+	credential := c.GetHeader("X-API-Key")
+	if credential == "" {
+		credential = utils.ExtractToken(c)
+	}
+
+	if a != nil && a.APIKeys != nil && service.IsAPIKey(credential) {
+		return a.authenticateAPIKey(c, credential)
+	}
+
+	if token := c.Query("token"); token != "" && a != nil && a.SignedURLRoutes[c.Request.Method+" "+c.FullPath()] {
+		userID, err := utils.ParseDownloadToken(token, c.Request.URL.Path, c.Request.URL.Query())
+		if err != nil {
+			problem.Error(c, http.StatusUnauthorized, "invalid_download_token", "Download link is invalid or has expired")
+			return 0, false
+		}
+		return userID, true
+	}
+
+	userID, err := utils.ExtractTokenID(c)
+	if err != nil {
+		problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return 0, false
+	}
+
+	if !checkCSRF(c) {
+		return 0, false
+	}
+	return userID, true
+}
+
+// CSRFMiddleware applies the cookie session CSRF check to routes that do
+// not authenticate, such as logout
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkCSRF(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkCSRF rejects mutating cookie session requests without a matching
+// CSRF token. Browsers attach the session cookie to cross-site requests,
+// so they must prove they can read the token.
+func checkCSRF(c *gin.Context) bool {
+	if utils.IsCookieSession(c) && !isSafeMethod(c.Request.Method) && !utils.ValidCSRF(c) {
+		problem.Error(c, http.StatusForbidden, "invalid_csrf_token", "Missing or invalid CSRF token")
+		return false
+	}
+	return true
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func (a *Authenticator) authenticateAPIKey(c *gin.Context, credential string) (uint, bool) {
+	key, err := a.APIKeys.Authenticate(c.Request.Context(), credential, c.ClientIP())
+	if err != nil {
+		problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return 0, false
+	}
+
+	scope, allowed := a.Scopes[c.Request.Method+" "+c.FullPath()]
+	if !allowed || !key.HasScope(scope) {
+		problem.Write(c, problem.Problem{
+			Status:     http.StatusForbidden,
+			Code:       "insufficient_scope",
+			Detail:     "API key does not have the required scope",
+			Extensions: map[string]any{"required_scope": scope},
+		})
+		return 0, false
+	}
+
+	limit := key.RateLimit
+	if limit <= 0 {
+		limit = service.DefaultAPIKeyRateLimit
+	}
+	limiter := &RateLimiter{name: "api_key", limit: limit, window: time.Minute, store: a.rateLimitStore()}
+	result := limiter.take(c.Request.Context(), strconv.FormatUint(uint64(key.ID), 10))
+	setRateLimitHeaders(c, result, time.Minute)
+	if !result.Allowed {
+		problem.Error(c, http.StatusTooManyRequests, problem.CodeRateLimited, "API key rate limit exceeded. Please try again later.")
+		return 0, false
+	}
+
+	c.Set("api_key", key)
+	return key.UserID, true
+}
+
+// rateLimitStore returns the per-key store, creating an in-memory one on first use
+func (a *Authenticator) rateLimitStore() RateLimitStore {
+	a.once.Do(func() {
+		if a.RateLimits == nil {
+			a.RateLimits = NewMemoryStore()
+		}
+	})
+	return a.RateLimits
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/pkg/utils"
+)
+
+func TestJwtAuthMiddleware_Credentials(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	utils.ConfigureTokens("testsecret123", time.Hour)
+	token, _ := utils.GenerateToken(7)
+
+	r := gin.New()
+	r.Use(JwtAuthMiddleware(&Authenticator{}))
+	r.GET("/api/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/api/cart", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		setup  func(req *http.Request)
+		want   int
+	}{
+		{"bearer token", http.MethodPost, "/api/cart", func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}, http.StatusOK},
+		{"query string token", http.MethodGet, "/api/me?token=" + token, func(*http.Request) {}, http.StatusUnauthorized},
+		{"cookie session read", http.MethodGet, "/api/me", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+		}, http.StatusOK},
+		{"cookie session write without CSRF", http.MethodPost, "/api/cart", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+		}, http.StatusForbidden},
+		{"cookie session write with CSRF", http.MethodPost, "/api/cart", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+			req.AddCookie(&http.Cookie{Name: utils.CSRFCookieName, Value: "csrf"})
+			req.Header.Set(utils.CSRFHeaderName, "csrf")
+		}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		tt.setup(req)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestCSRFMiddleware_Logout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	utils.ConfigureTokens("testsecret123", time.Hour)
+	token, _ := utils.GenerateToken(7)
+
+	r := gin.New()
+	r.POST("/api/logout", CSRFMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name  string
+		setup func(req *http.Request)
+		want  int
+	}{
+		{"bearer client", func(*http.Request) {}, http.StatusOK},
+		{"cookie session without CSRF", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+		}, http.StatusForbidden},
+		{"cookie session with mismatched CSRF", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+			req.AddCookie(&http.Cookie{Name: utils.CSRFCookieName, Value: "csrf"})
+			req.Header.Set(utils.CSRFHeaderName, "other")
+		}, http.StatusForbidden},
+		{"cookie session with CSRF", func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: token})
+			req.AddCookie(&http.Cookie{Name: utils.CSRFCookieName, Value: "csrf"})
+			req.Header.Set(utils.CSRFHeaderName, "csrf")
+		}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/logout", nil)
+		tt.setup(req)
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
+
+func TestJwtAuthMiddleware_SignedURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	utils.ConfigureTokens("testsecret123", time.Hour)
+
+	auth := &Authenticator{SignedURLRoutes: map[string]bool{"GET /api/export": true}}
+	r := gin.New()
+	r.Use(JwtAuthMiddleware(auth))
+	r.GET("/api/export", func(c *gin.Context) { c.String(http.StatusOK, "%d", c.GetUint("user_id")) })
+	r.GET("/api/other", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	token, _, _ := utils.GenerateDownloadToken(9, "/api/export", url.Values{"from": {"2026-01-01"}})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export?from=2026-01-01&token="+token, nil))
+	if w.Code != http.StatusOK || w.Body.String() != "9" {
+		t.Errorf("Expected the signed link to authenticate user 9, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/export?from=2000-01-01&token="+token, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Signed links should not work with other parameters, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/other?token="+token, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Signed links should only work on opted-in routes, got %d", w.Code)
+	}
+}
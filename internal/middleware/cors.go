@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/pkg/utils"
+)
+
+// OriginAllowlist matches browser origins against exact origins such as
+// https://shop.example.com and wildcard origins such as
+// https://wine-shop-*.vercel.app. A * only matches within the leftmost DNS
+// label, so it can never span a dot and match another site.
+type OriginAllowlist struct {
+	patterns []originPattern
+}
+
+type originPattern struct {
+	scheme string
+	host   string // lower case; the first label may contain one *
+	port   string
+}
+
+// NewOriginAllowlist validates origins. Wildcards must leave at least two
+// fixed labels, so https://*.app or a bare * is rejected.
+func NewOriginAllowlist(origins []string) (*OriginAllowlist, error) {
+	allowlist := &OriginAllowlist{}
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, err
+		}
+		allowlist.patterns = append(allowlist.patterns, pattern)
+	}
+	if len(allowlist.patterns) == 0 {
+		return nil, errors.New("no CORS origins configured")
+	}
+	return allowlist, nil
+}
+
+func parseOriginPattern(origin string) (originPattern, error) {
+	// Swap the wildcard out so url.Parse accepts the host
+	const placeholder = "0wildcard0"
+	u, err := url.Parse(strings.Replace(origin, "*", placeholder, 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return originPattern{}, fmt.Errorf("invalid CORS origin %q: must be scheme://host[:port]", origin)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if strings.Contains(origin, "*") {
+		star := strings.Index(host, placeholder)
+		if strings.Count(origin, "*") > 1 || star < 0 || star > strings.Index(host, ".") || strings.Count(host, ".") < 2 {
+			return originPattern{}, fmt.Errorf("invalid CORS origin %q: * is only allowed in the first label of a subdomain", origin)
+		}
+		host = strings.Replace(host, placeholder, "*", 1)
+	}
+	return originPattern{scheme: u.Scheme, host: host, port: u.Port()}, nil
+}
+
+// Allowed reports whether origin may make credentialed cross-origin requests
+func (a *OriginAllowlist) Allowed(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" || u.Path != "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range a.patterns {
+		if pattern.scheme == u.Scheme && pattern.port == u.Port() && matchOriginHost(pattern.host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOriginHost(pattern, host string) bool {
+	star := strings.Index(pattern, "*")
+	if star < 0 {
+		return pattern == host
+	}
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	if len(host) <= len(prefix)+len(suffix) || !strings.HasPrefix(host, prefix) || !strings.HasSuffix(host, suffix) {
+		return false
+	}
+	// The wildcard covers a non-empty part of a single label
+	for _, r := range host[len(prefix) : len(host)-len(suffix)] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// CORSMiddleware allows credentialed requests from the allowlisted origins only
+func CORSMiddleware(origins *OriginAllowlist) gin.HandlerFunc {
+	return cors.New(cors.Config{
+		AllowOriginFunc:  origins.Allowed,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", utils.CSRFHeaderName, RequestIDHeader, IdempotencyKeyHeader, "If-Match", "traceparent", "tracestate"},
+		ExposeHeaders:    []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", RequestIDHeader, IdempotentReplayedHeader, "ETag"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	})
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOriginAllowlist_Allowed(t *testing.T) {
+	allowlist, err := NewOriginAllowlist([]string{
+		"http://localhost:5173",
+		"https://wine-shop-api-l1i5.vercel.app",
+		"https://wine-shop-api-*.vercel.app",
+		"https://*.example.com",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse allowlist: %v", err)
+	}
+
+	tests := map[string]bool{
+		"http://localhost:5173":                     true,
+		"http://localhost:3000":                     false,
+		"https://localhost:5173":                    false,
+		"https://wine-shop-api-l1i5.vercel.app":     true,
+		"https://wine-shop-api-git-main.vercel.app": true,
+		"https://wine-shop-api-.vercel.app":         false,
+		"https://evil.vercel.app":                   false,
+		"https://wine-shop-api-x.evil.vercel.app":   false,
+		"https://shop.example.com":                  true,
+		"https://SHOP.example.com":                  true,
+		"https://a.b.example.com":                   false,
+		"https://example.com":                       false,
+		"https://shop.example.com.evil.com":         false,
+		"https://shop.example.com:8443":             false,
+		"null":                                      false,
+		"":                                          false,
+	}
+	for origin, want := range tests {
+		if got := allowlist.Allowed(origin); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", origin, got, want)
+		}
+	}
+}
+
+func TestNewOriginAllowlist_Invalid(t *testing.T) {
+	for _, origin := range []string{
+		"*",
+		"https://*",
+		"https://*.app",
+		"https://shop.*.com",
+		"https://*.*.example.com",
+		"ftp://example.com",
+		"https://example.com/path",
+		"example.com",
+	} {
+		if _, err := NewOriginAllowlist([]string{origin}); err == nil {
+			t.Errorf("Origin %q should be rejected", origin)
+		}
+	}
+
+	if _, err := NewOriginAllowlist([]string{" ", ""}); err == nil {
+		t.Error("An empty allowlist should be rejected")
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allowlist, _ := NewOriginAllowlist([]string{"https://shop.example.com"})
+
+	r := gin.New()
+	r.Use(CORSMiddleware(allowlist))
+	r.GET("/api/products", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	request := func(origin string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+		req.Header.Set("Origin", origin)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("https://shop.example.com")
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.com" {
+		t.Errorf("Expected allowed origin to be echoed, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Expected credentials to be allowed for an allowlisted origin")
+	}
+
+	w = request("https://evil.com")
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected unknown origin to be refused, got %d %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
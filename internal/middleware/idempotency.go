@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/problem"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses served from the idempotency store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// replayedHeaders are the response headers stored with an idempotent
+// response. Per-request headers such as X-Request-ID are not replayed.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// IdempotentResponse is a stored response to replay on retries
+type IdempotentResponse struct {
+	Status int
+	Header map[string]string
+	Body   []byte
+}
+
+// IdempotencyRecord is the state of a key that was already used. Response is
+// nil while the first request is still being processed.
+type IdempotencyRecord struct {
+	Fingerprint string
+	Response    *IdempotentResponse
+}
+
+// IdempotencyStore keeps idempotency keys per user. Close stops any
+// background cleanup and is called once during graceful shutdown.
+type IdempotencyStore interface {
+	// Acquire claims the key for a new request and returns nil, or returns
+	// the existing record when the key is already in use
+	Acquire(ctx context.Context, userID uint, key, fingerprint string) (*IdempotencyRecord, error)
+	// Complete stores the response for the request that acquired the key
+	Complete(ctx context.Context, userID uint, key, fingerprint string, response IdempotentResponse) error
+	// Release frees the key so the request can be retried
+	Release(ctx context.Context, userID uint, key, fingerprint string) error
+	Close()
+}
+
+// IdempotencyMiddleware makes mutating requests that carry an Idempotency-Key
+// safe to retry. The first request with a key runs normally and its response
+// is stored; retries with the same payload replay that response, retries
+// while it is still running get 409 and reuse of the key for a different
+// payload gets 422. Server errors release the key so the client can retry.
+// It must run after authentication, as keys are scoped to the user.
+//
+// The body is part of the fingerprint, so it is read into memory up to
+// maxBodyBytes; larger bodies get 413. Multipart uploads are not buffered
+// and are fingerprinted by method and URL only.
+func IdempotencyMiddleware(store IdempotencyStore, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		userID := c.GetUint("user_id")
+		if key == "" || userID == 0 || isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if !validIdempotencyKey(key) {
+			problem.Error(c, http.StatusBadRequest, "invalid_idempotency_key",
+				"Idempotency-Key must be 1 to 255 printable ASCII characters")
+			return
+		}
+
+		var body []byte
+		if !strings.HasPrefix(c.ContentType(), "multipart/") {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					problem.Error(c, http.StatusRequestEntityTooLarge, "request_too_large",
+						fmt.Sprintf("Requests with an Idempotency-Key must not exceed %d bytes", maxBodyBytes))
+					return
+				}
+				problem.Error(c, http.StatusBadRequest, problem.CodeMalformedBody, "Request body could not be read")
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		fingerprint := requestFingerprint(c.Request, body)
+
+		ctx := c.Request.Context()
+		existing, err := store.Acquire(ctx, userID, key, fingerprint)
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "idempotency store error", "error", err)
+			problem.Error(c, http.StatusServiceUnavailable, "idempotency_unavailable",
+				"The Idempotency-Key could not be checked, please retry")
+			return
+		}
+		if existing != nil {
+			respondExisting(c, existing, fingerprint)
+			return
+		}
+
+		// Store the outcome even if the client has already gone away
+		storeCtx := context.WithoutCancel(ctx)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				_ = store.Release(storeCtx, userID, key, fingerprint)
+				panic(recovered)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			err = store.Release(storeCtx, userID, key, fingerprint)
+		} else {
+			response := IdempotentResponse{Status: status, Header: map[string]string{}, Body: recorder.body.Bytes()}
+			for _, name := range replayedHeaders {
+				if value := c.Writer.Header().Get(name); value != "" {
+					response.Header[name] = value
+				}
+			}
+			err = store.Complete(storeCtx, userID, key, fingerprint, response)
+		}
+		if err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to save idempotent response", "error", err)
+		}
+	}
+}
+
+func respondExisting(c *gin.Context, existing *IdempotencyRecord, fingerprint string) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		problem.Error(c, http.StatusUnprocessableEntity, "idempotency_key_reused",
+			"This Idempotency-Key was already used for a different request")
+	case existing.Response == nil:
+		problem.Error(c, http.StatusConflict, "idempotency_request_in_progress",
+			"A request with this Idempotency-Key is still being processed")
+	default:
+		for name, value := range existing.Response.Header {
+			c.Header(name, value)
+		}
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(existing.Response.Status, existing.Response.Header["Content-Type"], existing.Response.Body)
+		c.Abort()
+	}
+}
+
+// requestFingerprint identifies the request a key was first used for
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// idempotencyKey is the row used by PostgresIdempotencyStore. Status is zero
+// while the first request is in progress.
+type idempotencyKey struct {
+	UserID      uint      `gorm:"primaryKey;autoIncrement:false"`
+	Key         string    `gorm:"primaryKey;size:255"`
+	Fingerprint string    `gorm:"size:64;not null"`
+	Status      int       `gorm:"not null;default:0"`
+	Header      []byte    `gorm:"type:jsonb"`
+	Body        []byte    `gorm:"type:bytea"`
+	LockedAt    time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"index;not null"`
+}
+
+func (idempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
+
+// PostgresIdempotencyStore keeps idempotency keys in Postgres so retries are
+// recognised on any replica
+type PostgresIdempotencyStore struct {
+	db          *gorm.DB
+	ttl         time.Duration
+	lockTimeout time.Duration
+	now         func() time.Time
+	stop        chan struct{}
+	once        sync.Once
+}
+
+// acquireSQL inserts the key, or takes over a row that has expired or whose
+// request was abandoned mid-flight. It affects no rows when the key is in use.
+const acquireSQL = `
+INSERT INTO idempotency_keys AS k (user_id, key, fingerprint, status, header, body, locked_at, expires_at)
+VALUES (@user_id, @key, @fingerprint, 0, NULL, NULL, @now, @expires_at)
+ON CONFLICT (user_id, key) DO UPDATE SET
+	fingerprint = EXCLUDED.fingerprint,
+	status = 0,
+	header = NULL,
+	body = NULL,
+	locked_at = EXCLUDED.locked_at,
+	expires_at = EXCLUDED.expires_at
+WHERE k.expires_at <= @now
+	OR (k.status = 0 AND k.locked_at <= @stale_before AND k.fingerprint = EXCLUDED.fingerprint)`
+
+// NewPostgresIdempotencyStore creates the key table if needed and starts a
+// goroutine that removes expired keys
+func NewPostgresIdempotencyStore(db *gorm.DB, ttl, lockTimeout time.Duration) (*PostgresIdempotencyStore, error) {
+	if err := db.AutoMigrate(&idempotencyKey{}); err != nil {
+		return nil, err
+	}
+	s := &PostgresIdempotencyStore{db: db, ttl: ttl, lockTimeout: lockTimeout, now: time.Now, stop: make(chan struct{})}
+	go s.cleanup()
+	return s, nil
+}
+
+func (s *PostgresIdempotencyStore) Acquire(ctx context.Context, userID uint, key, fingerprint string) (*IdempotencyRecord, error) {
+	// The existing row can expire or be released between the insert and the
+	// read, in which case the insert is simply tried again
+	for attempt := 0; attempt < 3; attempt++ {
+		now := s.now()
+		result := s.db.WithContext(ctx).Exec(acquireSQL, map[string]interface{}{
+			"user_id":      userID,
+			"key":          key,
+			"fingerprint":  fingerprint,
+			"now":          now,
+			"expires_at":   now.Add(s.ttl),
+			"stale_before": now.Add(-s.lockTimeout),
+		})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil, nil
+		}
+
+		var row idempotencyKey
+		err := s.db.WithContext(ctx).Where("user_id = ? AND key = ?", userID, key).First(&row).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record := &IdempotencyRecord{Fingerprint: row.Fingerprint}
+		if row.Status != 0 {
+			record.Response = &IdempotentResponse{Status: row.Status, Body: row.Body}
+			if err := json.Unmarshal(row.Header, &record.Response.Header); err != nil {
+				return nil, err
+			}
+		}
+		return record, nil
+	}
+	return nil, errors.New("idempotency key is contended")
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, userID uint, key, fingerprint string, response IdempotentResponse) error {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&idempotencyKey{}).
+		Where("user_id = ? AND key = ? AND fingerprint = ? AND status = 0", userID, key, fingerprint).
+		Updates(map[string]interface{}{"status": response.Status, "header": header, "body": response.Body}).Error
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, userID uint, key, fingerprint string) error {
+	return s.db.WithContext(ctx).
+		Where("user_id = ? AND key = ? AND fingerprint = ? AND status = 0", userID, key, fingerprint).
+		Delete(&idempotencyKey{}).Error
+}
+
+// Close stops the cleanup goroutine
+func (s *PostgresIdempotencyStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// cleanup deletes expired keys
+func (s *PostgresIdempotencyStore) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.db.Where("expires_at <= ?", s.now()).Delete(&idempotencyKey{}).Error; err != nil {
+				slog.Error("idempotency key cleanup failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotencyStore is an in-memory IdempotencyStore for tests
+type memoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*IdempotencyRecord
+}
+
+func newMemoryIdempotencyStore() *memoryIdempotencyStore {
+	return &memoryIdempotencyStore{records: map[string]*IdempotencyRecord{}}
+}
+
+func (s *memoryIdempotencyStore) id(userID uint, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func (s *memoryIdempotencyStore) Acquire(_ context.Context, userID uint, key, fingerprint string) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.records[s.id(userID, key)]; ok {
+		clone := *record
+		return &clone, nil
+	}
+	s.records[s.id(userID, key)] = &IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, userID uint, key, _ string, response IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[s.id(userID, key)].Response = &response
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, userID uint, key, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, s.id(userID, key))
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Close() {}
+
+func idempotencyRouter(store IdempotencyStore, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", uint(7))
+		c.Next()
+	})
+	r.Use(IdempotencyMiddleware(store, 64))
+	r.POST("/orders", handler)
+	return r
+}
+
+func postOrder(r http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware_ReplaysResponse(t *testing.T) {
+	var calls atomic.Int32
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		n := calls.Add(1)
+		c.Header("Location", "/api/orders/1")
+		c.Header("X-Request-ID", "first")
+		c.JSON(http.StatusCreated, gin.H{"order": n})
+	})
+
+	first := postOrder(r, "checkout-1", `{"shipping_country":"FR"}`)
+	retry := postOrder(r, "checkout-1", `{"shipping_country":"FR"}`)
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", calls.Load())
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() {
+		t.Errorf("Expected the retry to replay %d %s, got %d %s", first.Code, first.Body, retry.Code, retry.Body)
+	}
+	if retry.Header().Get(IdempotentReplayedHeader) != "true" || retry.Header().Get("Location") != "/api/orders/1" {
+		t.Errorf("Expected replay headers, got %v", retry.Header())
+	}
+	if retry.Header().Get("X-Request-ID") != "" {
+		t.Error("Expected per-request headers not to be replayed")
+	}
+	if first.Header().Get(IdempotentReplayedHeader) != "" {
+		t.Error("Expected the original response not to be marked as replayed")
+	}
+
+	// Without a key every request runs
+	postOrder(r, "", `{}`)
+	postOrder(r, "", `{}`)
+	if calls.Load() != 3 {
+		t.Errorf("Expected requests without a key to always run, ran %d times", calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_RejectsDifferentPayload(t *testing.T) {
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	postOrder(r, "checkout-1", `{"shipping_country":"FR"}`)
+	w := postOrder(r, "checkout-1", `{"shipping_country":"US"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Errorf("Expected 422 idempotency_key_reused, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestIdempotencyMiddleware_ConcurrentDuplicate(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postOrder(r, "checkout-1", `{}`) }()
+	<-started
+
+	w := postOrder(r, "checkout-1", `{}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "idempotency_request_in_progress") {
+		t.Errorf("Expected 409 while the first request runs, got %d %s", w.Code, w.Body)
+	}
+
+	close(release)
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Errorf("Expected the first request to succeed, got %d", first.Code)
+	}
+}
+
+func TestIdempotencyMiddleware_ServerErrorReleasesKey(t *testing.T) {
+	var calls atomic.Int32
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		if calls.Add(1) == 1 {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	postOrder(r, "checkout-1", `{}`)
+	if w := postOrder(r, "checkout-1", `{}`); w.Code != http.StatusCreated || calls.Load() != 2 {
+		t.Errorf("Expected a retry after a server error to run again, got %d after %d calls", w.Code, calls.Load())
+	}
+}
+
+func TestIdempotencyMiddleware_InvalidKey(t *testing.T) {
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		t.Error("Expected the handler not to run")
+	})
+
+	for _, key := range []string{strings.Repeat("k", 256), "café"} {
+		if w := postOrder(r, key, `{}`); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400 for key %q, got %d", key, w.Code)
+		}
+	}
+}
+
+func TestIdempotencyMiddleware_LimitsBufferedBody(t *testing.T) {
+	var calls atomic.Int32
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		calls.Add(1)
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	w := postOrder(r, "checkout-1", strings.Repeat("x", 65))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "request_too_large") {
+		t.Errorf("Expected 413 request_too_large, got %d %s", w.Code, w.Body)
+	}
+	if calls.Load() != 0 {
+		t.Error("Expected the handler not to run for an oversized body")
+	}
+
+	// Without a key the body is left to the handler
+	if w := postOrder(r, "", strings.Repeat("x", 65)); w.Code != http.StatusCreated {
+		t.Errorf("Expected a request without a key to run, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyMiddleware_StreamsMultipartBody(t *testing.T) {
+	var received []int
+	r := idempotencyRouter(newMemoryIdempotencyStore(), func(c *gin.Context) {
+		file, _, err := c.Request.FormFile("photo")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{})
+			return
+		}
+		data, _ := io.ReadAll(file)
+		received = append(received, len(data))
+		c.JSON(http.StatusCreated, gin.H{})
+	})
+
+	upload := func() *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("photo", "bottle.jpg")
+		part.Write(bytes.Repeat([]byte{0xff}, 1000))
+		form.Close()
+		req := httptest.NewRequest("POST", "/orders", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set(IdempotencyKeyHeader, "upload-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := upload()
+	retry := upload()
+	if first.Code != http.StatusCreated || len(received) != 1 || received[0] != 1000 {
+		t.Fatalf("Expected the upload over the body limit to reach the handler, got %d %v", first.Code, received)
+	}
+	if retry.Code != http.StatusCreated || retry.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("Expected the retried upload to be replayed, got %d %v", retry.Code, retry.Header())
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/problem"
+)
+
+// MetricsMiddleware records request latency by route template rather than
+// raw path, so /products/1 and /products/2 share one series. Requests that
+// match no route are grouped under "unmatched".
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.
+			WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsHandler serves the metrics registry. When token is set, scrapers
+// must send it as a bearer token.
+func MetricsHandler(token string) gin.HandlerFunc {
+	handler := promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})
+	return func(c *gin.Context) {
+		if token != "" {
+			got := c.GetHeader("Authorization")
+			if subtle.ConstantTimeCompare([]byte(got), []byte("Bearer "+token)) != 1 {
+				c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+				problem.Error(c, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
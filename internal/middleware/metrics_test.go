@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"wine-shop-api/internal/metrics"
+)
+
+func TestMetricsMiddleware_LabelsByRouteTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(MetricsMiddleware())
+	r.GET("/products/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	before := testutil.CollectAndCount(metrics.HTTPRequestDuration)
+	for _, path := range []string{"/products/1", "/products/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// Both product requests share one series; the unmatched request adds another
+	if got := testutil.CollectAndCount(metrics.HTTPRequestDuration) - before; got != 2 {
+		t.Errorf("Expected 2 new series, got %d", got)
+	}
+	out := scrape(t)
+	if !strings.Contains(out, `route="/products/:id",status="200"`) || !strings.Contains(out, `route="unmatched",status="404"`) {
+		t.Errorf("Expected route template labels, got:\n%s", out)
+	}
+}
+
+func TestMetricsHandler_Token(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/metrics", MetricsHandler("scrape-token"))
+
+	for _, tt := range []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"Bearer scrape-token", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("Authorization %q: expected %d, got %d", tt.header, tt.want, w.Code)
+		}
+	}
+}
+
+func TestRateLimiter_CountsRejections(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiterFromConfig(RateLimiterConfig{Name: "metrics-test", Limit: 1, Window: time.Minute})
+	r := gin.New()
+	r.Use(RateLimitMiddleware(limiter))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	counter := metrics.RateLimitRejections.WithLabelValues("metrics-test")
+	before := testutil.ToFloat64(counter)
+	for i := 0; i < 3; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("Expected 2 rejections, got %v", got)
+	}
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	r := gin.New()
+	r.GET("/metrics", MetricsHandler(""))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Scrape failed with %d", w.Code)
+	}
+	return w.Body.String()
+}
@@ -0,0 +1,401 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.yaml.in/yaml/v3"
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/utils"
+)
+
+// Roles a rate limit policy can target
+const (
+	RoleAnonymous = "anonymous"
+	RoleCustomer  = "customer"
+	RoleAdmin     = "admin"
+	RoleAPIKey    = "api_key"
+)
+
+// RateLimitPolicy limits the requests that match its routes and roles
+type RateLimitPolicy struct {
+	Name string `yaml:"name"`
+	// Routes are "METHOD /pattern" or "/pattern" using Gin route templates,
+	// e.g. "POST /api/login" or "/api/products/:id". A trailing * matches any
+	// suffix. No routes matches every route.
+	Routes []string `yaml:"routes"`
+	// Roles are anonymous, customer, admin or api_key. No roles matches every role.
+	Roles  []string      `yaml:"roles"`
+	Limit  int           `yaml:"limit"`
+	Window time.Duration `yaml:"window"`
+	// Key is a ParseKeyFunc spec; defaults to "client"
+	Key string `yaml:"key"`
+
+	routes []routePattern
+	key    KeyFunc
+}
+
+// RateLimitPolicies is a set of policies where the first match wins.
+// Requests from allowlisted IPs or networks are never limited.
+type RateLimitPolicies struct {
+	Allowlist []string          `yaml:"allowlist"`
+	Policies  []RateLimitPolicy `yaml:"policies"`
+
+	allowlist []*net.IPNet
+}
+
+type routePattern struct {
+	method string // empty matches any method
+	path   string
+	prefix bool
+}
+
+// DefaultRateLimitPolicies are used when no policy file is configured: 10
+// requests per minute per IP for auth routes and 100 per minute per client
+// for everything else
+func DefaultRateLimitPolicies() *RateLimitPolicies {
+	policies, err := ParseRateLimitPolicies([]byte(defaultRateLimitPolicies))
+	if err != nil {
+		panic(err)
+	}
+	return policies
+}
+
+const defaultRateLimitPolicies = `
+policies:
+  - name: auth
+    routes:
+      - POST /api/register
+      - POST /api/login
+      - POST /api/login/mfa
+      - /api/auth/oidc/:provider/login
+      - /api/auth/oidc/:provider/callback
+    limit: 10
+    window: 1m
+    key: ip
+  - name: general
+    limit: 100
+    window: 1m
+`
+
+// LoadRateLimitPolicies reads a YAML (or JSON) policy file
+func LoadRateLimitPolicies(path string) (*RateLimitPolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRateLimitPolicies(data)
+}
+
+// ParseRateLimitPolicies parses and validates a policy document
+func ParseRateLimitPolicies(data []byte) (*RateLimitPolicies, error) {
+	var policies RateLimitPolicies
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policies); err != nil {
+		return nil, fmt.Errorf("invalid rate limit policy file: %w", err)
+	}
+
+	for _, entry := range policies.Allowlist {
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, err
+		}
+		policies.allowlist = append(policies.allowlist, network)
+	}
+
+	names := make(map[string]bool)
+	for i := range policies.Policies {
+		policy := &policies.Policies[i]
+		if policy.Name == "" {
+			return nil, fmt.Errorf("rate limit policy %d has no name", i+1)
+		}
+		if names[policy.Name] {
+			return nil, fmt.Errorf("duplicate rate limit policy %q", policy.Name)
+		}
+		names[policy.Name] = true
+
+		if policy.Limit <= 0 || policy.Window <= 0 {
+			return nil, fmt.Errorf("rate limit policy %q needs a positive limit and window", policy.Name)
+		}
+		for _, role := range policy.Roles {
+			switch role {
+			case RoleAnonymous, RoleCustomer, RoleAdmin, RoleAPIKey:
+			default:
+				return nil, fmt.Errorf("rate limit policy %q has unknown role %q", policy.Name, role)
+			}
+		}
+		for _, route := range policy.Routes {
+			pattern, err := parseRoutePattern(route)
+			if err != nil {
+				return nil, fmt.Errorf("rate limit policy %q: %w", policy.Name, err)
+			}
+			policy.routes = append(policy.routes, pattern)
+		}
+
+		keySpec := policy.Key
+		if keySpec == "" {
+			keySpec = "client"
+		}
+		key, err := ParseKeyFunc(keySpec)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %q: %w", policy.Name, err)
+		}
+		policy.key = key
+	}
+	return &policies, nil
+}
+
+// parseNetwork accepts a CIDR or a single IP address
+func parseNetwork(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		bits := 32
+		if ip.To4() == nil {
+			bits = 128
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+	}
+	return network, nil
+}
+
+func parseRoutePattern(route string) (routePattern, error) {
+	var pattern routePattern
+	fields := strings.Fields(route)
+	switch len(fields) {
+	case 1:
+		pattern.path = fields[0]
+	case 2:
+		pattern.method = strings.ToUpper(fields[0])
+		pattern.path = fields[1]
+	default:
+		return pattern, fmt.Errorf("invalid route %q", route)
+	}
+	if !strings.HasPrefix(pattern.path, "/") {
+		return pattern, fmt.Errorf("route %q must start with /", route)
+	}
+	if strings.HasSuffix(pattern.path, "*") {
+		pattern.path = strings.TrimSuffix(pattern.path, "*")
+		pattern.prefix = true
+	}
+	return pattern, nil
+}
+
+func (p routePattern) matches(method, path string) bool {
+	if p.method != "" && p.method != method {
+		return false
+	}
+	if p.prefix {
+		return strings.HasPrefix(path, p.path)
+	}
+	return path == p.path
+}
+
+// IsAllowlisted reports whether ip is exempt from rate limiting
+func (p *RateLimitPolicies) IsAllowlisted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range p.allowlist {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns the first policy for the request's route and the caller's
+// role, or nil. role is only called when a matching policy is role-specific.
+func (p *RateLimitPolicies) Match(method, path string, role func() string) *RateLimitPolicy {
+	for i := range p.Policies {
+		policy := &p.Policies[i]
+		if !policy.matchesRoute(method, path) {
+			continue
+		}
+		if len(policy.Roles) > 0 && !slices.Contains(policy.Roles, role()) {
+			continue
+		}
+		return policy
+	}
+	return nil
+}
+
+func (policy *RateLimitPolicy) matchesRoute(method, path string) bool {
+	if len(policy.routes) == 0 {
+		return true
+	}
+	for _, pattern := range policy.routes {
+		if pattern.matches(method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyRateLimiter applies rate limit policies loaded from a file. The
+// policies can be swapped at runtime with Reload.
+type PolicyRateLimiter struct {
+	// APIKeys verifies API keys so only real ones get their own buckets
+	// and the api_key role; without it API keys are treated as anonymous
+	APIKeys APIKeyLookup
+
+	path     string
+	store    RateLimitStore
+	policies atomic.Pointer[RateLimitPolicies]
+	roleOf   func(c *gin.Context) string
+}
+
+// NewPolicyRateLimiter loads the policies at path, or the defaults when path
+// is empty. Buckets are kept in store, which defaults to a new MemoryStore.
+func NewPolicyRateLimiter(path string, store RateLimitStore) (*PolicyRateLimiter, error) {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	l := &PolicyRateLimiter{path: path, store: store, roleOf: requestRole}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload re-reads the policy file. On error the current policies are kept.
+func (l *PolicyRateLimiter) Reload() error {
+	if l.path == "" {
+		l.policies.Store(DefaultRateLimitPolicies())
+		return nil
+	}
+	policies, err := LoadRateLimitPolicies(l.path)
+	if err != nil {
+		return err
+	}
+	l.policies.Store(policies)
+	return nil
+}
+
+// Policies returns the active policy set
+func (l *PolicyRateLimiter) Policies() *RateLimitPolicies {
+	return l.policies.Load()
+}
+
+// APIKeyLookup resolves a plain API key to an active key
+type APIKeyLookup interface {
+	Lookup(ctx context.Context, plainKey string) (*domain.APIKey, error)
+}
+
+// rateLimitAPIKey is the context key of the API key verified for rate limiting
+const rateLimitAPIKey = "rate_limit_api_key"
+
+// RateLimitPolicyMiddleware limits each request by the first matching
+// policy. It runs before authentication, so callers are identified from
+// their credentials without rejecting invalid ones.
+func RateLimitPolicyMiddleware(l *PolicyRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies := l.Policies()
+		if policies.IsAllowlisted(c.ClientIP()) {
+			c.Next()
+			return
+		}
+		l.verifyAPIKey(c)
+
+		path := c.FullPath()
+		if path == "" {
+			path = c.Request.URL.Path
+		}
+		var role string
+		policy := policies.Match(c.Request.Method, path, func() string {
+			if role == "" {
+				role = l.roleOf(c)
+			}
+			return role
+		})
+		if policy == nil {
+			c.Next()
+			return
+		}
+
+		// Buckets are namespaced by the limit so a reloaded policy starts fresh
+		limiter := &RateLimiter{
+			name:   fmt.Sprintf("policy:%s:%d/%s", policy.Name, policy.Limit, policy.Window),
+			policy: policy.Name,
+			limit:  policy.Limit,
+			window: policy.Window,
+			store:  l.store,
+			key:    policy.key,
+		}
+		limiter.apply(c)
+	}
+}
+
+// verifyAPIKey records the caller's API key for KeyByAPIKey and requestRole
+// when it belongs to an active key
+func (l *PolicyRateLimiter) verifyAPIKey(c *gin.Context) {
+	credential := c.GetHeader("X-API-Key")
+	if credential == "" {
+		credential = utils.ExtractToken(c)
+	}
+	if l.APIKeys == nil || !service.IsAPIKey(credential) {
+		return
+	}
+	if key, err := l.APIKeys.Lookup(c.Request.Context(), credential); err == nil {
+		c.Set(rateLimitAPIKey, key)
+	}
+}
+
+// verifiedAPIKey returns the API key verified by the rate limiter or by
+// authentication, or nil
+func verifiedAPIKey(c *gin.Context) *domain.APIKey {
+	for _, name := range []string{rateLimitAPIKey, "api_key"} {
+		if key, ok := c.Value(name).(*domain.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// requestRole identifies the caller's role from their credentials. Invalid
+// or missing credentials are treated as anonymous; authentication rejects
+// them later.
+func requestRole(c *gin.Context) string {
+	if verifiedAPIKey(c) != nil {
+		return RoleAPIKey
+	}
+
+	userID, err := utils.ExtractTokenID(c)
+	if err != nil {
+		return RoleAnonymous
+	}
+	var user domain.User
+	ctx := c.Request.Context()
+	if err := config.DB.WithContext(ctx).Select("role").First(&user, userID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to resolve role for rate limiting", "error", err)
+		}
+		return RoleAnonymous
+	}
+	if user.IsAdmin() {
+		return RoleAdmin
+	}
+	return RoleCustomer
+}
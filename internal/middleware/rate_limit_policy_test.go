@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/service"
+)
+
+const testPolicies = `
+allowlist:
+  - 10.0.0.0/8
+  - 192.168.1.5
+policies:
+  - name: auth
+    routes: [POST /api/login]
+    limit: 2
+    window: 1m
+    key: ip
+  - name: admin
+    routes: [/api/admin/*]
+    roles: [admin]
+    limit: 50
+    window: 1m
+  - name: general
+    limit: 5
+    window: 1m
+`
+
+func TestParseRateLimitPolicies_Match(t *testing.T) {
+	policies, err := ParseRateLimitPolicies([]byte(testPolicies))
+	if err != nil {
+		t.Fatalf("Failed to parse policies: %v", err)
+	}
+
+	role := func(r string) func() string { return func() string { return r } }
+	tests := []struct {
+		method, path, role string
+		want               string
+	}{
+		{"POST", "/api/login", RoleAnonymous, "auth"},
+		{"GET", "/api/login", RoleAnonymous, "general"},
+		{"GET", "/api/admin/audit", RoleAdmin, "admin"},
+		{"GET", "/api/admin/audit", RoleCustomer, "general"},
+		{"GET", "/api/products/:id", RoleCustomer, "general"},
+	}
+	for _, tt := range tests {
+		policy := policies.Match(tt.method, tt.path, role(tt.role))
+		if policy == nil || policy.Name != tt.want {
+			t.Errorf("Match(%s %s, %s) = %v, want %s", tt.method, tt.path, tt.role, policy, tt.want)
+		}
+	}
+}
+
+func TestParseRateLimitPolicies_Allowlist(t *testing.T) {
+	policies, _ := ParseRateLimitPolicies([]byte(testPolicies))
+
+	for ip, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.5": true,
+		"192.168.1.6": false,
+		"8.8.8.8":     false,
+		"not-an-ip":   false,
+	} {
+		if got := policies.IsAllowlisted(ip); got != want {
+			t.Errorf("IsAllowlisted(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestParseRateLimitPolicies_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "policies:\n  - name: a\n    limit: 1\n    window: 1m\n    burst: 2\n",
+		"missing name":   "policies:\n  - limit: 1\n    window: 1m\n",
+		"duplicate name": "policies:\n  - name: a\n    limit: 1\n    window: 1m\n  - name: a\n    limit: 1\n    window: 1m\n",
+		"zero limit":     "policies:\n  - name: a\n    window: 1m\n",
+		"bad window":     "policies:\n  - name: a\n    limit: 1\n    window: soon\n",
+		"unknown role":   "policies:\n  - name: a\n    roles: [root]\n    limit: 1\n    window: 1m\n",
+		"unknown key":    "policies:\n  - name: a\n    key: cookie\n    limit: 1\n    window: 1m\n",
+		"relative route": "policies:\n  - name: a\n    routes: [api/login]\n    limit: 1\n    window: 1m\n",
+		"bad allowlist":  "allowlist: [10.0.0.0/99]\n",
+	}
+	for name, doc := range tests {
+		if _, err := ParseRateLimitPolicies([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRateLimitPolicyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	if err := os.WriteFile(path, []byte(testPolicies), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	limiter, err := NewPolicyRateLimiter(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter.roleOf = func(*gin.Context) string { return RoleAnonymous }
+
+	r := gin.New()
+	r.Use(RateLimitPolicyMiddleware(limiter))
+	r.POST("/api/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	login := func(ip string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	login("8.8.8.8")
+	login("8.8.8.8")
+	if code := login("8.8.8.8"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after the auth policy limit, got %d", code)
+	}
+	for i := 0; i < 5; i++ {
+		if code := login("10.0.0.1"); code != http.StatusOK {
+			t.Fatalf("Allowlisted IP should not be limited, got %d", code)
+		}
+	}
+
+	// Raise the auth limit and reload
+	raised := []byte("policies:\n  - name: auth\n    routes: [POST /api/login]\n    limit: 100\n    window: 1m\n    key: ip\n")
+	if err := os.WriteFile(path, raised, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if code := login("8.8.8.8"); code != http.StatusOK {
+		t.Errorf("Expected the reloaded policy to allow the request, got %d", code)
+	}
+
+	// A broken file keeps the current policies
+	if err := os.WriteFile(path, []byte("policies: ["), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Reload(); err == nil {
+		t.Error("Reload of an invalid file should fail")
+	}
+	if limiter.Policies().Policies[0].Limit != 100 {
+		t.Error("Invalid reload should keep the current policies")
+	}
+}
+
+// stubAPIKeys knows a single active key
+type stubAPIKeys struct{ key string }
+
+func (s stubAPIKeys) Lookup(_ context.Context, plainKey string) (*domain.APIKey, error) {
+	if plainKey != s.key {
+		return nil, service.ErrInvalidAPIKey
+	}
+	return &domain.APIKey{Model: gorm.Model{ID: 1}}, nil
+}
+
+func TestRateLimitPolicyMiddleware_MadeUpAPIKeysShareIPBucket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	policies := "policies:\n  - name: integrations\n    roles: [api_key]\n    limit: 100\n    window: 1m\n  - name: general\n    limit: 2\n    window: 1m\n"
+	if err := os.WriteFile(path, []byte(policies), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	limiter, err := NewPolicyRateLimiter(path, nil)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter.APIKeys = stubAPIKeys{key: "wsk_real.secret"}
+
+	r := gin.New()
+	r.Use(RateLimitPolicyMiddleware(limiter))
+	r.GET("/api/products", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(apiKey string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/products", nil)
+		req.RemoteAddr = "8.8.4.4:1234"
+		req.Header.Set("X-API-Key", apiKey)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// A new fake key per request neither gets a fresh bucket nor the api_key policy
+	get("wsk_fake1.x")
+	get("wsk_fake2.x")
+	if code := get("wsk_fake3.x"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected made-up keys to share the IP's bucket and be limited, got %d", code)
+	}
+
+	// A real key is identified and gets its own bucket and policy
+	for i := 0; i < 5; i++ {
+		if code := get("wsk_real.secret"); code != http.StatusOK {
+			t.Fatalf("Expected the verified key to use its own policy, got %d", code)
+		}
+	}
+}
+
+func TestDefaultRateLimitPolicies(t *testing.T) {
+	policies := DefaultRateLimitPolicies()
+	anonymous := func() string { return RoleAnonymous }
+
+	if p := policies.Match("POST", "/api/login", anonymous); p == nil || p.Limit != 10 {
+		t.Errorf("Expected the auth policy for login, got %v", p)
+	}
+	if p := policies.Match("GET", "/api/products", anonymous); p == nil || p.Limit != 100 {
+		t.Errorf("Expected the general policy for products, got %v", p)
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// rateLimitBucket is the shared token bucket row used by PostgresStore
+type rateLimitBucket struct {
+	Key       string    `gorm:"primaryKey"`
+	Tokens    float64   `gorm:"not null"`
+	Allowed   bool      `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"index;not null"`
+}
+
+func (rateLimitBucket) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// PostgresStore keeps token buckets in Postgres so limits hold across
+// replicas and restarts. Each request is a single atomic upsert.
+type PostgresStore struct {
+	db   *gorm.DB
+	stop chan struct{}
+	once sync.Once
+}
+
+// takeSQL refills the bucket for the elapsed time and takes a token if one is
+// available. All SET expressions see the row's previous values.
+const takeSQL = `
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (@key, @capacity - 1, TRUE, now())
+ON CONFLICT (key) DO UPDATE SET
+	allowed = LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate) >= 1,
+	tokens = LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate)
+		- CASE WHEN LEAST(@capacity, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * @rate) >= 1 THEN 1 ELSE 0 END,
+	updated_at = now()
+RETURNING tokens, allowed`
+
+// NewPostgresStore creates the bucket table if needed and starts a goroutine
+// that removes idle buckets
+func NewPostgresStore(db *gorm.DB) (*PostgresStore, error) {
+	if err := db.AutoMigrate(&rateLimitBucket{}); err != nil {
+		return nil, err
+	}
+	s := &PostgresStore{db: db, stop: make(chan struct{})}
+	go s.cleanup()
+	return s, nil
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	var row struct {
+		Tokens  float64
+		Allowed bool
+	}
+	err := s.db.WithContext(ctx).Raw(takeSQL, map[string]interface{}{
+		"key":      key,
+		"capacity": float64(limit),
+		"rate":     float64(limit) / window.Seconds(),
+	}).Scan(&row).Error
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return newRateLimitResult(row.Allowed, row.Tokens, limit, window), nil
+}
+
+// Close stops the cleanup goroutine
+func (s *PostgresStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// cleanup deletes buckets idle for over an hour; they would be full anyway
+// for any window up to that long
+func (s *PostgresStore) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.db.Where("updated_at < ?", time.Now().Add(-time.Hour)).Delete(&rateLimitBucket{}).Error; err != nil {
+				slog.Error("rate limit cleanup failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimitStore keeps token buckets for rate limiting. Each bucket holds up
+// to limit tokens and refills completely over window. Close stops any
+// background cleanup and is called once during graceful shutdown.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit int, window time.Duration) (RateLimitResult, error)
+	Close()
+}
+
+// RateLimitResult describes the state of a bucket after a request
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until a token is available, when not allowed
+	ResetAfter time.Duration // until the bucket is full again
+}
+
+// newRateLimitResult derives the result from the tokens left in a bucket
+func newRateLimitResult(allowed bool, tokens float64, limit int, window time.Duration) RateLimitResult {
+	refillPerSecond := float64(limit) / window.Seconds()
+	result := RateLimitResult{
+		Allowed:    allowed,
+		Limit:      limit,
+		Remaining:  int(math.Max(0, math.Floor(tokens))),
+		ResetAfter: secondsToDuration((float64(limit) - tokens) / refillPerSecond),
+	}
+	if !allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / refillPerSecond)
+	}
+	return result
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// MemoryStore is an in-process token bucket store. Limits are per replica
+// and reset on restart; use PostgresStore to share limits.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	window  time.Duration
+}
+
+// NewMemoryStore creates a store and starts its cleanup goroutine
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		buckets: make(map[string]*bucket),
+		stop:    make(chan struct{}),
+	}
+	go s.cleanup()
+	return s
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	capacity := float64(limit)
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+
+	// Refill for the time elapsed since the last request
+	refillPerSecond := capacity / window.Seconds()
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*refillPerSecond)
+	b.updated = now
+	b.window = window
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return newRateLimitResult(allowed, b.tokens, limit, window), nil
+}
+
+// Close stops the cleanup goroutine
+func (s *MemoryStore) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// cleanup removes buckets that have been idle long enough to be full again
+func (s *MemoryStore) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, b := range s.buckets {
+				if now.Sub(b.updated) >= b.window {
+					delete(s.buckets, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -1,93 +1,203 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/problem"
+	"wine-shop-api/pkg/utils"
 )
 
-// RateLimiter stores rate limit data per IP
+// KeyFunc derives the rate limit key for a request
+type KeyFunc func(c *gin.Context) string
+
+// RateLimiterConfig configures a RateLimiter
+type RateLimiterConfig struct {
+	Name   string // namespaces keys in a shared store, e.g. "auth"
+	Limit  int
+	Window time.Duration
+	Store  RateLimitStore // defaults to a new MemoryStore
+	Key    KeyFunc        // defaults to KeyByIP
+}
+
+// RateLimiter applies a token bucket limit to requests grouped by key
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.RWMutex
-	limit    int
-	window   time.Duration
+	name   string
+	policy string // labels rejections in metrics; defaults to name
+	limit  int
+	window time.Duration
+	store  RateLimitStore
+	key    KeyFunc
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates an in-memory rate limiter keyed by client IP
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	rl := &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+	return NewRateLimiterFromConfig(RateLimiterConfig{Limit: limit, Window: window})
+}
+
+// NewRateLimiterFromConfig creates a rate limiter with the given store and key
+func NewRateLimiterFromConfig(cfg RateLimiterConfig) *RateLimiter {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
 	}
-	// Cleanup old entries periodically
-	go rl.cleanup()
-	return rl
-}
-
-// cleanup removes old entries every minute
-func (rl *RateLimiter) cleanup() {
-	for {
-		time.Sleep(time.Minute)
-		rl.mu.Lock()
-		now := time.Now()
-		for ip, times := range rl.requests {
-			var valid []time.Time
-			for _, t := range times {
-				if now.Sub(t) < rl.window {
-					valid = append(valid, t)
-				}
-			}
-			if len(valid) == 0 {
-				delete(rl.requests, ip)
-			} else {
-				rl.requests[ip] = valid
-			}
-		}
-		rl.mu.Unlock()
+	if cfg.Key == nil {
+		cfg.Key = KeyByIP
+	}
+	if cfg.Name == "" {
+		cfg.Name = fmt.Sprintf("%d/%s", cfg.Limit, cfg.Window)
+	}
+	return &RateLimiter{
+		name:   cfg.Name,
+		policy: cfg.Name,
+		limit:  cfg.Limit,
+		window: cfg.Window,
+		store:  cfg.Store,
+		key:    cfg.Key,
+	}
+}
+
+// take consumes a token for key. If the store is unavailable the request is
+// allowed, so a database outage does not take down the API.
+func (rl *RateLimiter) take(ctx context.Context, key string) RateLimitResult {
+	result, err := rl.store.Take(ctx, rl.name+":"+key, rl.limit, rl.window)
+	if err != nil {
+		logging.FromContext(ctx).WarnContext(ctx, "rate limit store error, allowing request", "error", err)
+		return RateLimitResult{Allowed: true, Limit: rl.limit, Remaining: rl.limit}
 	}
+	return result
+}
+
+// isAllowed checks if a request for the key is allowed
+func (rl *RateLimiter) isAllowed(key string) bool {
+	return rl.take(context.Background(), key).Allowed
+}
+
+// RateLimitMiddleware creates a rate limiting middleware
+func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+	return limiter.apply
 }
 
-// isAllowed checks if a request from an IP is allowed
-func (rl *RateLimiter) isAllowed(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
+// apply takes a token for the request, rejecting it when the bucket is empty
+func (rl *RateLimiter) apply(c *gin.Context) {
+	result := rl.take(c.Request.Context(), rl.key(c))
+	setRateLimitHeaders(c, result, rl.window)
 
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
+	if !result.Allowed {
+		metrics.RateLimitRejections.WithLabelValues(rl.policy).Inc()
+		problem.Error(c, http.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests. Please try again later.")
+		return
+	}
+	c.Next()
+}
 
-	// Filter requests within the current window
-	var validRequests []time.Time
-	for _, t := range rl.requests[ip] {
-		if t.After(windowStart) {
-			validRequests = append(validRequests, t)
+// setRateLimitHeaders writes the IETF RateLimit headers and, when the request
+// is rejected, Retry-After
+func setRateLimitHeaders(c *gin.Context, result RateLimitResult, window time.Duration) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", result.Limit, ceilSeconds(window)))
+	if !result.Allowed {
+		retryAfter := ceilSeconds(result.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
 		}
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
 	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// KeyByIP keys requests by client IP
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
 
-	if len(validRequests) >= rl.limit {
-		rl.requests[ip] = validRequests
-		return false
+// KeyByUserID keys authenticated requests by user ID, falling back to the
+// client IP for anonymous requests
+func KeyByUserID(c *gin.Context) string {
+	if userID := c.GetUint("user_id"); userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
 	}
+	if userID, err := utils.ExtractTokenID(c); err == nil && userID != 0 {
+		return "user:" + strconv.FormatUint(uint64(userID), 10)
+	}
+	return KeyByIP(c)
+}
 
-	// Add current request
-	rl.requests[ip] = append(validRequests, now)
-	return true
+// KeyByAPIKey keys requests by API key, falling back to the client IP. Only
+// keys verified against the store count, so made-up keys share their IP's
+// bucket.
+func KeyByAPIKey(c *gin.Context) string {
+	if key := verifiedAPIKey(c); key != nil {
+		return "key:" + strconv.FormatUint(uint64(key.ID), 10)
+	}
+	return KeyByIP(c)
 }
 
-// RateLimitMiddleware creates a rate limiting middleware
-func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ip := c.ClientIP()
-		if !limiter.isAllowed(ip) {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "Too many requests. Please try again later.",
-			})
-			c.Abort()
-			return
+// KeyByClient keys requests by API key, then user ID, then client IP, so
+// authenticated callers behind a shared NAT get their own buckets
+func KeyByClient(c *gin.Context) string {
+	if key := KeyByAPIKey(c); !strings.HasPrefix(key, "ip:") {
+		return key
+	}
+	return KeyByUserID(c)
+}
+
+// KeyByRoute keys requests by method and route pattern
+func KeyByRoute(c *gin.Context) string {
+	return "route:" + c.Request.Method + " " + c.FullPath()
+}
+
+// CombineKeys joins several key functions, e.g. user and route
+func CombineKeys(keys ...KeyFunc) KeyFunc {
+	return func(c *gin.Context) string {
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = key(c)
 		}
-		c.Next()
+		return strings.Join(parts, "|")
+	}
+}
+
+// ParseKeyFunc builds a KeyFunc from a comma-separated list of ip, user,
+// api_key, client and route
+func ParseKeyFunc(spec string) (KeyFunc, error) {
+	var keys []KeyFunc
+	for _, name := range strings.Split(spec, ",") {
+		switch strings.TrimSpace(name) {
+		case "ip":
+			keys = append(keys, KeyByIP)
+		case "user":
+			keys = append(keys, KeyByUserID)
+		case "api_key":
+			keys = append(keys, KeyByAPIKey)
+		case "client":
+			keys = append(keys, KeyByClient)
+		case "route":
+			keys = append(keys, KeyByRoute)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %q", name)
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return KeyByIP, nil
+	case 1:
+		return keys[0], nil
+	default:
+		return CombineKeys(keys...), nil
 	}
 }
@@ -1,8 +1,18 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
 )
 
 func TestRateLimiter_AllowsRequestsUnderLimit(t *testing.T) {
@@ -63,3 +73,102 @@ func TestRateLimiter_ResetsAfterWindow(t *testing.T) {
 		t.Error("Should be allowed after window reset")
 	}
 }
+
+func TestMemoryStore_TokenBucketRefill(t *testing.T) {
+	store := NewMemoryStore()
+	defer store.Close()
+	ctx := context.Background()
+
+	// 10 tokens refilling over one second: one token every 100ms
+	for i := 0; i < 10; i++ {
+		store.Take(ctx, "k", 10, time.Second)
+	}
+
+	result, _ := store.Take(ctx, "k", 10, time.Second)
+	if result.Allowed {
+		t.Fatal("Bucket should be empty")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+		t.Errorf("RetryAfter should be at most one refill interval, got %v", result.RetryAfter)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	result, _ = store.Take(ctx, "k", 10, time.Second)
+	if !result.Allowed {
+		t.Error("A token should have been refilled")
+	}
+}
+
+func TestRateLimitMiddleware_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(2, time.Minute)
+
+	r := gin.New()
+	r.GET("/", RateLimitMiddleware(limiter), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if i == 0 && w.Header().Get("RateLimit-Remaining") != "1" {
+			t.Errorf("Expected RateLimit-Remaining 1, got %q", w.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" {
+		t.Errorf("Expected RateLimit-Limit 2, got %q", w.Header().Get("RateLimit-Limit"))
+	}
+	if w.Header().Get("RateLimit-Policy") != "2;w=60" {
+		t.Errorf("Expected RateLimit-Policy 2;w=60, got %q", w.Header().Get("RateLimit-Policy"))
+	}
+	if retry, _ := strconv.Atoi(w.Header().Get("Retry-After")); retry < 1 || retry > 30 {
+		t.Errorf("Expected Retry-After between 1 and 30 seconds, got %q", w.Header().Get("Retry-After"))
+	}
+}
+
+func TestParseKeyFunc(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:1234"
+	c.Request.Header.Set("X-API-Key", "wsk_abcdef.secret")
+	c.Set("user_id", uint(7))
+
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"", "ip:10.0.0.1"},
+		{"ip", "ip:10.0.0.1"},
+		{"user", "user:7"},
+		{"user,ip", "user:7|ip:10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		key, err := ParseKeyFunc(tt.spec)
+		if err != nil {
+			t.Fatalf("ParseKeyFunc(%q) failed: %v", tt.spec, err)
+		}
+		if got := key(c); got != tt.want {
+			t.Errorf("ParseKeyFunc(%q) key = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+
+	apiKey, _ := ParseKeyFunc("api_key")
+	if got := apiKey(c); got != "ip:10.0.0.1" {
+		t.Errorf("An unverified API key should fall back to the IP, got %q", got)
+	}
+	c.Set(rateLimitAPIKey, &domain.APIKey{Model: gorm.Model{ID: 3}})
+	if got := apiKey(c); got != "key:3" || strings.Contains(got, "secret") {
+		t.Errorf("A verified API key should be keyed by ID, got %q", got)
+	}
+
+	if _, err := ParseKeyFunc("cookie"); err == nil {
+		t.Error("Unknown key should be rejected")
+	}
+}
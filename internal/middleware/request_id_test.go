@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/pkg/logging"
+)
+
+func setupRequestIDRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware(slog.New(slog.NewJSONHandler(buf, nil))))
+	r.Use(RequestLoggerMiddleware())
+	r.GET("/items/:id", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		logging.FromContext(ctx).InfoContext(ctx, "handler")
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+	return r
+}
+
+func TestRequestIDMiddleware_Generates(t *testing.T) {
+	var buf bytes.Buffer
+	r := setupRequestIDRouter(&buf)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/items/1", nil))
+
+	id := w.Header().Get(RequestIDHeader)
+	if len(id) != 32 || w.Body.String() != id {
+		t.Fatalf("Expected a generated ID in the header and context, got %q / %q", id, w.Body.String())
+	}
+
+	// Both the handler's entry and the access log carry the ID
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two log entries, got %q", buf.String())
+	}
+	var access map[string]any
+	json.Unmarshal([]byte(lines[1]), &access)
+	if access["request_id"] != id || access["route"] != "/items/:id" || access["status"] != float64(200) {
+		t.Errorf("Unexpected access log: %v", access)
+	}
+	if !strings.Contains(lines[0], id) {
+		t.Errorf("Handler log should carry the request ID: %s", lines[0])
+	}
+}
+
+func TestRequestIDMiddleware_HonoursInbound(t *testing.T) {
+	r := setupRequestIDRouter(&bytes.Buffer{})
+
+	tests := []struct {
+		inbound string
+		kept    bool
+	}{
+		{"3f2504e0-4f89-11d3-9a0c-0305e82c3301", true},
+		{"bad id with spaces", false},
+		{strings.Repeat("a", 200), false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/items/1", nil)
+		req.Header.Set(RequestIDHeader, tt.inbound)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if got := w.Header().Get(RequestIDHeader); (got == tt.inbound) != tt.kept || got == "" {
+			t.Errorf("Inbound %q: got %q, kept=%v", tt.inbound, got, tt.kept)
+		}
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RecoveryMiddleware())
+	r.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/panic", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+}
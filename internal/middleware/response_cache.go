@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/httpcache"
+	"wine-shop-api/pkg/utils"
+)
+
+// cachedHeaders are the response headers stored with a cached response
+var cachedHeaders = []string{"Content-Type", "Cache-Control", "ETag", "Last-Modified"}
+
+type cachedResponse struct {
+	status       int
+	header       map[string]string
+	body         []byte
+	lastModified time.Time
+}
+
+// ResponseCache keeps successful anonymous GET responses in memory, keyed by
+// path and query. Purge must be called whenever the cached data changes;
+// responses computed while a purge happens are not stored.
+type ResponseCache struct {
+	mu         sync.Mutex
+	entries    *httpcache.LRU[string, cachedResponse]
+	generation uint64
+}
+
+// NewResponseCache creates a cache of up to size responses, each kept for ttl
+func NewResponseCache(size int, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{entries: httpcache.NewLRU[string, cachedResponse](size, ttl)}
+}
+
+// Purge drops every cached response
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.generation++
+	rc.entries.Purge()
+}
+
+func (rc *ResponseCache) currentGeneration() uint64 {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.generation
+}
+
+// store adds a response unless the cache was purged since generation
+func (rc *ResponseCache) store(generation uint64, key string, response cachedResponse) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.generation == generation {
+		rc.entries.Add(key, response)
+	}
+}
+
+// Middleware serves anonymous GET requests from the cache, answering
+// conditional requests with 304, and caches the 200 responses of misses.
+// Requests carrying credentials always reach the handler, as do all requests
+// when rc is nil.
+func (rc *ResponseCache) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rc == nil || c.Request.Method != http.MethodGet || !isAnonymous(c) {
+			c.Next()
+			return
+		}
+
+		key := c.Request.URL.RequestURI()
+		if cached, ok := rc.entries.Get(key); ok {
+			metrics.ResponseCacheRequests.WithLabelValues("hit").Inc()
+			for name, value := range cached.header {
+				c.Header(name, value)
+			}
+			if httpcache.NotModified(c.Request, cached.header["ETag"], cached.lastModified) {
+				c.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+			c.Data(cached.status, cached.header["Content-Type"], cached.body)
+			c.Abort()
+			return
+		}
+		metrics.ResponseCacheRequests.WithLabelValues("miss").Inc()
+
+		generation := rc.currentGeneration()
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if c.Writer.Status() != http.StatusOK {
+			return
+		}
+		response := cachedResponse{status: http.StatusOK, header: map[string]string{}, body: recorder.body.Bytes()}
+		for _, name := range cachedHeaders {
+			if value := c.Writer.Header().Get(name); value != "" {
+				response.header[name] = value
+			}
+		}
+		response.lastModified, _ = http.ParseTime(response.header["Last-Modified"])
+		rc.store(generation, key, response)
+	}
+}
+
+// isAnonymous reports whether the request carries no credentials
+func isAnonymous(c *gin.Context) bool {
+	if c.GetHeader("Authorization") != "" || c.GetHeader("X-API-Key") != "" {
+		return false
+	}
+	_, err := c.Cookie(utils.SessionCookieName)
+	return err != nil
+}
+
+// CacheControl sets the Cache-Control policy of a route. Handlers may still
+// override it.
+func CacheControl(policy string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", policy)
+		c.Next()
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func responseCacheRouter(cache *ResponseCache, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products", CacheControl("public, max-age=60"), cache.Middleware(), func(c *gin.Context) {
+		*calls++
+		c.Header("ETag", `W/"1"`)
+		c.Header("Last-Modified", "Sun, 01 Mar 2026 12:00:00 GMT")
+		c.JSON(http.StatusOK, gin.H{"calls": *calls})
+	})
+	return r
+}
+
+func getProducts(r http.Handler, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/products?page=1", nil)
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestResponseCache_ServesAnonymousReads(t *testing.T) {
+	var calls int
+	cache := NewResponseCache(10, time.Minute)
+	r := responseCacheRouter(cache, &calls)
+
+	first := getProducts(r, nil)
+	second := getProducts(r, nil)
+	if calls != 1 {
+		t.Errorf("Expected the handler to run once, ran %d times", calls)
+	}
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the cached response %s, got %d %s", first.Body, second.Code, second.Body)
+	}
+	for _, name := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+		if second.Header().Get(name) != first.Header().Get(name) {
+			t.Errorf("Expected cached %s %q, got %q", name, first.Header().Get(name), second.Header().Get(name))
+		}
+	}
+
+	if w := getProducts(r, map[string]string{"If-None-Match": `W/"1"`}); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected 304 from the cache, got %d %s", w.Code, w.Body)
+	}
+
+	cache.Purge()
+	getProducts(r, nil)
+	if calls != 2 {
+		t.Errorf("Expected a purge to send the next read to the handler, ran %d times", calls)
+	}
+}
+
+func TestResponseCache_BypassesCredentials(t *testing.T) {
+	var calls int
+	r := responseCacheRouter(NewResponseCache(10, time.Minute), &calls)
+
+	getProducts(r, map[string]string{"Authorization": "Bearer token"})
+	getProducts(r, map[string]string{"Authorization": "Bearer token"})
+	getProducts(r, map[string]string{"Cookie": "session=abc"})
+	if calls != 3 {
+		t.Errorf("Expected requests with credentials to skip the cache, ran %d times", calls)
+	}
+}
+
+func TestResponseCache_NilPassesThrough(t *testing.T) {
+	var calls int
+	r := responseCacheRouter(nil, &calls)
+
+	getProducts(r, nil)
+	getProducts(r, nil)
+	if calls != 2 {
+		t.Errorf("Expected a nil cache to run the handler every time, ran %d times", calls)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	noFraming := DefaultSecurityHeaders()
+	noFraming.FrameOptions = ""
+
+	r := gin.New()
+	r.Use(SecurityHeadersMiddleware(DefaultSecurityHeaders(), map[string]SecurityHeaders{
+		"/swagger/":       SwaggerSecurityHeaders(),
+		"/swagger/embed/": noFraming,
+	}))
+	r.GET("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path string) http.Header {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header()
+	}
+
+	headers := get("/api/products")
+	if headers.Get("Content-Security-Policy") != DefaultSecurityHeaders().ContentSecurityPolicy {
+		t.Errorf("Expected the default CSP, got %q", headers.Get("Content-Security-Policy"))
+	}
+	for _, name := range []string{"Strict-Transport-Security", "X-Content-Type-Options", "Referrer-Policy", "X-Frame-Options"} {
+		if headers.Get(name) == "" {
+			t.Errorf("Expected %s to be set", name)
+		}
+	}
+
+	headers = get("/swagger/index.html")
+	if !strings.Contains(headers.Get("Content-Security-Policy"), "script-src 'self' 'unsafe-inline'") {
+		t.Errorf("Expected the relaxed Swagger CSP, got %q", headers.Get("Content-Security-Policy"))
+	}
+	if !strings.Contains(headers.Get("Content-Security-Policy"), "frame-ancestors 'none'") {
+		t.Error("Swagger UI should still refuse to be framed")
+	}
+
+	// The longest prefix wins and empty values are omitted
+	headers = get("/swagger/embed/index.html")
+	if headers.Get("X-Frame-Options") != "" {
+		t.Errorf("Expected X-Frame-Options to be omitted, got %q", headers.Get("X-Frame-Options"))
+	}
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/postcode"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAddressNotFound         = NotFound("address_not_found", "address not found")
+	ErrShippingAddressRequired = invalidField("shipping_address_id", "required", "choose a shipping address or add one to your address book")
+)
+
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// AddressService manages customers' address books
+type AddressService struct{}
+
+// GetAddresses lists the user's addresses, defaults first
+func (s *AddressService) GetAddresses(ctx context.Context, userID uint) ([]domain.Address, error) {
+	ctx, span := tracing.Start(ctx, "AddressService.GetAddresses")
+	defer span.End()
+
+	addresses := []domain.Address{}
+	if err := config.DB.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("is_default_shipping DESC, is_default_billing DESC, created_at DESC").
+		Find(&addresses).Error; err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetAddress returns one of the user's addresses. Other users' addresses are
+// reported as not found.
+func (s *AddressService) GetAddress(ctx context.Context, userID, id uint) (*domain.Address, error) {
+	ctx, span := tracing.Start(ctx, "AddressService.GetAddress")
+	defer span.End()
+
+	return findAddress(config.DB.WithContext(ctx), userID, id)
+}
+
+// CreateAddress adds an address to the user's book. The first address
+// becomes the default for both shipping and billing.
+func (s *AddressService) CreateAddress(ctx context.Context, userID uint, address *domain.Address) (*domain.Address, error) {
+	ctx, span := tracing.Start(ctx, "AddressService.CreateAddress")
+	defer span.End()
+
+	if err := normalizeAddress(&address.PostalAddress); err != nil {
+		return nil, err
+	}
+	address.ID = 0
+	address.UserID = userID
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&domain.Address{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefaultShipping = true
+			address.IsDefaultBilling = true
+		}
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+		return tx.Create(address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// UpdateAddress replaces one of the user's addresses. Orders keep the copy
+// made at checkout.
+func (s *AddressService) UpdateAddress(ctx context.Context, userID, id uint, input *domain.Address) (*domain.Address, error) {
+	ctx, span := tracing.Start(ctx, "AddressService.UpdateAddress")
+	defer span.End()
+
+	if err := normalizeAddress(&input.PostalAddress); err != nil {
+		return nil, err
+	}
+
+	var address *domain.Address
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if address, err = findAddress(tx, userID, id); err != nil {
+			return err
+		}
+		address.Label = input.Label
+		address.PostalAddress = input.PostalAddress
+		address.IsDefaultShipping = input.IsDefaultShipping
+		address.IsDefaultBilling = input.IsDefaultBilling
+		if err := clearDefaults(tx, address); err != nil {
+			return err
+		}
+		return tx.Save(address).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return address, nil
+}
+
+// DeleteAddress removes one of the user's addresses
+func (s *AddressService) DeleteAddress(ctx context.Context, userID, id uint) error {
+	ctx, span := tracing.Start(ctx, "AddressService.DeleteAddress")
+	defer span.End()
+
+	result := config.DB.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.Address{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+// CheckoutAddresses resolves the addresses of an order. Without a shipping
+// address ID the default shipping address is used; without a billing
+// address ID the default billing address, and failing that the shipping
+// address.
+func (s *AddressService) CheckoutAddresses(ctx context.Context, userID, shippingID, billingID uint) (shipping, billing domain.PostalAddress, err error) {
+	db := config.DB.WithContext(ctx)
+
+	shippingAddress, err := checkoutAddress(db, userID, shippingID, "is_default_shipping", "shipping_address_id")
+	if err != nil {
+		return shipping, billing, err
+	}
+	if shippingAddress == nil {
+		return shipping, billing, ErrShippingAddressRequired
+	}
+
+	billingAddress, err := checkoutAddress(db, userID, billingID, "is_default_billing", "billing_address_id")
+	if err != nil {
+		return shipping, billing, err
+	}
+	if billingAddress == nil {
+		billingAddress = shippingAddress
+	}
+	return shippingAddress.PostalAddress, billingAddress.PostalAddress, nil
+}
+
+// checkoutAddress loads the address chosen by id, or the user's default
+// marked by defaultColumn when id is zero. It returns nil when the user has
+// no default.
+func checkoutAddress(db *gorm.DB, userID, id uint, defaultColumn, field string) (*domain.Address, error) {
+	if id != 0 {
+		address, err := findAddress(db, userID, id)
+		if errors.Is(err, ErrAddressNotFound) {
+			return nil, invalidField(field, "not_found", "is not one of your addresses")
+		}
+		return address, err
+	}
+
+	var address domain.Address
+	err := db.Where("user_id = ? AND "+defaultColumn, userID).First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+func findAddress(db *gorm.DB, userID, id uint) (*domain.Address, error) {
+	var address domain.Address
+	err := db.Where("user_id = ?", userID).First(&address, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// clearDefaults unsets the default flags of the user's other addresses for
+// each flag set on address
+func clearDefaults(tx *gorm.DB, address *domain.Address) error {
+	for column, isDefault := range map[string]bool{
+		"is_default_shipping": address.IsDefaultShipping,
+		"is_default_billing":  address.IsDefaultBilling,
+	} {
+		if !isDefault {
+			continue
+		}
+		if err := tx.Model(&domain.Address{}).
+			Where("user_id = ? AND id <> ? AND "+column, address.UserID, address.ID).
+			Update(column, false).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeAddress trims the fields of an address, upper-cases its country
+// and checks its postcode against the country's format
+func normalizeAddress(a *domain.PostalAddress) error {
+	for _, field := range []*string{&a.Name, &a.Line1, &a.Line2, &a.City, &a.Region, &a.Phone} {
+		*field = strings.TrimSpace(*field)
+	}
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+
+	var fields []FieldError
+	for _, required := range []struct{ name, value string }{
+		{"name", a.Name}, {"line1", a.Line1}, {"city", a.City},
+	} {
+		if required.value == "" {
+			fields = append(fields, FieldError{Field: required.name, Code: "required", Message: "is required"})
+		}
+	}
+
+	if !countryCode.MatchString(a.Country) {
+		fields = append(fields, FieldError{Field: "country", Code: "iso3166_1_alpha2", Message: "must be a two-letter ISO 3166-1 country code"})
+	} else {
+		normalized, err := postcode.Validate(a.Country, a.Postcode)
+		switch {
+		case errors.Is(err, postcode.ErrRequired):
+			fields = append(fields, FieldError{Field: "postcode", Code: "required", Message: "is required for " + a.Country})
+		case err != nil:
+			fields = append(fields, FieldError{Field: "postcode", Code: "invalid", Message: "is not a valid postcode for " + a.Country})
+		default:
+			a.Postcode = normalized
+		}
+	}
+
+	if len(fields) > 0 {
+		return Validation("validation_failed", "One or more fields are invalid", fields...)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestNormalizeAddress(t *testing.T) {
+	address := domain.PostalAddress{
+		Name:     "  Ana Lima ",
+		Line1:    "10 Downing St",
+		City:     "London",
+		Postcode: "sw1a2aa",
+		Country:  "gb",
+	}
+	if err := normalizeAddress(&address); err != nil {
+		t.Fatalf("Expected a valid address, got %v", err)
+	}
+	if address.Name != "Ana Lima" || address.Country != "GB" || address.Postcode != "SW1A 2AA" {
+		t.Errorf("Expected a normalised address, got %+v", address)
+	}
+}
+
+func TestNormalizeAddress_RejectsInvalidFields(t *testing.T) {
+	tests := []struct {
+		address domain.PostalAddress
+		field   string
+		code    string
+	}{
+		{domain.PostalAddress{Line1: "1 Market St", City: "San Francisco", Postcode: "94105", Country: "US"}, "name", "required"},
+		{domain.PostalAddress{Name: "Ana", Line1: "1 Market St", City: "San Francisco", Postcode: "9410", Country: "US"}, "postcode", "invalid"},
+		{domain.PostalAddress{Name: "Ana", Line1: "Unter den Linden 1", City: "Berlin", Country: "DE"}, "postcode", "required"},
+		{domain.PostalAddress{Name: "Ana", Line1: "1 Market St", City: "San Francisco", Postcode: "94105", Country: "USA"}, "country", "iso3166_1_alpha2"},
+	}
+
+	for _, tt := range tests {
+		err := normalizeAddress(&tt.address)
+		var fields []FieldError
+		if e, ok := err.(*Error); ok {
+			fields = e.Fields
+		}
+		if len(fields) != 1 || fields[0].Field != tt.field || fields[0].Code != tt.code {
+			t.Errorf("%+v: expected %s %s, got %v", tt.address, tt.field, tt.code, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinimumAge is used when no minimum drinking age is configured
+const DefaultMinimumAge = 18
+
+// AgePolicy holds the minimum legal drinking age per shipping country
+type AgePolicy struct {
+	DefaultAge int
+	ByCountry  map[string]int // keyed by upper-case ISO 3166-1 alpha-2 code
+}
+
+// NewAgePolicy builds the policy from a default age and per-country ages
+// keyed by ISO 3166-1 alpha-2 code in any case
+func NewAgePolicy(defaultAge int, byCountry map[string]int) (*AgePolicy, error) {
+	if defaultAge <= 0 {
+		return nil, fmt.Errorf("invalid minimum drinking age %d", defaultAge)
+	}
+	policy := &AgePolicy{
+		DefaultAge: defaultAge,
+		ByCountry:  make(map[string]int, len(byCountry)),
+	}
+	for country, age := range byCountry {
+		if age <= 0 {
+			return nil, fmt.Errorf("invalid minimum age %d for %s", age, country)
+		}
+		policy.ByCountry[strings.ToUpper(strings.TrimSpace(country))] = age
+	}
+	return policy, nil
+}
+
+// ParseAgePolicy parses a default age and a comma-separated list of COUNTRY:AGE pairs
+func ParseAgePolicy(defaultAge, byCountry string) (*AgePolicy, error) {
+	age := DefaultMinimumAge
+	if defaultAge != "" {
+		var err error
+		if age, err = strconv.Atoi(defaultAge); err != nil {
+			return nil, fmt.Errorf("invalid minimum drinking age %q", defaultAge)
+		}
+	}
+
+	ages := make(map[string]int)
+	for _, pair := range strings.Split(byCountry, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		country, ageStr, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid country age rule %q", pair)
+		}
+		countryAge, err := strconv.Atoi(strings.TrimSpace(ageStr))
+		if err != nil {
+			return nil, fmt.Errorf("invalid minimum age in rule %q", pair)
+		}
+		ages[country] = countryAge
+	}
+
+	return NewAgePolicy(age, ages)
+}
+
+// MinimumAgeFor returns the minimum drinking age for a shipping country
+func (p *AgePolicy) MinimumAgeFor(country string) int {
+	if age, ok := p.ByCountry[strings.ToUpper(strings.TrimSpace(country))]; ok {
+		return age
+	}
+	return p.DefaultAge
+}
+
+// LowestMinimumAge returns the lowest age at which any destination allows purchase
+func (p *AgePolicy) LowestMinimumAge() int {
+	lowest := p.DefaultAge
+	for _, age := range p.ByCountry {
+		if age < lowest {
+			lowest = age
+		}
+	}
+	return lowest
+}
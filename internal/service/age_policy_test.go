@@ -0,0 +1,60 @@
+package service
+
+import "testing"
+
+func TestParseAgePolicy(t *testing.T) {
+	policy, err := ParseAgePolicy("18", "US:21, jp:20,KR:19")
+	if err != nil {
+		t.Fatalf("ParseAgePolicy failed: %v", err)
+	}
+
+	tests := []struct {
+		country string
+		want    int
+	}{
+		{"US", 21},
+		{"us", 21},
+		{"JP", 20},
+		{"KR", 19},
+		{"FR", 18},
+		{"", 18},
+	}
+
+	for _, tt := range tests {
+		if got := policy.MinimumAgeFor(tt.country); got != tt.want {
+			t.Errorf("MinimumAgeFor(%q) = %d, want %d", tt.country, got, tt.want)
+		}
+	}
+}
+
+func TestParseAgePolicy_Defaults(t *testing.T) {
+	policy, err := ParseAgePolicy("", "")
+	if err != nil {
+		t.Fatalf("ParseAgePolicy failed: %v", err)
+	}
+	if policy.DefaultAge != DefaultMinimumAge {
+		t.Errorf("DefaultAge = %d, want %d", policy.DefaultAge, DefaultMinimumAge)
+	}
+}
+
+func TestParseAgePolicy_Invalid(t *testing.T) {
+	inputs := [][2]string{
+		{"abc", ""},
+		{"-1", ""},
+		{"18", "US"},
+		{"18", "US:old"},
+	}
+
+	for _, in := range inputs {
+		if _, err := ParseAgePolicy(in[0], in[1]); err == nil {
+			t.Errorf("ParseAgePolicy(%q, %q) should fail", in[0], in[1])
+		}
+	}
+}
+
+func TestAgePolicy_LowestMinimumAge(t *testing.T) {
+	policy, _ := ParseAgePolicy("18", "US:21,DE:16")
+	if got := policy.LowestMinimumAge(); got != 16 {
+		t.Errorf("LowestMinimumAge() = %d, want 16", got)
+	}
+}
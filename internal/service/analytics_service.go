@@ -1,14 +1,25 @@
 package service
 
 import (
+	"context"
+	"sort"
 	"time"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
 )
 
 type AnalyticsService struct{}
 
+// unpaidOrderStatuses are excluded from revenue: pending orders have not been
+// paid yet and cancelled ones never will be
+var unpaidOrderStatuses = []string{domain.OrderStatusPending, domain.OrderStatusCancelled}
+
+// orderRevenue is what an order earned for its wine. Shipping is excluded,
+// like it is from refunds, which cover returned items only.
+const orderRevenue = "total - shipping_cost"
+
 // DashboardStats contains overview statistics
 type DashboardStats struct {
 	TotalRevenue   float64 `json:"total_revenue"`
@@ -50,33 +61,49 @@ type RecentOrder struct {
 }
 
 // GetDashboardStats returns overview statistics
-func (s *AnalyticsService) GetDashboardStats() (*DashboardStats, error) {
+func (s *AnalyticsService) GetDashboardStats(ctx context.Context) (*DashboardStats, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetDashboardStats")
+	defer span.End()
+
 	var stats DashboardStats
 
-	// Total revenue from orders
-	config.DB.Model(&domain.Order{}).
-		Select("COALESCE(SUM(total), 0)").
+	// Total revenue from paid orders, less refunds
+	config.DB.WithContext(ctx).Model(&domain.Order{}).
+		Select("COALESCE(SUM("+orderRevenue+"), 0)").
+		Where("status NOT IN ?", unpaidOrderStatuses).
 		Scan(&stats.TotalRevenue)
 
+	var refunded float64
+	config.DB.WithContext(ctx).Model(&domain.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("status = ?", domain.RefundStatusSucceeded).
+		Scan(&refunded)
+	stats.TotalRevenue -= refunded
+
 	// Total orders
-	config.DB.Model(&domain.Order{}).Count(&stats.TotalOrders)
+	config.DB.WithContext(ctx).Model(&domain.Order{}).Count(&stats.TotalOrders)
 
 	// Total products
-	config.DB.Model(&domain.Product{}).Count(&stats.TotalProducts)
+	config.DB.WithContext(ctx).Model(&domain.Product{}).Count(&stats.TotalProducts)
 
 	// Total customers
-	config.DB.Model(&domain.User{}).Where("role = ?", "customer").Count(&stats.TotalCustomers)
+	config.DB.WithContext(ctx).Model(&domain.User{}).Where("role = ?", "customer").Count(&stats.TotalCustomers)
 
 	return &stats, nil
 }
 
 // GetSalesByCategory returns sales grouped by wine category
-func (s *AnalyticsService) GetSalesByCategory() ([]SalesByCategory, error) {
+func (s *AnalyticsService) GetSalesByCategory(ctx context.Context) ([]SalesByCategory, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetSalesByCategory")
+	defer span.End()
+
 	var results []SalesByCategory
 
-	config.DB.Table("order_items").
+	config.DB.WithContext(ctx).Table("order_items").
 		Select("products.category, SUM(order_items.price * order_items.quantity) as revenue, COUNT(*) as count").
 		Joins("JOIN products ON products.id = order_items.product_id").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status NOT IN ?", unpaidOrderStatuses).
 		Group("products.category").
 		Order("revenue DESC").
 		Scan(&results)
@@ -85,12 +112,17 @@ func (s *AnalyticsService) GetSalesByCategory() ([]SalesByCategory, error) {
 }
 
 // GetTopProducts returns top selling products
-func (s *AnalyticsService) GetTopProducts(limit int) ([]TopProduct, error) {
+func (s *AnalyticsService) GetTopProducts(ctx context.Context, limit int) ([]TopProduct, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetTopProducts")
+	defer span.End()
+
 	var results []TopProduct
 
-	config.DB.Table("order_items").
+	config.DB.WithContext(ctx).Table("order_items").
 		Select("products.id, products.name, SUM(order_items.quantity) as quantity, SUM(order_items.price * order_items.quantity) as revenue").
 		Joins("JOIN products ON products.id = order_items.product_id").
+		Joins("JOIN orders ON orders.id = order_items.order_id").
+		Where("orders.status NOT IN ?", unpaidOrderStatuses).
 		Group("products.id, products.name").
 		Order("quantity DESC").
 		Limit(limit).
@@ -99,16 +131,21 @@ func (s *AnalyticsService) GetTopProducts(limit int) ([]TopProduct, error) {
 	return results, nil
 }
 
-// GetSalesByDay returns daily sales for the last N days
-func (s *AnalyticsService) GetSalesByDay(days int) ([]SalesByDay, error) {
+// GetSalesByDay returns daily sales for the last N days. Refunds count as
+// negative revenue on the day they were made, so a day can have refunds but
+// no orders.
+func (s *AnalyticsService) GetSalesByDay(ctx context.Context, days int) ([]SalesByDay, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetSalesByDay")
+	defer span.End()
+
 	// Initialize as empty slice to return [] instead of null in JSON
 	results := []SalesByDay{}
 
 	startDate := time.Now().AddDate(0, 0, -days)
 
-	err := config.DB.Table("orders").
-		Select("TO_CHAR(created_at, 'YYYY-MM-DD') as date, COALESCE(SUM(total), 0) as revenue, COUNT(*) as orders").
-		Where("created_at >= ?", startDate).
+	err := config.DB.WithContext(ctx).Table("orders").
+		Select("TO_CHAR(created_at, 'YYYY-MM-DD') as date, COALESCE(SUM("+orderRevenue+"), 0) as revenue, COUNT(*) as orders").
+		Where("created_at >= ? AND status NOT IN ?", startDate, unpaidOrderStatuses).
 		Group("TO_CHAR(created_at, 'YYYY-MM-DD')").
 		Order("date ASC").
 		Scan(&results).Error
@@ -117,15 +154,53 @@ func (s *AnalyticsService) GetSalesByDay(days int) ([]SalesByDay, error) {
 		return []SalesByDay{}, err
 	}
 
-	return results, nil
+	var refunds []SalesByDay
+	err = config.DB.WithContext(ctx).Table("refunds").
+		Select("TO_CHAR(created_at, 'YYYY-MM-DD') as date, SUM(amount) as revenue").
+		Where("created_at >= ? AND status = ? AND deleted_at IS NULL", startDate, domain.RefundStatusSucceeded).
+		Group("TO_CHAR(created_at, 'YYYY-MM-DD')").
+		Scan(&refunds).Error
+
+	if err != nil {
+		return []SalesByDay{}, err
+	}
+
+	return subtractRefunds(results, refunds), nil
+}
+
+// subtractRefunds takes each day's refunded amount off that day's revenue,
+// adding days that only had refunds, and keeps the days in order
+func subtractRefunds(sales, refunds []SalesByDay) []SalesByDay {
+	if len(refunds) == 0 {
+		return sales
+	}
+
+	index := make(map[string]int, len(sales))
+	for i, day := range sales {
+		index[day.Date] = i
+	}
+	for _, refund := range refunds {
+		if i, ok := index[refund.Date]; ok {
+			sales[i].Revenue -= refund.Revenue
+			continue
+		}
+		index[refund.Date] = len(sales)
+		sales = append(sales, SalesByDay{Date: refund.Date, Revenue: -refund.Revenue})
+	}
+
+	sort.Slice(sales, func(i, j int) bool { return sales[i].Date < sales[j].Date })
+	return sales
 }
 
 // GetRecentOrders returns the most recent orders
-func (s *AnalyticsService) GetRecentOrders(limit int) ([]RecentOrder, error) {
+func (s *AnalyticsService) GetRecentOrders(ctx context.Context, limit int) ([]RecentOrder, error) {
+	ctx, span := tracing.Start(ctx, "AnalyticsService.GetRecentOrders")
+	defer span.End()
+
 	var orders []domain.Order
 	var results []RecentOrder
 
-	config.DB.Preload("Items").
+	config.DB.WithContext(ctx).Preload("Items").
 		Order("created_at DESC").
 		Limit(limit).
 		Find(&orders)
@@ -134,7 +209,7 @@ func (s *AnalyticsService) GetRecentOrders(limit int) ([]RecentOrder, error) {
 		// Get user email
 		var user domain.User
 		email := ""
-		if err := config.DB.First(&user, order.UserID).Error; err == nil {
+		if err := config.DB.WithContext(ctx).First(&user, order.UserID).Error; err == nil {
 			email = user.Email
 		}
 
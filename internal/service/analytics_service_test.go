@@ -0,0 +1,34 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubtractRefunds(t *testing.T) {
+	sales := []SalesByDay{
+		{Date: "2026-03-01", Revenue: 100, Orders: 2},
+		{Date: "2026-03-03", Revenue: 80, Orders: 1},
+	}
+	refunds := []SalesByDay{
+		{Date: "2026-03-03", Revenue: 30},
+		{Date: "2026-03-02", Revenue: 45},
+	}
+
+	got := subtractRefunds(sales, refunds)
+	want := []SalesByDay{
+		{Date: "2026-03-01", Revenue: 100, Orders: 2},
+		{Date: "2026-03-02", Revenue: -45},
+		{Date: "2026-03-03", Revenue: 50, Orders: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
+
+func TestSubtractRefunds_NoRefunds(t *testing.T) {
+	sales := []SalesByDay{{Date: "2026-03-01", Revenue: 100, Orders: 2}}
+	if got := subtractRefunds(sales, nil); !reflect.DeepEqual(got, sales) {
+		t.Errorf("Expected sales unchanged, got %+v", got)
+	}
+}
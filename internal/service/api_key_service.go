@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+)
+
+// DefaultAPIKeyRateLimit is the per-key limit in requests per minute when none is set
+const DefaultAPIKeyRateLimit = 120
+
+// lastUsedResolution limits how often last-used tracking writes to the database
+const lastUsedResolution = time.Minute
+
+var (
+	ErrInvalidAPIKey  = Unauthorized("invalid_api_key", "invalid, expired or revoked API key")
+	ErrAPIKeyNotFound = NotFound("api_key_not_found", "API key not found")
+)
+
+type APIKeyService struct{}
+
+// CreateAPIKeyInput describes a new API key
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" binding:"required"`
+	UserID    uint       `json:"user_id" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	RateLimit int        `json:"rate_limit" binding:"min=0"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateAPIKey issues a new key and returns it in plain text. The plain key is
+// not stored and cannot be retrieved again.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, input *CreateAPIKeyInput, createdByID uint) (string, *domain.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.CreateAPIKey")
+	defer span.End()
+
+	for _, scope := range input.Scopes {
+		if !domain.IsValidAPIKeyScope(scope) {
+			return "", nil, invalidField("scopes", "invalid_scope", fmt.Sprintf("invalid scope %q", scope))
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return "", nil, invalidField("expires_at", "in_past", "expires_at must be in the future")
+	}
+
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, input.UserID).Error; err != nil {
+		return "", nil, invalidField("user_id", "not_found", "user not found")
+	}
+
+	prefix, err := randomToken(6)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix = domain.APIKeyPrefix + prefix
+	plainKey := prefix + "." + secret
+
+	key := domain.APIKey{
+		Name:        strings.TrimSpace(input.Name),
+		UserID:      user.ID,
+		Prefix:      prefix,
+		KeyHash:     hashAPIKey(plainKey),
+		Scopes:      input.Scopes,
+		RateLimit:   input.RateLimit,
+		ExpiresAt:   input.ExpiresAt,
+		CreatedByID: createdByID,
+	}
+	if err := config.DB.WithContext(ctx).Create(&key).Error; err != nil {
+		return "", nil, err
+	}
+
+	return plainKey, &key, nil
+}
+
+// GetAPIKeys lists all API keys, newest first
+func (s *APIKeyService) GetAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.GetAPIKeys")
+	defer span.End()
+
+	keys := []domain.APIKey{}
+	if err := config.DB.WithContext(ctx).Order("created_at desc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey permanently disables a key
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "APIKeyService.RevokeAPIKey")
+	defer span.End()
+
+	var key domain.APIKey
+	if err := config.DB.WithContext(ctx).First(&key, id).Error; err != nil {
+		return ErrAPIKeyNotFound
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	return config.DB.WithContext(ctx).Model(&key).Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate resolves a plain key to an active API key and records its use
+func (s *APIKeyService) Authenticate(ctx context.Context, plainKey, ipAddress string) (*domain.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Authenticate")
+	defer span.End()
+
+	key, err := s.Lookup(ctx, plainKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution || key.LastUsedIP != ipAddress {
+		config.DB.WithContext(ctx).Model(key).UpdateColumns(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": ipAddress,
+		})
+	}
+
+	return key, nil
+}
+
+// Lookup resolves a plain key to an active API key without recording its use
+func (s *APIKeyService) Lookup(ctx context.Context, plainKey string) (*domain.APIKey, error) {
+	ctx, span := tracing.Start(ctx, "APIKeyService.Lookup")
+	defer span.End()
+
+	if !IsAPIKey(plainKey) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var key domain.APIKey
+	if err := config.DB.WithContext(ctx).Where("key_hash = ?", hashAPIKey(plainKey)).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if !key.IsActive(time.Now()) {
+		return nil, ErrInvalidAPIKey
+	}
+	return &key, nil
+}
+
+// IsAPIKey reports whether a credential looks like an API key rather than a JWT
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, domain.APIKeyPrefix)
+}
+
+// hashAPIKey returns the SHA-256 hash stored for a key. Keys are 256-bit
+// random values, so a fast hash is sufficient.
+func hashAPIKey(plainKey string) string {
+	sum := sha256.Sum256([]byte(plainKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+)
+
+type AuditService struct{}
+
+// AuditEntry describes an admin mutation to record
+type AuditEntry struct {
+	ActorID    uint
+	APIKeyID   *uint
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{} // nil for creations
+	After      interface{} // nil for deletions
+	IPAddress  string
+	RequestID  string
+}
+
+// AuditFilter narrows the audit log listing
+type AuditFilter struct {
+	ActorID    uint
+	EntityType string
+	EntityID   string
+	From       *time.Time
+	To         *time.Time
+	Page       int
+	Limit      int
+}
+
+// FieldChange is the before and after value of a changed field
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// AuditVerification is the result of checking the hash chain
+type AuditVerification struct {
+	Valid         bool  `json:"valid"`
+	EntriesCount  int64 `json:"entries_checked"`
+	FirstBrokenID *uint `json:"first_broken_id,omitempty"`
+}
+
+// auditChainLockID serialises appends so each entry links to the latest hash
+const auditChainLockID = 7208430
+
+// EnsureImmutable installs database triggers that reject UPDATE, DELETE and
+// TRUNCATE on the audit log table
+func (s *AuditService) EnsureImmutable(ctx context.Context) error {
+	return config.DB.WithContext(ctx).Exec(`
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_no_modify ON audit_logs;
+CREATE TRIGGER audit_logs_no_modify BEFORE UPDATE OR DELETE ON audit_logs
+	FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs;
+CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only();
+`).Error
+}
+
+// Record appends an entry to the hash chain
+func (s *AuditService) Record(ctx context.Context, entry AuditEntry) (*domain.AuditLog, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Record")
+	defer span.End()
+
+	before, err := marshalAuditState(entry.Before)
+	if err != nil {
+		return nil, err
+	}
+	after, err := marshalAuditState(entry.After)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := json.Marshal(DiffJSON([]byte(before), []byte(after)))
+	if err != nil {
+		return nil, err
+	}
+
+	log := domain.AuditLog{
+		// Postgres stores microseconds; truncate so the hash survives a round trip
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		ActorID:    entry.ActorID,
+		APIKeyID:   entry.APIKeyID,
+		Action:     entry.Action,
+		EntityType: entry.EntityType,
+		EntityID:   entry.EntityID,
+		Before:     before,
+		After:      after,
+		Changes:    domain.RawJSON(changes),
+		IPAddress:  entry.IPAddress,
+		RequestID:  entry.RequestID,
+	}
+
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLockID).Error; err != nil {
+			return err
+		}
+
+		var last domain.AuditLog
+		err := tx.Order("id desc").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+
+		log.PrevHash = last.Hash
+		log.Hash = log.ComputeHash()
+		return tx.Create(&log).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &log, nil
+}
+
+// GetAuditLogs returns audit entries matching the filter, newest first
+func (s *AuditService) GetAuditLogs(ctx context.Context, filter AuditFilter) ([]domain.AuditLog, int64, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetAuditLogs")
+	defer span.End()
+
+	logs := []domain.AuditLog{}
+	var total int64
+
+	query := auditQuery(ctx, filter)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (filter.Page - 1) * filter.Limit
+	if err := query.Order("id desc").Limit(filter.Limit).Offset(offset).Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// ExportAuditLogs calls fn for every entry matching the filter, oldest first.
+// Paging fields are ignored.
+func (s *AuditService) ExportAuditLogs(ctx context.Context, filter AuditFilter, fn func(domain.AuditLog) error) error {
+	ctx, span := tracing.Start(ctx, "AuditService.ExportAuditLogs")
+	defer span.End()
+
+	var batch []domain.AuditLog
+	return auditQuery(ctx, filter).Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, entry := range batch {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func auditQuery(ctx context.Context, filter AuditFilter) *gorm.DB {
+	query := config.DB.WithContext(ctx).Model(&domain.AuditLog{})
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		query = query.Where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// VerifyChain recomputes every hash in the audit log
+func (s *AuditService) VerifyChain(ctx context.Context) (*AuditVerification, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.VerifyChain")
+	defer span.End()
+
+	result := &AuditVerification{Valid: true}
+	prevHash := ""
+
+	var batch []domain.AuditLog
+	err := config.DB.WithContext(ctx).Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		brokenID, ok := domain.VerifyAuditChain(prevHash, batch)
+		result.EntriesCount += int64(len(batch))
+		if !ok {
+			result.Valid = false
+			result.FirstBrokenID = &brokenID
+			return errors.New("chain broken")
+		}
+		prevHash = batch[len(batch)-1].Hash
+		return nil
+	}).Error
+	if err != nil && result.Valid {
+		return nil, err
+	}
+	return result, nil
+}
+
+func marshalAuditState(state interface{}) (domain.RawJSON, error) {
+	if state == nil {
+		return "", nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	return domain.RawJSON(b), nil
+}
+
+// DiffJSON compares two JSON objects and returns the top-level fields whose
+// values differ. Either side may be empty for creations and deletions.
+func DiffJSON(before, after []byte) map[string]FieldChange {
+	var b, a map[string]json.RawMessage
+	if len(before) > 0 {
+		json.Unmarshal(before, &b)
+	}
+	if len(after) > 0 {
+		json.Unmarshal(after, &a)
+	}
+
+	null := json.RawMessage("null")
+	changes := make(map[string]FieldChange)
+	for key, bv := range b {
+		av, ok := a[key]
+		if !ok {
+			changes[key] = FieldChange{Before: bv, After: null}
+		} else if !jsonEqual(bv, av) {
+			changes[key] = FieldChange{Before: bv, After: av}
+		}
+	}
+	for key, av := range a {
+		if _, ok := b[key]; !ok {
+			changes[key] = FieldChange{Before: null, After: av}
+		}
+	}
+	return changes
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return bytes.Equal(a, b)
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
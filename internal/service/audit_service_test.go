@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestDiffJSON_Update(t *testing.T) {
+	before := []byte(`{"name":"Merlot","price":20,"stock":5,"updated_at":"a"}`)
+	after := []byte(`{"name":"Merlot","price":25, "stock":5,"updated_at":"b"}`)
+
+	changes := DiffJSON(before, after)
+
+	if _, ok := changes["name"]; ok {
+		t.Error("Unchanged field should not be reported")
+	}
+	if _, ok := changes["stock"]; ok {
+		t.Error("Whitespace differences should not be reported as changes")
+	}
+	price, ok := changes["price"]
+	if !ok {
+		t.Fatal("Changed price should be reported")
+	}
+	if string(price.Before) != "20" || string(price.After) != "25" {
+		t.Errorf("Unexpected price change: %s -> %s", price.Before, price.After)
+	}
+}
+
+func TestDiffJSON_CreateAndDelete(t *testing.T) {
+	created := DiffJSON(nil, []byte(`{"name":"Merlot"}`))
+	if c, ok := created["name"]; !ok || string(c.Before) != "null" {
+		t.Errorf("Creation should report fields with null before, got %+v", created)
+	}
+
+	deleted := DiffJSON([]byte(`{"name":"Merlot"}`), nil)
+	if c, ok := deleted["name"]; !ok || string(c.After) != "null" {
+		t.Errorf("Deletion should report fields with null after, got %+v", deleted)
+	}
+}
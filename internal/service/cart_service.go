@@ -1,25 +1,34 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
 	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
 
 	"gorm.io/gorm"
 )
 
+var ErrInsufficientStock = InsufficientStock("insufficient_stock", "not enough stock")
+
 type CartService struct{}
 
-func (s *CartService) GetCart(userID uint) (*domain.Cart, error) {
+func (s *CartService) GetCart(ctx context.Context, userID uint) (*domain.Cart, error) {
+	ctx, span := tracing.Start(ctx, "CartService.GetCart")
+	defer span.End()
+
 	var cart domain.Cart
 	// Find cart for user, preload items and their products
-	err := config.DB.Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
+	err := config.DB.WithContext(ctx).Preload("Items.Product").Where("user_id = ?", userID).First(&cart).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			// Create a new cart if one doesn't exist
 			cart = domain.Cart{UserID: userID}
-			if err := config.DB.Create(&cart).Error; err != nil {
+			if err := config.DB.WithContext(ctx).Create(&cart).Error; err != nil {
 				return nil, err
 			}
 			return &cart, nil
@@ -29,26 +38,36 @@ func (s *CartService) GetCart(userID uint) (*domain.Cart, error) {
 	return &cart, nil
 }
 
-func (s *CartService) AddToCart(userID uint, productID uint, quantity int) error {
-	cart, err := s.GetCart(userID)
+func (s *CartService) AddToCart(ctx context.Context, userID uint, productID uint, quantity int) error {
+	ctx, span := tracing.Start(ctx, "CartService.AddToCart")
+	defer span.End()
+
+	cart, err := s.GetCart(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	// Check if product exists
 	var product domain.Product
-	if err := config.DB.First(&product, productID).Error; err != nil {
-		return errors.New("product not found")
+	if err := config.DB.WithContext(ctx).First(&product, productID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		return err
 	}
 
 	// Check if item already exists in cart
 	var cartItem domain.CartItem
-	err = config.DB.Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&cartItem).Error
+	err = config.DB.WithContext(ctx).Where("cart_id = ? AND product_id = ?", cart.ID, productID).First(&cartItem).Error
+
+	if cartItem.Quantity+quantity > product.Stock {
+		return insufficientStock(&product)
+	}
 
 	if err == nil {
 		// Update quantity
 		cartItem.Quantity += quantity
-		return config.DB.Save(&cartItem).Error
+		err = config.DB.WithContext(ctx).Save(&cartItem).Error
 	} else if errors.Is(err, gorm.ErrRecordNotFound) {
 		// Create new item
 		newItem := domain.CartItem{
@@ -56,18 +75,30 @@ func (s *CartService) AddToCart(userID uint, productID uint, quantity int) error
 			ProductID: productID,
 			Quantity:  quantity,
 		}
-		return config.DB.Create(&newItem).Error
+		err = config.DB.WithContext(ctx).Create(&newItem).Error
+	}
+	if err != nil {
+		return err
 	}
 
-	return err
+	metrics.CartAdds.Inc()
+	return nil
 }
 
-func (s *CartService) ClearCart(userID uint) error {
-	cart, err := s.GetCart(userID)
+// insufficientStock reports how many bottles of product are left
+func insufficientStock(product *domain.Product) *Error {
+	return ErrInsufficientStock.WithMessage(fmt.Sprintf("only %d of %s left in stock", product.Stock, product.Name))
+}
+
+func (s *CartService) ClearCart(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "CartService.ClearCart")
+	defer span.End()
+
+	cart, err := s.GetCart(ctx, userID)
 	if err != nil {
 		return err
 	}
 
 	// Delete all items in the cart
-	return config.DB.Where("cart_id = ?", cart.ID).Delete(&domain.CartItem{}).Error
+	return config.DB.WithContext(ctx).Where("cart_id = ?", cart.ID).Delete(&domain.CartItem{}).Error
 }
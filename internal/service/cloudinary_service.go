@@ -3,77 +3,79 @@ package service
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"mime/multipart"
-	"os"
 
 	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/tracing"
 )
 
 type CloudinaryService struct {
 	cld *cloudinary.Cloudinary
 }
 
-func NewCloudinaryService() (*CloudinaryService, error) {
+func NewCloudinaryService(cfg config.CloudinaryConfig) (*CloudinaryService, error) {
 	var cld *cloudinary.Cloudinary
 	var err error
 
 	// Try CLOUDINARY_URL first (recommended by Cloudinary)
-	cloudinaryURL := os.Getenv("CLOUDINARY_URL")
-	if cloudinaryURL != "" {
-		log.Printf("Initializing Cloudinary from CLOUDINARY_URL")
-		cld, err = cloudinary.NewFromURL(cloudinaryURL)
+	if cfg.URL != "" {
+		cld, err = cloudinary.NewFromURL(cfg.URL)
 		if err != nil {
-			log.Printf("Failed to create Cloudinary client from URL: %v", err)
 			return nil, err
 		}
-		log.Println("Cloudinary initialized successfully from URL")
+		slog.Info("cloudinary initialized", "source", "CLOUDINARY_URL")
 		return &CloudinaryService{cld: cld}, nil
 	}
 
-	// Fallback to separate env vars
-	cloudName := os.Getenv("CLOUDINARY_CLOUD_NAME")
-	apiKey := os.Getenv("CLOUDINARY_API_KEY")
-	apiSecret := os.Getenv("CLOUDINARY_API_SECRET")
-
-	if cloudName == "" || apiKey == "" || apiSecret == "" {
-		log.Printf("Cloudinary credentials missing")
+	// Fallback to separate credentials
+	if cfg.CloudName == "" || cfg.APIKey == "" || cfg.APISecret == "" {
 		return nil, errors.New("cloudinary credentials not configured")
 	}
 
-	log.Printf("Initializing Cloudinary with cloud_name: %s", cloudName)
-	cld, err = cloudinary.NewFromParams(cloudName, apiKey, apiSecret)
+	cld, err = cloudinary.NewFromParams(cfg.CloudName, cfg.APIKey, cfg.APISecret)
 	if err != nil {
-		log.Printf("Failed to create Cloudinary client: %v", err)
 		return nil, err
 	}
 
-	log.Println("Cloudinary initialized successfully")
+	slog.Info("cloudinary initialized", "cloud_name", cfg.CloudName)
 	return &CloudinaryService{cld: cld}, nil
 }
 
 // UploadImage uploads an image to Cloudinary and returns the URL
-func (s *CloudinaryService) UploadImage(file multipart.File, folder string) (string, error) {
-	ctx := context.Background()
-
-	log.Printf("Uploading image to folder: %s", folder)
+func (s *CloudinaryService) UploadImage(ctx context.Context, file multipart.File, folder string) (string, error) {
+	ctx, span := tracing.Start(ctx, "CloudinaryService.UploadImage")
+	defer span.End()
 
+	logger := logging.FromContext(ctx)
 	uploadResult, err := s.cld.Upload.Upload(ctx, file, uploader.UploadParams{
 		Folder: folder,
 	})
 	if err != nil {
-		log.Printf("Cloudinary upload error: %v", err)
+		tracing.RecordError(span, err)
+		logger.ErrorContext(ctx, "cloudinary upload failed", "folder", folder, "error", err)
 		return "", err
 	}
 
-	log.Printf("Upload successful: %s", uploadResult.SecureURL)
+	logger.InfoContext(ctx, "image uploaded", "folder", folder, "url", uploadResult.SecureURL)
 	return uploadResult.SecureURL, nil
 }
 
 // DeleteImage deletes an image from Cloudinary
-func (s *CloudinaryService) DeleteImage(publicID string) error {
-	ctx := context.Background()
+func (s *CloudinaryService) DeleteImage(ctx context.Context, publicID string) error {
+	ctx, span := tracing.Start(ctx, "CloudinaryService.DeleteImage")
+	defer span.End()
+
 	_, err := s.cld.Upload.Destroy(ctx, uploader.DestroyParams{PublicID: publicID})
 	return err
 }
+
+// Ping checks that the Cloudinary API is reachable with these credentials
+func (s *CloudinaryService) Ping(ctx context.Context) error {
+	_, err := s.cld.Admin.Ping(ctx)
+	return err
+}
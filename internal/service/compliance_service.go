@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrShippingRestricted      = Forbidden("shipping_restricted", "this order cannot be shipped to that address")
+	ErrComplianceRulesNotFound = NotFound("compliance_rules_not_found", "compliance rule set not found")
+)
+
+// ComplianceService keeps the versioned alcohol shipping rules and checks
+// orders against them
+type ComplianceService struct{}
+
+// GetCurrentRuleSet returns the latest published rule set, or an empty
+// version 0 when none has been published
+func (s *ComplianceService) GetCurrentRuleSet(ctx context.Context) (*domain.ComplianceRuleSet, error) {
+	ctx, span := tracing.Start(ctx, "ComplianceService.GetCurrentRuleSet")
+	defer span.End()
+
+	var ruleSet domain.ComplianceRuleSet
+	err := config.DB.WithContext(ctx).Order("version DESC").First(&ruleSet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &domain.ComplianceRuleSet{Rules: []domain.ComplianceRule{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ruleSet, nil
+}
+
+// GetRuleSets lists every published version, newest first
+func (s *ComplianceService) GetRuleSets(ctx context.Context) ([]domain.ComplianceRuleSet, error) {
+	ctx, span := tracing.Start(ctx, "ComplianceService.GetRuleSets")
+	defer span.End()
+
+	ruleSets := []domain.ComplianceRuleSet{}
+	if err := config.DB.WithContext(ctx).Order("version DESC").Find(&ruleSets).Error; err != nil {
+		return nil, err
+	}
+	return ruleSets, nil
+}
+
+// GetRuleSet returns a published version, e.g. the one an order recorded
+func (s *ComplianceService) GetRuleSet(ctx context.Context, version uint) (*domain.ComplianceRuleSet, error) {
+	ctx, span := tracing.Start(ctx, "ComplianceService.GetRuleSet")
+	defer span.End()
+
+	var ruleSet domain.ComplianceRuleSet
+	err := config.DB.WithContext(ctx).Where("version = ?", version).First(&ruleSet).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrComplianceRulesNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &ruleSet, nil
+}
+
+// PublishRuleSet stores rules as the next version, which applies to every
+// checkout from then on
+func (s *ComplianceService) PublishRuleSet(ctx context.Context, ruleSet *domain.ComplianceRuleSet) (*domain.ComplianceRuleSet, error) {
+	ctx, span := tracing.Start(ctx, "ComplianceService.PublishRuleSet")
+	defer span.End()
+
+	if err := validateRuleSet(ruleSet); err != nil {
+		return nil, err
+	}
+	ruleSet.ID = 0
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Concurrent publishes wait on the latest version; the unique index
+		// catches a race to publish the very first one
+		var latest domain.ComplianceRuleSet
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("version DESC").First(&latest).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		ruleSet.Version = latest.Version + 1
+		return tx.Create(ruleSet).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ruleSet, nil
+}
+
+// Check evaluates shipment to dest against the current rule set. When a
+// rule is broken it returns ErrShippingRestricted with one entry per
+// violation, alongside the check.
+func (s *ComplianceService) Check(ctx context.Context, dest domain.PostalAddress, shipment Shipment) (*domain.ComplianceCheck, error) {
+	ctx, span := tracing.Start(ctx, "ComplianceService.Check")
+	defer span.End()
+
+	ruleSet, err := s.GetCurrentRuleSet(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	check := ruleSet.Evaluate(dest, shipment.Bottles, shipment.VolumeML)
+	if len(check.Violations) > 0 {
+		for _, violation := range check.Violations {
+			metrics.ComplianceBlocks.WithLabelValues(violation.Code).Inc()
+		}
+		return &check, ErrShippingRestricted.WithFields(violationFields(check.Violations)...)
+	}
+	return &check, nil
+}
+
+// violationFields reports destination violations against the shipping
+// address and limits against the cart's items
+func violationFields(violations []domain.ComplianceViolation) []FieldError {
+	fields := make([]FieldError, 0, len(violations))
+	for _, v := range violations {
+		field := "shipping_address_id"
+		if v.Code == domain.ComplianceMaxBottlesExceeded || v.Code == domain.ComplianceMaxLitresExceeded {
+			field = "items"
+		}
+		fields = append(fields, FieldError{Field: field, Code: v.Code, Message: v.Message})
+	}
+	return fields
+}
+
+func validateRuleSet(rs *domain.ComplianceRuleSet) error {
+	var fields []FieldError
+	rs.Note = strings.TrimSpace(rs.Note)
+	if rs.Rules == nil {
+		rs.Rules = []domain.ComplianceRule{}
+	}
+
+	for i := range rs.Rules {
+		r := &rs.Rules[i]
+		prefix := fmt.Sprintf("rules[%d].", i)
+
+		r.Name = strings.TrimSpace(r.Name)
+		if r.Name == "" {
+			fields = append(fields, FieldError{Field: prefix + "name", Code: "required", Message: "is required"})
+		}
+		r.Message = strings.TrimSpace(r.Message)
+
+		switch r.Kind {
+		case domain.ComplianceRuleDeny, domain.ComplianceRuleAllow:
+			if len(r.Countries) == 0 {
+				fields = append(fields, FieldError{Field: prefix + "countries", Code: "required", Message: "is required for " + r.Kind + " rules"})
+			}
+		case domain.ComplianceRuleLimit:
+			if r.MaxBottles == 0 && r.MaxLitres == 0 {
+				fields = append(fields, FieldError{Field: prefix + "max_bottles", Code: "required", Message: "limit rules need max_bottles or max_litres"})
+			}
+		case domain.ComplianceRuleAdultSignature:
+		default:
+			fields = append(fields, FieldError{Field: prefix + "kind", Code: "oneof", Message: "must be one of deny allow limit adult_signature"})
+		}
+		if r.MaxBottles < 0 {
+			fields = append(fields, FieldError{Field: prefix + "max_bottles", Code: "min", Message: "must be at least 0"})
+		}
+		if r.MaxLitres < 0 {
+			fields = append(fields, FieldError{Field: prefix + "max_litres", Code: "min", Message: "must be at least 0"})
+		}
+
+		if len(r.Countries) == 0 && (len(r.Regions) > 0 || len(r.PostcodeRanges) > 0) {
+			fields = append(fields, FieldError{Field: prefix + "countries", Code: "required", Message: "is required with regions or postcode_ranges"})
+		}
+		fields = append(fields, normalizeArea(prefix, r.Countries, r.PostcodeRanges)...)
+	}
+
+	if len(fields) > 0 {
+		return Validation("validation_failed", "One or more fields are invalid", fields...)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestValidateRuleSet(t *testing.T) {
+	ruleSet := domain.ComplianceRuleSet{
+		Note: " Utah ban ",
+		Rules: []domain.ComplianceRule{
+			{Name: " Utah ", Kind: domain.ComplianceRuleDeny, Countries: []string{"us"}, Regions: []string{"UT"}},
+			{Name: "Cap", Kind: domain.ComplianceRuleLimit, MaxLitres: 9},
+			{Name: "Signature", Kind: domain.ComplianceRuleAdultSignature},
+		},
+	}
+	if err := validateRuleSet(&ruleSet); err != nil {
+		t.Fatalf("Expected a valid rule set, got %v", err)
+	}
+	if ruleSet.Note != "Utah ban" || ruleSet.Rules[0].Name != "Utah" || ruleSet.Rules[0].Countries[0] != "US" {
+		t.Errorf("Expected a normalised rule set, got %+v", ruleSet)
+	}
+
+	empty := domain.ComplianceRuleSet{}
+	if err := validateRuleSet(&empty); err != nil || empty.Rules == nil {
+		t.Errorf("Expected an empty rule set to be valid, got %v", err)
+	}
+}
+
+func TestValidateRuleSet_RejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		rule  domain.ComplianceRule
+		field string
+		code  string
+	}{
+		{domain.ComplianceRule{Kind: domain.ComplianceRuleAdultSignature}, "rules[0].name", "required"},
+		{domain.ComplianceRule{Name: "Ban", Kind: "ban", Countries: []string{"US"}}, "rules[0].kind", "oneof"},
+		{domain.ComplianceRule{Name: "Ban", Kind: domain.ComplianceRuleDeny}, "rules[0].countries", "required"},
+		{domain.ComplianceRule{Name: "Allow", Kind: domain.ComplianceRuleAllow, Countries: []string{"USA"}}, "rules[0].countries[0]", "iso3166_1_alpha2"},
+		{domain.ComplianceRule{Name: "Cap", Kind: domain.ComplianceRuleLimit}, "rules[0].max_bottles", "required"},
+		{domain.ComplianceRule{Name: "Cap", Kind: domain.ComplianceRuleLimit, MaxBottles: 12, MaxLitres: -1}, "rules[0].max_litres", "min"},
+		{domain.ComplianceRule{Name: "Signature", Kind: domain.ComplianceRuleAdultSignature, Regions: []string{"CA"}}, "rules[0].countries", "required"},
+		{domain.ComplianceRule{Name: "Ban", Kind: domain.ComplianceRuleDeny, Countries: []string{"US"}, PostcodeRanges: []domain.PostcodeRange{{From: "99", To: "10"}}}, "rules[0].postcode_ranges[0]", "invalid"},
+	}
+
+	for _, tt := range tests {
+		ruleSet := domain.ComplianceRuleSet{Rules: []domain.ComplianceRule{tt.rule}}
+		err := validateRuleSet(&ruleSet)
+		var fields []FieldError
+		if e, ok := err.(*Error); ok {
+			fields = e.Fields
+		}
+		if len(fields) != 1 || fields[0].Field != tt.field || fields[0].Code != tt.code {
+			t.Errorf("%+v: expected %s %s, got %v", tt.rule, tt.field, tt.code, err)
+		}
+	}
+}
+
+func TestViolationFields(t *testing.T) {
+	fields := violationFields([]domain.ComplianceViolation{
+		{Rule: "Ban", Code: domain.ComplianceDestinationDenied, Message: "wine cannot be shipped to UT, US"},
+		{Rule: "Cap", Code: domain.ComplianceMaxLitresExceeded, Message: "orders to US are limited to 9 litres; this order has 13.5"},
+	})
+
+	if len(fields) != 2 || fields[0].Field != "shipping_address_id" || fields[1].Field != "items" || fields[1].Code != "max_litres_exceeded" {
+		t.Errorf("Expected the address and items to be blamed, got %+v", fields)
+	}
+}
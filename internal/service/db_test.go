@@ -0,0 +1,41 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"wine-shop-api/pkg/config"
+)
+
+// useTestDB points config.DB at the Postgres database in TEST_DATABASE_URL
+// and migrates models, or skips the test when it is unset. Tests must clean
+// up the rows they create.
+func useTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("Expected to connect to the test database, got %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("Expected migrations to succeed, got %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() {
+		config.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -0,0 +1,122 @@
+package service
+
+// ErrorKind classifies domain errors. Handlers map each kind to one HTTP
+// status, so services never deal with transport concerns.
+type ErrorKind int
+
+const (
+	KindNotFound ErrorKind = iota + 1
+	KindConflict
+	KindValidation
+	KindInsufficientStock
+	KindForbidden
+	KindUnauthorized
+	// KindLocked is a temporary refusal, e.g. an account locked after failed logins
+	KindLocked
+	// KindUpstream is a failure of an external dependency such as an identity provider
+	KindUpstream
+	// KindPreconditionFailed is a conditional write against a stale version
+	KindPreconditionFailed
+	// KindUnavailable is a feature that is switched off, e.g. payments
+	// without a configured provider
+	KindUnavailable
+)
+
+// FieldError describes why a single input field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a domain error whose Code and Message are safe to return to
+// clients. Err holds the underlying cause for logs and is never shown.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches domain errors by code, so copies made by WithMessage or Wrap
+// still satisfy errors.Is against the original sentinel
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithMessage returns a copy of e with a more specific client message
+func (e *Error) WithMessage(message string) *Error {
+	clone := *e
+	clone.Message = message
+	return &clone
+}
+
+// WithFields returns a copy of e that lists the offending fields
+func (e *Error) WithFields(fields ...FieldError) *Error {
+	clone := *e
+	clone.Fields = fields
+	return &clone
+}
+
+// Wrap returns a copy of e that records err as its cause
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+func NotFound(code, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message}
+}
+
+func Conflict(code, message string) *Error {
+	return &Error{Kind: KindConflict, Code: code, Message: message}
+}
+
+func Validation(code, message string, fields ...FieldError) *Error {
+	return &Error{Kind: KindValidation, Code: code, Message: message, Fields: fields}
+}
+
+func InsufficientStock(code, message string) *Error {
+	return &Error{Kind: KindInsufficientStock, Code: code, Message: message}
+}
+
+func Forbidden(code, message string) *Error {
+	return &Error{Kind: KindForbidden, Code: code, Message: message}
+}
+
+func Unauthorized(code, message string) *Error {
+	return &Error{Kind: KindUnauthorized, Code: code, Message: message}
+}
+
+func PreconditionFailed(code, message string) *Error {
+	return &Error{Kind: KindPreconditionFailed, Code: code, Message: message}
+}
+
+func Unavailable(code, message string) *Error {
+	return &Error{Kind: KindUnavailable, Code: code, Message: message}
+}
+
+// invalidField is a validation error for a single field
+func invalidField(field, code, message string) *Error {
+	return Validation("validation_failed", message, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Errors shared by several services
+var (
+	ErrUserNotFound    = NotFound("user_not_found", "user not found")
+	ErrProductNotFound = NotFound("product_not_found", "product not found")
+)
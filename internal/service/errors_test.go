@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestError_IsMatchesCopiesByCode(t *testing.T) {
+	locked := ErrAccountLocked.WithMessage("account temporarily locked until 2030-01-01T00:00:00Z")
+	if !errors.Is(locked, ErrAccountLocked) {
+		t.Error("Expected a copy with a new message to match its sentinel")
+	}
+	if errors.Is(locked, ErrInvalidCredentials) {
+		t.Error("Expected different codes not to match")
+	}
+
+	cause := errors.New("dial tcp: connection refused")
+	wrapped := ErrOAuthExchangeFailed.Wrap(cause)
+	if !errors.Is(wrapped, ErrOAuthExchangeFailed) || !errors.Is(wrapped, cause) {
+		t.Error("Expected a wrapped error to match both the sentinel and its cause")
+	}
+	if wrapped.Message != ErrOAuthExchangeFailed.Message || ErrOAuthExchangeFailed.Err != nil {
+		t.Error("Expected Wrap to leave the sentinel unchanged")
+	}
+}
+
+func TestValidateDateOfBirth_FieldErrors(t *testing.T) {
+	var err *Error
+	if !errors.As((&UserService{}).validateDateOfBirth(nil), &err) {
+		t.Fatal("Expected a domain error")
+	}
+	if err.Kind != KindValidation || len(err.Fields) != 1 || err.Fields[0].Field != "date_of_birth" || err.Fields[0].Code != "required" {
+		t.Errorf("Expected a date_of_birth required field error, got %+v", err)
+	}
+}
+
+func TestValidateProduct_FieldErrors(t *testing.T) {
+	var err *Error
+	if !errors.As(validateProduct(&domain.Product{Price: -1, Stock: 2}), &err) {
+		t.Fatal("Expected a domain error")
+	}
+	if err.Kind != KindValidation || len(err.Fields) != 2 || err.Fields[0].Field != "name" || err.Fields[1].Field != "price" {
+		t.Errorf("Expected name and price field errors, got %+v", err.Fields)
+	}
+	if validateProduct(&domain.Product{Name: "Merlot"}) != nil {
+		t.Error("Expected a named product with no price or stock to be valid")
+	}
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Health statuses reported by readiness checks
+const (
+	HealthOK           = "ok"
+	HealthDegraded     = "degraded"
+	HealthFailing      = "failing"
+	HealthShuttingDown = "shutting_down"
+)
+
+// DefaultHealthCheckTimeout bounds checks that do not set their own timeout
+const DefaultHealthCheckTimeout = 2 * time.Second
+
+// HealthCheck probes one dependency. Optional checks are reported but only
+// degrade readiness instead of failing it.
+type HealthCheck struct {
+	Name     string
+	Optional bool
+	Timeout  time.Duration
+	Check    func(ctx context.Context) error
+}
+
+// HealthCheckResult is the outcome of a single check
+type HealthCheckResult struct {
+	Status     string  `json:"status"`
+	Optional   bool    `json:"optional,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// HealthReport is the readiness response body
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// Ready reports whether the instance should receive traffic
+func (r HealthReport) Ready() bool {
+	return r.Status == HealthOK || r.Status == HealthDegraded
+}
+
+type HealthService struct {
+	checks       []HealthCheck
+	shuttingDown atomic.Bool
+}
+
+func NewHealthService(checks ...HealthCheck) *HealthService {
+	return &HealthService{checks: checks}
+}
+
+// AddCheck registers a check for dependencies configured after construction
+func (s *HealthService) AddCheck(check HealthCheck) {
+	s.checks = append(s.checks, check)
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop routing new
+// requests here while in-flight ones drain
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+func (s *HealthService) ShuttingDown() bool {
+	return s.shuttingDown.Load()
+}
+
+// Readiness runs all checks concurrently, each under its own timeout
+func (s *HealthService) Readiness(ctx context.Context) HealthReport {
+	if s.ShuttingDown() {
+		return HealthReport{Status: HealthShuttingDown}
+	}
+
+	results := make([]HealthCheckResult, len(s.checks))
+	var wg sync.WaitGroup
+	for i, check := range s.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runHealthCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthOK, Checks: make(map[string]HealthCheckResult, len(s.checks))}
+	for i, check := range s.checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		if result.Status == HealthOK {
+			continue
+		}
+		if check.Optional {
+			if report.Status == HealthOK {
+				report.Status = HealthDegraded
+			}
+		} else {
+			report.Status = HealthFailing
+		}
+	}
+	return report
+}
+
+func runHealthCheck(ctx context.Context, check HealthCheck) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	result := HealthCheckResult{
+		Status:     HealthOK,
+		Optional:   check.Optional,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = HealthFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// DatabaseHealthCheck pings the connection pool; its duration is the round
+// trip latency to Postgres
+func DatabaseHealthCheck(db *gorm.DB) HealthCheck {
+	return HealthCheck{
+		Name: "database",
+		Check: func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+	}
+}
+
+// MigrationsHealthCheck fails while any table or column of models is missing
+// from the database, e.g. when this build expects a newer schema than the
+// one auto-migrated so far
+func MigrationsHealthCheck(db *gorm.DB, models []any) HealthCheck {
+	return HealthCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) error {
+			var rows []struct {
+				TableName  string
+				ColumnName string
+			}
+			err := db.WithContext(ctx).Raw(
+				"SELECT table_name, column_name FROM information_schema.columns WHERE table_schema = CURRENT_SCHEMA()",
+			).Scan(&rows).Error
+			if err != nil {
+				return err
+			}
+			existing := make(map[string]bool, len(rows))
+			for _, row := range rows {
+				existing[row.TableName+"."+row.ColumnName] = true
+			}
+
+			pending, err := pendingColumns(db, models, existing)
+			if err != nil {
+				return err
+			}
+			if len(pending) > 0 {
+				return fmt.Errorf("pending migrations: missing %s", strings.Join(pending, ", "))
+			}
+			return nil
+		},
+	}
+}
+
+// pendingColumns lists the table.column pairs of models missing from existing
+func pendingColumns(db *gorm.DB, models []any, existing map[string]bool) ([]string, error) {
+	var pending []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if name := stmt.Schema.Table + "." + column; !existing[name] {
+				pending = append(pending, name)
+			}
+		}
+	}
+	sort.Strings(pending)
+	return pending, nil
+}
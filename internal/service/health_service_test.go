@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+)
+
+func staticCheck(name string, optional bool, err error) HealthCheck {
+	return HealthCheck{Name: name, Optional: optional, Check: func(context.Context) error { return err }}
+}
+
+func TestHealthService_Readiness(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []HealthCheck
+		want   string
+		ready  bool
+	}{
+		{"all ok", []HealthCheck{staticCheck("database", false, nil), staticCheck("media_storage", true, nil)}, HealthOK, true},
+		{"optional failing", []HealthCheck{staticCheck("database", false, nil), staticCheck("media_storage", true, errors.New("down"))}, HealthDegraded, true},
+		{"required failing", []HealthCheck{staticCheck("database", false, errors.New("down")), staticCheck("media_storage", true, errors.New("down"))}, HealthFailing, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewHealthService(tt.checks...).Readiness(context.Background())
+			if report.Status != tt.want || report.Ready() != tt.ready {
+				t.Errorf("Expected %s (ready=%v), got %+v", tt.want, tt.ready, report)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("Expected a result per check, got %+v", report.Checks)
+			}
+		})
+	}
+}
+
+func TestHealthService_ReportsErrorsAndTimeouts(t *testing.T) {
+	slow := HealthCheck{
+		Name:    "slow",
+		Timeout: 10 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+	report := NewHealthService(slow, staticCheck("database", false, errors.New("connection refused"))).Readiness(context.Background())
+
+	if got := report.Checks["slow"]; got.Status != HealthFailing || !strings.Contains(got.Error, "deadline") || got.DurationMS < 10 {
+		t.Errorf("Slow check should time out after its timeout, got %+v", got)
+	}
+	if got := report.Checks["database"]; got.Error != "connection refused" {
+		t.Errorf("Expected the check error to be reported, got %+v", got)
+	}
+}
+
+func TestHealthService_ShuttingDown(t *testing.T) {
+	called := false
+	service := NewHealthService(HealthCheck{Name: "database", Check: func(context.Context) error {
+		called = true
+		return nil
+	}})
+	service.SetShuttingDown()
+
+	report := service.Readiness(context.Background())
+	if report.Status != HealthShuttingDown || report.Ready() {
+		t.Errorf("Readiness should fail while shutting down, got %+v", report)
+	}
+	if called {
+		t.Error("Checks should not run while shutting down")
+	}
+}
+
+func TestPendingColumns(t *testing.T) {
+	// Parsing model schemas needs a configured gorm.DB but no connection
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("Failed to open gorm: %v", err)
+	}
+	existing := map[string]bool{}
+	for _, column := range []string{"id", "created_at", "updated_at", "deleted_at", "user_id", "rating", "comment"} {
+		existing["reviews."+column] = true
+	}
+
+	pending, err := pendingColumns(db, []any{&domain.Review{}}, existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0] != "reviews.product_id" {
+		t.Errorf("Expected only reviews.product_id to be pending, got %v", pending)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+	"wine-shop-api/pkg/utils"
+)
+
+// RecoveryCodeCount is the number of recovery codes issued on enrolment
+const RecoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled   = Conflict("mfa_already_enabled", "two-factor authentication is already enabled")
+	ErrMFANotEnrolled      = Conflict("mfa_not_enrolled", "start two-factor enrolment first")
+	ErrMFANotEnabled       = Conflict("mfa_not_enabled", "two-factor authentication is not enabled")
+	ErrInvalidMFACode      = invalidField("code", "invalid_mfa_code", "invalid authentication code")
+	ErrMFARequired         = Forbidden("mfa_required", "two-factor authentication is required for admin accounts")
+	ErrInvalidMFAChallenge = Unauthorized("invalid_mfa_challenge", "MFA challenge expired or invalid, please log in again")
+)
+
+type MFAService struct {
+	Users  *UserService
+	Issuer string // shown in authenticator apps
+}
+
+// MFAEnrollment holds the provisioning details for a new authenticator
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// BeginEnrollment generates a new TOTP secret. It is not active until confirmed
+// with a valid code, so an abandoned enrolment does not lock the user out.
+func (s *MFAService) BeginEnrollment(ctx context.Context, userID uint) (*MFAEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.BeginEnrollment")
+	defer span.End()
+
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.DB.WithContext(ctx).Model(&user).Update("mfa_secret", secret).Error; err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.issuer(), user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment activates MFA and returns the recovery codes. The plain
+// codes are only returned here; only their hashes are stored.
+func (s *MFAService) ConfirmEnrollment(ctx context.Context, userID uint, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.ConfirmEnrollment")
+	defer span.End()
+
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := utils.MatchTOTPCode(user.MFASecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !acceptTOTPStep(tx, &user, step) {
+			return ErrInvalidMFACode
+		}
+		now := time.Now()
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"mfa_enabled":     true,
+			"mfa_enrolled_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, user.ID, codes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes invalidates all existing recovery codes and issues new ones
+func (s *MFAService) RegenerateRecoveryCodes(ctx context.Context, userID uint, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	user, err := s.verifyEnabled(ctx, userID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, user.ID, codes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns off MFA after verifying a current TOTP or recovery code
+func (s *MFAService) Disable(ctx context.Context, userID uint, code string) error {
+	ctx, span := tracing.Start(ctx, "MFAService.Disable")
+	defer span.End()
+
+	user, err := s.verifyEnabled(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+
+	if s.Users.MFARequiredForAdmins && user.IsAdmin() {
+		return ErrMFARequired
+	}
+
+	return config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled":     false,
+			"mfa_secret":      "",
+			"mfa_enrolled_at": nil,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("user_id = ?", user.ID).Delete(&domain.MFARecoveryCode{}).Error
+	})
+}
+
+// VerifyLogin exchanges an MFA challenge token and a TOTP or recovery code for
+// an access token. Wrong codes count towards the account lockout.
+func (s *MFAService) VerifyLogin(ctx context.Context, mfaToken, code, ipAddress, userAgent string) (*LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "MFAService.VerifyLogin")
+	defer span.End()
+
+	userID, err := utils.ParseMFAChallengeToken(mfaToken)
+	if err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	now := time.Now()
+	if user.IsLocked(now) {
+		s.Users.recordLogin(ctx, &user, user.Email, ipAddress, userAgent, "account locked")
+		return nil, accountLocked(&user)
+	}
+	if !user.MFAEnabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	if !s.checkCode(ctx, &user, code) {
+		s.Users.registerFailedLogin(ctx, &user, now)
+		s.Users.recordLogin(ctx, &user, user.Email, ipAddress, userAgent, "invalid MFA code")
+		return nil, ErrInvalidMFACode
+	}
+
+	return s.Users.completeLogin(ctx, &user, ipAddress, userAgent)
+}
+
+// verifyEnabled loads a user with MFA enabled and checks the supplied code
+func (s *MFAService) verifyEnabled(ctx context.Context, userID uint, code string) (*domain.User, error) {
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+	if !user.MFAEnabled {
+		return nil, ErrMFANotEnabled
+	}
+	if !s.checkCode(ctx, &user, code) {
+		return nil, ErrInvalidMFACode
+	}
+	return &user, nil
+}
+
+// checkCode accepts either a current TOTP code that has not been used yet
+// or an unused recovery code, which is consumed on use
+func (s *MFAService) checkCode(ctx context.Context, user *domain.User, code string) bool {
+	if step, ok := utils.MatchTOTPCode(user.MFASecret, code, time.Now()); ok {
+		return acceptTOTPStep(config.DB.WithContext(ctx), user, step)
+	}
+
+	result := config.DB.WithContext(ctx).Model(&domain.MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// acceptTOTPStep records step as the last TOTP step the user has used. It
+// refuses a step at or before the last one, so a code cannot be replayed
+// within its time window, even by a concurrent request.
+func acceptTOTPStep(db *gorm.DB, user *domain.User, step int64) bool {
+	result := db.Model(&domain.User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false
+	}
+	user.MFALastStep = step
+	return true
+}
+
+func (s *MFAService) issuer() string {
+	if s.Issuer != "" {
+		return s.Issuer
+	}
+	return "Wine Shop"
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&domain.MFARecoveryCode{}).Error; err != nil {
+		return err
+	}
+	records := make([]domain.MFARecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = domain.MFARecoveryCode{UserID: userID, CodeHash: utils.HashRecoveryCode(code)}
+	}
+	return tx.Create(&records).Error
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/utils"
+)
+
+func TestCheckCode_RejectsReplayedTOTP(t *testing.T) {
+	db := useTestDB(t, &domain.User{}, &domain.MFARecoveryCode{})
+
+	secret, _ := utils.GenerateTOTPSecret()
+	user := domain.User{Email: fmt.Sprintf("mfa-%d@example.com", time.Now().UnixNano()), Password: "x", MFAEnabled: true, MFASecret: secret}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Expected to create a user, got %v", err)
+	}
+	t.Cleanup(func() { db.Unscoped().Delete(&user) })
+
+	s := &MFAService{}
+	ctx := context.Background()
+	now := time.Now()
+	current, _ := utils.GenerateTOTPCode(secret, now)
+	next, _ := utils.GenerateTOTPCode(secret, now.Add(utils.TOTPPeriod))
+
+	if !s.checkCode(ctx, &user, current) {
+		t.Fatal("Expected the current code to be accepted")
+	}
+	if s.checkCode(ctx, &user, current) {
+		t.Error("Expected the same code to be refused the second time")
+	}
+	if !s.checkCode(ctx, &user, next) {
+		t.Error("Expected the next step's code to be accepted")
+	}
+	if s.checkCode(ctx, &user, current) {
+		t.Error("Expected an older step's code to be refused after a newer one")
+	}
+}
+
+// stepRow stands in for a users row: it applies the UPDATE acceptTOTPStep
+// sends, honouring its mfa_last_step guard when the statement has one
+type stepRow struct {
+	gorm.ConnPool
+	lastStep int64
+}
+
+func (r *stepRow) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	step := args[0].(int64)
+	if strings.Contains(query, "mfa_last_step < ") && args[len(args)-1].(int64) <= r.lastStep {
+		return driverResult(0), nil
+	}
+	r.lastStep = step
+	return driverResult(1), nil
+}
+
+type driverResult int64
+
+func (r driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (r driverResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestAcceptTOTPStep_RefusesUsedSteps(t *testing.T) {
+	row := &stepRow{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: row}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("Expected to open the database, got %v", err)
+	}
+
+	user := domain.User{}
+	user.ID = 1
+	steps := []struct {
+		step int64
+		want bool
+	}{
+		{100, true},
+		{100, false}, // replayed
+		{101, true},
+		{100, false}, // older than the last one used
+	}
+	for _, tt := range steps {
+		if got := acceptTOTPStep(db, &user, tt.step); got != tt.want {
+			t.Errorf("Step %d: expected %v, got %v", tt.step, tt.want, got)
+		}
+	}
+	if user.MFALastStep != 101 || row.lastStep != 101 {
+		t.Errorf("Expected step 101 to be the last one used, got %d (stored %d)", user.MFALastStep, row.lastStep)
+	}
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/logging"
+)
+
+// Notifier delivers account notifications to users
+type Notifier interface {
+	Notify(ctx context.Context, user *domain.User, subject, message string) error
+}
+
+// LogNotifier writes notifications to the application log. It is used until
+// an email provider is configured.
+type LogNotifier struct{}
+
+func (n *LogNotifier) Notify(ctx context.Context, user *domain.User, subject, message string) error {
+	logging.FromContext(ctx).InfoContext(ctx, "notification", "user_id", user.ID, "subject", subject, "message", message)
+	return nil
+}
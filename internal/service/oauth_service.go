@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/oidc"
+	"wine-shop-api/pkg/tracing"
+	"wine-shop-api/pkg/utils"
+)
+
+var (
+	ErrUnknownProvider     = NotFound("unknown_provider", "unknown identity provider")
+	ErrInvalidOAuthState   = Validation("invalid_oauth_state", "login session expired or invalid, please try again")
+	ErrEmailNotVerified    = Forbidden("email_not_verified", "the identity provider did not confirm your email address")
+	ErrOAuthExchangeFailed = &Error{Kind: KindUpstream, Code: "oauth_exchange_failed", Message: "could not complete sign-in with the identity provider"}
+	ErrProviderUnavailable = &Error{Kind: KindUpstream, Code: "identity_provider_unavailable", Message: "identity provider unavailable"}
+)
+
+type OAuthService struct {
+	Users     *UserService
+	Providers map[string]*oidc.Provider
+}
+
+// NewOIDCProviders creates a provider for each configured entry
+func NewOIDCProviders(cfg map[string]config.OIDCProviderConfig) (map[string]*oidc.Provider, error) {
+	providers := make(map[string]*oidc.Provider)
+	for name, providerCfg := range cfg {
+		provider, err := oidc.NewProvider(oidc.Config{
+			Name:         name,
+			Issuer:       providerCfg.Issuer,
+			ClientID:     providerCfg.ClientID,
+			ClientSecret: providerCfg.ClientSecret,
+			RedirectURL:  providerCfg.RedirectURL,
+			Scopes:       providerCfg.Scopes,
+		}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("provider %s: %w", name, err)
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
+
+// ProviderNames returns the configured provider names
+func (s *OAuthService) ProviderNames() []string {
+	names := make([]string, 0, len(s.Providers))
+	for name := range s.Providers {
+		names = append(names, name)
+	}
+	return names
+}
+
+// StartLogin returns the provider authorization URL and a signed flow token
+// holding the state, nonce and PKCE verifier for the callback
+func (s *OAuthService) StartLogin(ctx context.Context, providerName string) (string, string, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.StartLogin")
+	defer span.End()
+
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	flow := utils.OAuthFlow{Provider: providerName}
+	for _, v := range []*string{&flow.State, &flow.Nonce, &flow.CodeVerifier} {
+		random, err := oidc.RandomString()
+		if err != nil {
+			return "", "", err
+		}
+		*v = random
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		return "", "", ErrProviderUnavailable.Wrap(err)
+	}
+
+	flowToken, err := utils.GenerateOAuthFlowToken(flow)
+	if err != nil {
+		return "", "", err
+	}
+	return authURL, flowToken, nil
+}
+
+// CompleteLogin validates the callback, resolves or creates the linked user
+// and issues a login result
+func (s *OAuthService) CompleteLogin(ctx context.Context, providerName, code, state, flowToken, ipAddress, userAgent string) (*LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.CompleteLogin")
+	defer span.End()
+
+	provider, ok := s.Providers[providerName]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	flow, err := utils.ParseOAuthFlowToken(flowToken)
+	if err != nil || flow.Provider != providerName || state == "" || flow.State != state {
+		return nil, ErrInvalidOAuthState
+	}
+
+	claims, err := provider.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, ErrOAuthExchangeFailed.Wrap(err)
+	}
+
+	user, err := s.resolveUser(ctx, providerName, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsLocked(time.Now()) {
+		s.Users.recordLogin(ctx, user, user.Email, ipAddress, userAgent, "account locked")
+		return nil, accountLocked(user)
+	}
+
+	return s.Users.issueLogin(ctx, user, ipAddress, userAgent)
+}
+
+// resolveUser finds the user linked to the external identity. Unlinked
+// identities are linked to the account with the same verified email, or a new
+// customer account is created. Accounts created this way have no password and
+// must verify their age before checkout.
+func (s *OAuthService) resolveUser(ctx context.Context, providerName string, claims *oidc.Claims) (*domain.User, error) {
+	var identity domain.UserIdentity
+	err := config.DB.WithContext(ctx).Where("provider = ? AND subject = ?", providerName, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user domain.User
+		if err := config.DB.WithContext(ctx).First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Only link or create accounts from emails the provider has verified,
+	// otherwise anyone could claim an existing account's address
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	email := html.EscapeString(strings.TrimSpace(claims.Email))
+
+	var user domain.User
+	err = config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = LOWER(?)", email).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			password, err := unusablePassword()
+			if err != nil {
+				return err
+			}
+			user = domain.User{Email: email, Password: password}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		return tx.Create(&domain.UserIdentity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  claims.Subject,
+			Email:    email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetIdentities lists the external identities linked to a user
+func (s *OAuthService) GetIdentities(ctx context.Context, userID uint) ([]domain.UserIdentity, error) {
+	ctx, span := tracing.Start(ctx, "OAuthService.GetIdentities")
+	defer span.End()
+
+	identities := []domain.UserIdentity{}
+	if err := config.DB.WithContext(ctx).Where("user_id = ?", userID).Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// unusablePassword returns a bcrypt hash of a random secret that is never
+// revealed, so social-only accounts cannot log in with a password
+func unusablePassword() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(b)), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
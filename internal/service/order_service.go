@@ -1,35 +1,93 @@
 package service
 
 import (
-	"errors"
+	"context"
+	"strings"
+	"time"
 
 	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrAgeNotVerified = Forbidden("age_not_verified", "date of birth is required before placing an order")
+	ErrUnderage       = Forbidden("underage", "you are below the legal drinking age for the shipping country")
+	ErrCartEmpty      = Validation("cart_empty", "cart is empty")
+
+	ErrShippingCountryMismatch = invalidField("shipping_country", "mismatch", "must match the country of the shipping address")
+)
+
 type OrderService struct {
 	CartService *CartService
+	AgePolicy   *AgePolicy
+	Payments    *PaymentService
+	Addresses   *AddressService
+	Shipping    *ShippingService
+	Compliance  *ComplianceService
+	Cache       CatalogueCache // optional; purged when stock is reserved
 }
 
-func (s *OrderService) CreateOrder(userID uint) (*domain.Order, error) {
-	// 1. Get Cart
-	cart, err := s.CartService.GetCart(userID)
+// CheckoutRequest holds the customer's choices at checkout
+type CheckoutRequest struct {
+	// ShippingAddressID and BillingAddressID pick addresses from the
+	// customer's address book; zero uses their defaults
+	ShippingAddressID uint
+	BillingAddressID  uint
+	// ShippingCountry is optional and must match the shipping address
+	ShippingCountry string
+	// ShippingMethod is a method code from the shipping quote; empty picks
+	// the cheapest
+	ShippingMethod string
+	// PaymentMethod is passed to the payment provider as is
+	PaymentMethod string
+}
+
+// CreateOrder turns the cart into a pending order for the chosen addresses,
+// checks it against the shipping compliance rules, reserves its stock and
+// starts the payment. The order becomes paid when the payment provider
+// confirms the payment by webhook.
+func (s *OrderService) CreateOrder(ctx context.Context, userID uint, req CheckoutRequest) (*domain.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.CreateOrder")
+	defer span.End()
+
+	// 1. Resolve the addresses, which are copied onto the order
+	shippingAddress, billingAddress, err := s.Addresses.CheckoutAddresses(ctx, userID, req.ShippingAddressID, req.BillingAddressID)
+	if err != nil {
+		return nil, err
+	}
+	if req.ShippingCountry != "" && !strings.EqualFold(strings.TrimSpace(req.ShippingCountry), shippingAddress.Country) {
+		return nil, ErrShippingCountryMismatch
+	}
+
+	// 2. Verify the customer is of legal drinking age for the destination
+	attestation, err := s.attestAge(ctx, userID, shippingAddress.Country)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Get Cart
+	cart, err := s.CartService.GetCart(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(cart.Items) == 0 {
-		return nil, errors.New("cart is empty")
+		return nil, ErrCartEmpty
 	}
 
-	// 2. Calculate Total and Create Order Items
-	var total float64
+	// 4. Calculate Subtotal and Create Order Items
+	var subtotal float64
 	var orderItems []domain.OrderItem
 
 	for _, item := range cart.Items {
-		total += item.Product.Price * float64(item.Quantity)
+		if item.Quantity > item.Product.Stock {
+			return nil, insufficientStock(&item.Product)
+		}
+		subtotal += item.Product.Price * float64(item.Quantity)
 		orderItems = append(orderItems, domain.OrderItem{
 			ProductID: item.ProductID,
 			Quantity:  item.Quantity,
@@ -37,43 +95,140 @@ func (s *OrderService) CreateOrder(userID uint) (*domain.Order, error) {
 		})
 	}
 
-	// 3. Create Order
+	// 5. Check the destination's alcohol shipping rules
+	shipment := NewShipment(cart.Items)
+	compliance, err := s.Compliance.Check(ctx, shippingAddress, shipment)
+	if err != nil {
+		return nil, err
+	}
+
+	// 6. Add the shipping line for the chosen method
+	shipping, err := s.Shipping.Select(ctx, shippingAddress, shipment, req.ShippingMethod)
+	if err != nil {
+		return nil, err
+	}
+	total := subtotal + shipping.Cost
+
+	// 7. Start the payment. The intent is created before the order is
+	// stored, so a provider outage leaves the cart untouched; its webhook
+	// is retried until the order below has committed. If the order is not
+	// stored, e.g. another checkout took the last bottles, the intent is
+	// cancelled so it can never be paid.
+	payment, err := s.Payments.StartPayment(ctx, total, req.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			s.Payments.CancelPayment(ctx, payment)
+		}
+	}()
+
+	// 8. Create Order
 	order := domain.Order{
-		UserID: userID,
-		Total:  total,
-		Status: "Paid", // Simplified for this demo
-		Items:  orderItems,
+		UserID:            userID,
+		Subtotal:          subtotal,
+		ShippingMethod:    shipping.Method,
+		ShippingCost:      shipping.Cost,
+		Total:             total,
+		Status:            domain.OrderStatusPending,
+		ShippingCountry:   attestation.ShippingCountry,
+		ShippingAddress:   shippingAddress,
+		BillingAddress:    billingAddress,
+		ComplianceVersion: compliance.Version,
+		AdultSignature:    compliance.AdultSignature,
+		Items:             orderItems,
+		Payments:          []domain.Payment{*payment},
+		AgeAttestation:    attestation,
 	}
 
-	tx := config.DB.Begin()
+	tx := config.DB.WithContext(ctx).Begin()
 
 	if err := tx.Create(&order).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	// 4. Clear Cart
+	// 9. Clear Cart
 	if err := tx.Where("cart_id = ?", cart.ID).Delete(&domain.CartItem{}).Error; err != nil {
 		tx.Rollback()
 		return nil, err
 	}
 
-	// 5. Update Stock (Optional but good practice)
+	// 10. Reserve Stock, guarding against concurrent checkouts of the last
+	// bottles. The version moves on so an admin edit based on the old stock
+	// level is rejected instead of restoring it, and updated_at so the
+	// product's Last-Modified does too.
+	now := time.Now()
 	for _, item := range cart.Items {
-		if err := tx.Model(&domain.Product{}).Where("id = ?", item.ProductID).UpdateColumn("stock", gorm.Expr("stock - ?", item.Quantity)).Error; err != nil {
+		result := tx.Model(&domain.Product{}).
+			Where("id = ? AND stock >= ?", item.ProductID, item.Quantity).
+			UpdateColumns(map[string]interface{}{
+				"stock":      gorm.Expr("stock - ?", item.Quantity),
+				"version":    gorm.Expr("version + 1"),
+				"updated_at": now,
+			})
+		if result.Error != nil {
 			tx.Rollback()
-			return nil, err
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			tx.Rollback()
+			return nil, insufficientStock(&item.Product)
 		}
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	committed = true
+	purgeCatalogue(s.Cache)
+	metrics.OrdersCreated.Inc()
 
 	return &order, nil
 }
 
-func (s *OrderService) GetOrders(userID uint) ([]domain.Order, error) {
+// attestAge checks the customer's age against the destination's minimum
+// drinking age and returns the audit record to store with the order
+func (s *OrderService) attestAge(ctx context.Context, userID uint, shippingCountry string) (*domain.AgeAttestation, error) {
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if !user.IsAgeVerified() {
+		return nil, ErrAgeNotVerified
+	}
+
+	policy := s.AgePolicy
+	if policy == nil {
+		policy = &AgePolicy{DefaultAge: DefaultMinimumAge}
+	}
+
+	now := time.Now()
+	minimumAge := policy.MinimumAgeFor(shippingCountry)
+	age := user.AgeOn(now)
+	if age < minimumAge {
+		return nil, ErrUnderage
+	}
+
+	return &domain.AgeAttestation{
+		UserID:          user.ID,
+		DateOfBirth:     *user.DateOfBirth,
+		ShippingCountry: strings.ToUpper(strings.TrimSpace(shippingCountry)),
+		MinimumAge:      minimumAge,
+		AgeAtCheckout:   age,
+		AttestedAt:      now,
+	}, nil
+}
+
+func (s *OrderService) GetOrders(ctx context.Context, userID uint) ([]domain.Order, error) {
+	ctx, span := tracing.Start(ctx, "OrderService.GetOrders")
+	defer span.End()
+
 	var orders []domain.Order
-	if err := config.DB.Preload("Items.Product").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error; err != nil {
+	if err := config.DB.WithContext(ctx).Preload("Items.Product").Preload("Payments").Preload("Refunds").Preload("AgeAttestation").Where("user_id = ?", userID).Order("created_at desc").Find(&orders).Error; err != nil {
 		return nil, err
 	}
 	return orders, nil
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"wine-shop-api/internal/domain"
+)
+
+// Scenarios simulated by MockPaymentProvider
+const (
+	MockScenarioSuccess = "success"
+	MockScenarioFailure = "failure"
+	// MockScenario3DS requires the customer to pass a challenge first
+	MockScenario3DS = "3ds"
+)
+
+// MockSignatureHeader carries the webhook signature as
+// t=<unix time>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+const MockSignatureHeader = "Mock-Signature"
+
+// webhookTolerance bounds the age of a signed webhook, so captured
+// deliveries cannot be replayed later
+const webhookTolerance = 5 * time.Minute
+
+// mockWebhookAttempts is how often a webhook is delivered before giving up
+const mockWebhookAttempts = 5
+
+var (
+	ErrUnknownMockScenario = invalidField("payment_method", "invalid", "payment_method must be mock_success, mock_failure or mock_3ds")
+	ErrChallengeCompleted  = Conflict("challenge_completed", "this payment is not awaiting a challenge")
+)
+
+// MockPaymentProvider simulates a card gateway for local development and
+// tests. Each intent plays out Scenario, or the scenario named by a
+// mock_<scenario> payment method, and its outcome is posted as a signed
+// webhook to APIURL + /payments/webhook. 3-D Secure intents wait for the
+// customer to pass or fail the challenge at their next action URL.
+type MockPaymentProvider struct {
+	Scenario string
+	Secret   []byte
+	// APIURL is the base URL of this API, e.g. http://localhost:8080/api
+	APIURL string
+	Client *http.Client
+	// RetryDelay is the wait before the first webhook delivery, doubled
+	// before each retry
+	RetryDelay time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	intents map[string]*mockIntent
+}
+
+type mockIntent struct {
+	status   string
+	amount   float64
+	currency string
+	captured float64
+	refunded float64
+}
+
+func NewMockPaymentProvider(scenario string, secret []byte, apiURL string) *MockPaymentProvider {
+	return &MockPaymentProvider{
+		Scenario:   scenario,
+		Secret:     secret,
+		APIURL:     strings.TrimSuffix(apiURL, "/"),
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		RetryDelay: 500 * time.Millisecond,
+		now:        time.Now,
+		intents:    make(map[string]*mockIntent),
+	}
+}
+
+func (m *MockPaymentProvider) Name() string {
+	return "mock"
+}
+
+func (m *MockPaymentProvider) CreateIntent(ctx context.Context, req PaymentIntentRequest) (*PaymentIntent, error) {
+	scenario := m.Scenario
+	if req.PaymentMethod != "" {
+		scenario = strings.TrimPrefix(req.PaymentMethod, "mock_")
+	}
+	switch scenario {
+	case MockScenarioSuccess, MockScenarioFailure, MockScenario3DS:
+	default:
+		return nil, ErrUnknownMockScenario
+	}
+
+	ref := "mock_pi_" + mockID()
+	intent := &mockIntent{status: domain.PaymentStatusProcessing, amount: req.Amount, currency: req.Currency}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.intents[ref] = intent
+
+	switch scenario {
+	case MockScenario3DS:
+		intent.status = domain.PaymentStatusRequiresAction
+		return &PaymentIntent{
+			Ref:           ref,
+			Status:        domain.PaymentStatusRequiresAction,
+			NextActionURL: m.APIURL + "/payments/mock/" + ref + "/challenge",
+		}, nil
+	case MockScenarioFailure:
+		m.settle(ref, intent, false, "card_declined")
+	default:
+		m.settle(ref, intent, true, "")
+	}
+	return &PaymentIntent{Ref: ref, Status: domain.PaymentStatusProcessing}, nil
+}
+
+// CompleteChallenge finishes the 3-D Secure step of an intent, as the
+// customer's bank would
+func (m *MockPaymentProvider) CompleteChallenge(ref string, approve bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[ref]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if intent.status != domain.PaymentStatusRequiresAction {
+		return ErrChallengeCompleted
+	}
+	m.settle(ref, intent, approve, "authentication_failed")
+	return nil
+}
+
+// settle authorises or declines an intent and reports it by webhook. The
+// caller holds m.mu.
+func (m *MockPaymentProvider) settle(ref string, intent *mockIntent, authorized bool, failureReason string) {
+	event := PaymentEvent{ID: "mock_evt_" + mockID(), Ref: ref, Amount: intent.amount, Currency: intent.currency}
+	if authorized {
+		intent.status = "authorized"
+		event.Type = PaymentEventAuthorized
+	} else {
+		intent.status = domain.PaymentStatusFailed
+		event.Type = PaymentEventFailed
+		event.FailureReason = failureReason
+	}
+	go m.deliver(event)
+}
+
+func (m *MockPaymentProvider) Capture(ctx context.Context, ref string, amount float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[ref]
+	switch {
+	case !ok:
+		return fmt.Errorf("mock payment %s not found", ref)
+	case intent.status == "captured" && intent.captured == amount:
+		// Captures are idempotent, as webhooks may be delivered twice
+		return nil
+	case intent.status != "authorized":
+		return fmt.Errorf("mock payment %s is %s, not authorized", ref, intent.status)
+	case amount <= 0 || amount > intent.amount:
+		return fmt.Errorf("cannot capture %.2f of %.2f", amount, intent.amount)
+	}
+	intent.status = "captured"
+	intent.captured = amount
+	return nil
+}
+
+func (m *MockPaymentProvider) Refund(ctx context.Context, ref string, amount float64) (*PaymentRefund, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[ref]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("mock payment %s not found", ref)
+	case intent.status != "captured":
+		return nil, fmt.Errorf("mock payment %s is %s, not captured", ref, intent.status)
+	case amount <= 0 || intent.refunded+amount > intent.captured+0.005:
+		return nil, fmt.Errorf("cannot refund %.2f, %.2f of %.2f already refunded", amount, intent.refunded, intent.captured)
+	}
+	intent.refunded += amount
+	return &PaymentRefund{Ref: "mock_re_" + mockID(), Amount: amount}, nil
+}
+
+func (m *MockPaymentProvider) Cancel(ctx context.Context, ref string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	intent, ok := m.intents[ref]
+	switch {
+	case !ok:
+		return fmt.Errorf("mock payment %s not found", ref)
+	case intent.status == "captured":
+		return fmt.Errorf("mock payment %s is already captured", ref)
+	}
+	intent.status = "cancelled"
+	return nil
+}
+
+func (m *MockPaymentProvider) VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get(MockSignatureHeader), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || signature == "" {
+		return nil, ErrInvalidWebhookSignature
+	}
+	if age := m.now().Sub(time.Unix(seconds, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return nil, ErrInvalidWebhookSignature.WithMessage("webhook signature has expired")
+	}
+	expected, _ := hex.DecodeString(m.signature(timestamp, payload))
+	given, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, given) {
+		return nil, ErrInvalidWebhookSignature
+	}
+
+	var event PaymentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, Validation("invalid_webhook_payload", "webhook payload is not a payment event")
+	}
+	return &event, nil
+}
+
+// Sign returns the MockSignatureHeader value for payload sent at at
+func (m *MockPaymentProvider) Sign(payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + m.signature(timestamp, payload)
+}
+
+func (m *MockPaymentProvider) signature(timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, m.Secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts event to the webhook endpoint, retrying with backoff since
+// it may arrive before the checkout that created the intent has committed
+func (m *MockPaymentProvider) deliver(event PaymentEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("mock payment webhook encoding failed", "error", err)
+		return
+	}
+
+	delay := m.RetryDelay
+	for attempt := 1; attempt <= mockWebhookAttempts; attempt++ {
+		time.Sleep(delay)
+		delay *= 2
+
+		if m.cancelled(event.Ref) {
+			return
+		}
+		err = m.post(payload)
+		if err == nil {
+			return
+		}
+		slog.Warn("mock payment webhook delivery failed", "event", event.ID, "attempt", attempt, "error", err)
+	}
+}
+
+// cancelled reports whether the intent ref was cancelled, after which its
+// outcome is no longer reported
+func (m *MockPaymentProvider) cancelled(ref string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	intent, ok := m.intents[ref]
+	return ok && intent.status == "cancelled"
+}
+
+func (m *MockPaymentProvider) post(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, m.APIURL+"/payments/webhook", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(MockSignatureHeader, m.Sign(payload, m.now()))
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("webhook endpoint returned " + resp.Status)
+	}
+	return nil
+}
+
+func mockID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
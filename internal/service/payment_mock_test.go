@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"wine-shop-api/internal/domain"
+)
+
+// webhookReceiver collects verified webhook events posted by a mock provider
+func webhookReceiver(t *testing.T, m *MockPaymentProvider) <-chan *PaymentEvent {
+	t.Helper()
+	events := make(chan *PaymentEvent, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		event, err := m.VerifyWebhook(payload, r.Header)
+		if err != nil {
+			t.Errorf("Expected a verifiable webhook, got %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		events <- event
+	}))
+	t.Cleanup(server.Close)
+	m.APIURL = server.URL
+	m.RetryDelay = time.Millisecond
+	return events
+}
+
+func awaitEvent(t *testing.T, events <-chan *PaymentEvent) *PaymentEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a webhook delivery")
+		return nil
+	}
+}
+
+func TestMockPaymentProvider_Scenarios(t *testing.T) {
+	tests := []struct {
+		method  string
+		event   string
+		failure string
+	}{
+		{"", PaymentEventAuthorized, ""},
+		{"mock_success", PaymentEventAuthorized, ""},
+		{"mock_failure", PaymentEventFailed, "card_declined"},
+	}
+
+	for _, tt := range tests {
+		m := NewMockPaymentProvider(MockScenarioSuccess, []byte("secret"), "")
+		events := webhookReceiver(t, m)
+
+		intent, err := m.CreateIntent(context.Background(), PaymentIntentRequest{Amount: 42, Currency: "USD", PaymentMethod: tt.method})
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", tt.method, err)
+		}
+		if intent.Status != domain.PaymentStatusProcessing || intent.NextActionURL != "" {
+			t.Errorf("%q: expected a processing intent, got %+v", tt.method, intent)
+		}
+
+		event := awaitEvent(t, events)
+		if event.Type != tt.event || event.Ref != intent.Ref || event.Amount != 42 || event.Currency != "USD" || event.FailureReason != tt.failure {
+			t.Errorf("%q: expected %s for %s, got %+v", tt.method, tt.event, intent.Ref, event)
+		}
+	}
+}
+
+func TestMockPaymentProvider_3DSChallenge(t *testing.T) {
+	m := NewMockPaymentProvider(MockScenario3DS, []byte("secret"), "")
+	events := webhookReceiver(t, m)
+
+	intent, err := m.CreateIntent(context.Background(), PaymentIntentRequest{Amount: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intent.Status != domain.PaymentStatusRequiresAction || intent.NextActionURL != m.APIURL+"/payments/mock/"+intent.Ref+"/challenge" {
+		t.Fatalf("Expected an intent awaiting a challenge, got %+v", intent)
+	}
+	if err := m.Capture(context.Background(), intent.Ref, 30); err == nil {
+		t.Error("Expected capture to fail before the challenge")
+	}
+
+	if err := m.CompleteChallenge(intent.Ref, true); err != nil {
+		t.Fatal(err)
+	}
+	if event := awaitEvent(t, events); event.Type != PaymentEventAuthorized {
+		t.Errorf("Expected an authorised payment after the challenge, got %+v", event)
+	}
+	if err := m.CompleteChallenge(intent.Ref, false); !errors.Is(err, ErrChallengeCompleted) {
+		t.Errorf("Expected a second challenge to be rejected, got %v", err)
+	}
+
+	declined, _ := m.CreateIntent(context.Background(), PaymentIntentRequest{Amount: 30})
+	m.CompleteChallenge(declined.Ref, false)
+	if event := awaitEvent(t, events); event.Type != PaymentEventFailed || event.FailureReason != "authentication_failed" {
+		t.Errorf("Expected a failed payment after a failed challenge, got %+v", event)
+	}
+}
+
+func TestMockPaymentProvider_CaptureAndRefund(t *testing.T) {
+	m := NewMockPaymentProvider(MockScenarioSuccess, []byte("secret"), "")
+	m.RetryDelay = time.Hour // no webhook needed
+	ctx := context.Background()
+	intent, _ := m.CreateIntent(ctx, PaymentIntentRequest{Amount: 100})
+
+	if _, err := m.Refund(ctx, intent.Ref, 10); err == nil {
+		t.Error("Expected a refund before capture to fail")
+	}
+	if err := m.Capture(ctx, intent.Ref, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Capture(ctx, intent.Ref, 100); err != nil {
+		t.Errorf("Expected a repeated capture to be idempotent, got %v", err)
+	}
+	if _, err := m.Refund(ctx, intent.Ref, 60); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Refund(ctx, intent.Ref, 50); err == nil {
+		t.Error("Expected refunds beyond the captured amount to fail")
+	}
+	if refund, err := m.Refund(ctx, intent.Ref, 40); err != nil || refund.Amount != 40 {
+		t.Errorf("Expected the remaining 40 to be refundable, got %+v %v", refund, err)
+	}
+}
+
+func TestMockPaymentProvider_Cancel(t *testing.T) {
+	m := NewMockPaymentProvider(MockScenario3DS, []byte("secret"), "")
+	ctx := context.Background()
+
+	intent, _ := m.CreateIntent(ctx, PaymentIntentRequest{Amount: 30})
+	if err := m.Cancel(ctx, intent.Ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.CompleteChallenge(intent.Ref, true); !errors.Is(err, ErrChallengeCompleted) {
+		t.Errorf("Expected a cancelled intent's challenge to be rejected, got %v", err)
+	}
+	if err := m.Capture(ctx, intent.Ref, 30); err == nil {
+		t.Error("Expected a cancelled intent not to be captured")
+	}
+
+	m.Scenario = MockScenarioSuccess
+	m.RetryDelay = time.Hour // no webhook needed
+	captured, _ := m.CreateIntent(ctx, PaymentIntentRequest{Amount: 30})
+	m.Capture(ctx, captured.Ref, 30)
+	if err := m.Cancel(ctx, captured.Ref); err == nil {
+		t.Error("Expected a captured intent not to be cancelled")
+	}
+}
+
+func TestMockPaymentProvider_VerifyWebhook(t *testing.T) {
+	m := NewMockPaymentProvider(MockScenarioSuccess, []byte("secret"), "")
+	payload := []byte(`{"id":"evt_1","type":"payment.authorized","ref":"mock_pi_1","amount":10}`)
+	now := time.Now()
+
+	header := http.Header{}
+	header.Set(MockSignatureHeader, m.Sign(payload, now))
+	if event, err := m.VerifyWebhook(payload, header); err != nil || event.Ref != "mock_pi_1" {
+		t.Fatalf("Expected a valid signature, got %+v %v", event, err)
+	}
+
+	tampered := []byte(`{"id":"evt_1","type":"payment.authorized","ref":"mock_pi_2","amount":10}`)
+	if _, err := m.VerifyWebhook(tampered, header); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("Expected a tampered payload to be rejected, got %v", err)
+	}
+
+	other := NewMockPaymentProvider(MockScenarioSuccess, []byte("other"), "")
+	header.Set(MockSignatureHeader, other.Sign(payload, now))
+	if _, err := m.VerifyWebhook(payload, header); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("Expected a signature with another secret to be rejected, got %v", err)
+	}
+
+	header.Set(MockSignatureHeader, m.Sign(payload, now.Add(-10*time.Minute)))
+	if _, err := m.VerifyWebhook(payload, header); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("Expected an old signature to be rejected, got %v", err)
+	}
+
+	if _, err := m.VerifyWebhook(payload, http.Header{}); !errors.Is(err, ErrInvalidWebhookSignature) {
+		t.Errorf("Expected a missing signature to be rejected, got %v", err)
+	}
+}
+
+func TestMockPaymentProvider_UnknownScenario(t *testing.T) {
+	m := NewMockPaymentProvider(MockScenarioSuccess, []byte("secret"), "")
+	if _, err := m.CreateIntent(context.Background(), PaymentIntentRequest{Amount: 1, PaymentMethod: "pm_card_visa"}); !errors.Is(err, ErrUnknownMockScenario) {
+		t.Errorf("Expected an unknown payment method to be rejected, got %v", err)
+	}
+}
+
+func TestStartPayment_WithoutProvider(t *testing.T) {
+	s := &PaymentService{Currency: "USD"}
+	if _, err := s.StartPayment(context.Background(), 10, ""); !errors.Is(err, ErrPaymentsUnavailable) {
+		t.Errorf("Expected payments to be unavailable without a provider, got %v", err)
+	}
+}
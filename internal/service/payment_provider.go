@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"net/http"
+)
+
+// Webhook event types understood by PaymentService
+const (
+	// PaymentEventAuthorized means the funds are reserved and can be captured
+	PaymentEventAuthorized = "payment.authorized"
+	// PaymentEventSucceeded means the funds were captured
+	PaymentEventSucceeded = "payment.succeeded"
+	PaymentEventFailed    = "payment.failed"
+)
+
+// PaymentProvider is a payment gateway. Intents are authorised
+// asynchronously; the outcome arrives as a webhook, which must be verified
+// before it is trusted.
+type PaymentProvider interface {
+	// Name identifies the provider in stored payments
+	Name() string
+	CreateIntent(ctx context.Context, req PaymentIntentRequest) (*PaymentIntent, error)
+	// Capture collects amount from an authorised intent
+	Capture(ctx context.Context, ref string, amount float64) error
+	// Refund returns amount of a captured intent to the customer
+	Refund(ctx context.Context, ref string, amount float64) (*PaymentRefund, error)
+	// Cancel voids an intent that has not been captured, so it can no
+	// longer be paid. It fails if the intent was already captured.
+	Cancel(ctx context.Context, ref string) error
+	// VerifyWebhook checks the signature of a webhook delivery and decodes it
+	VerifyWebhook(payload []byte, header http.Header) (*PaymentEvent, error)
+}
+
+// PaymentIntentRequest asks the provider to start a payment
+type PaymentIntentRequest struct {
+	Amount   float64
+	Currency string
+	// PaymentMethod is an opaque token from the provider's client-side SDK
+	PaymentMethod string
+}
+
+// PaymentIntent is a payment started at the provider. Status is one of the
+// domain.PaymentStatus values; NextActionURL is set when the customer must
+// complete a challenge before the payment can be authorised.
+type PaymentIntent struct {
+	Ref           string
+	Status        string
+	NextActionURL string
+}
+
+// PaymentRefund is money returned against a captured intent
+type PaymentRefund struct {
+	Ref    string
+	Amount float64
+}
+
+// PaymentEvent is a verified webhook delivery
+type PaymentEvent struct {
+	ID            string  `json:"id"`
+	Type          string  `json:"type"`
+	Ref           string  `json:"ref"`
+	Amount        float64 `json:"amount"`
+	Currency      string  `json:"currency"`
+	FailureReason string  `json:"failure_reason,omitempty"`
+}
+
+var (
+	ErrInvalidWebhookSignature = Unauthorized("invalid_webhook_signature", "webhook signature is missing or invalid")
+	ErrPaymentProviderFailed   = &Error{Kind: KindUpstream, Code: "payment_provider_failed", Message: "the payment provider could not be reached, please try again"}
+	ErrPaymentNotFound         = NotFound("payment_not_found", "payment not found")
+	ErrPaymentsUnavailable     = Unavailable("payments_unavailable", "payments are not available, please try again later")
+	ErrWebhookAmountMismatch   = Conflict("webhook_amount_mismatch", "webhook amount or currency does not match the payment")
+)
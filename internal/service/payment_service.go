@@ -0,0 +1,386 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentFailureExpired is the failure reason of payments that got no
+// outcome in time
+const PaymentFailureExpired = "expired"
+
+// paymentExpiryInterval is how often RunExpiry looks for stale payments
+const paymentExpiryInterval = time.Minute
+
+var (
+	ErrNoCapturedPayment    = Conflict("no_captured_payment", "the order has no successful payment to refund")
+	ErrRefundExceedsPayment = Conflict("refund_exceeds_payment", "refunds cannot exceed the amount paid for the order")
+)
+
+// PaymentService takes payments for orders through a PaymentProvider. An
+// order is only marked paid once a verified webhook reports its payment
+// authorised (which is then captured) or succeeded. Without a Provider,
+// payments are switched off and fail with ErrPaymentsUnavailable.
+type PaymentService struct {
+	Provider PaymentProvider
+	Currency string
+	Cache    CatalogueCache // optional; purged when a failed payment releases stock
+}
+
+// StartPayment creates a payment intent for amount and returns the payment
+// record to store with the order
+func (s *PaymentService) StartPayment(ctx context.Context, amount float64, paymentMethod string) (*domain.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.StartPayment")
+	defer span.End()
+
+	if s.Provider == nil {
+		return nil, ErrPaymentsUnavailable
+	}
+	intent, err := s.Provider.CreateIntent(ctx, PaymentIntentRequest{
+		Amount:        amount,
+		Currency:      s.Currency,
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		var domainErr *Error
+		if errors.As(err, &domainErr) {
+			return nil, err
+		}
+		return nil, ErrPaymentProviderFailed.Wrap(err)
+	}
+
+	return &domain.Payment{
+		Provider:      s.Provider.Name(),
+		ProviderRef:   intent.Ref,
+		Amount:        amount,
+		Currency:      s.Currency,
+		Status:        intent.Status,
+		NextActionURL: intent.NextActionURL,
+	}, nil
+}
+
+// CancelPayment voids a payment's intent at the provider, for checkouts that
+// started it but could not store their order. Failures are logged, as the
+// order is already being abandoned; such an intent is never captured.
+func (s *PaymentService) CancelPayment(ctx context.Context, payment *domain.Payment) {
+	// The request may have been cancelled, which is often why the checkout
+	// is being abandoned
+	ctx, span := tracing.Start(context.WithoutCancel(ctx), "PaymentService.CancelPayment")
+	defer span.End()
+
+	if err := s.Provider.Cancel(ctx, payment.ProviderRef); err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to cancel payment intent", "ref", payment.ProviderRef, "error", err)
+	}
+}
+
+// ExpirePayments cancels payments that have waited for an outcome since
+// before cutoff, e.g. an abandoned 3-D Secure challenge, and fails them so
+// their orders are cancelled and the stock returned. A payment the provider
+// will not cancel is left for its webhook. It returns how many expired.
+func (s *PaymentService) ExpirePayments(ctx context.Context, cutoff time.Time) (int, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.ExpirePayments")
+	defer span.End()
+
+	if s.Provider == nil {
+		return 0, nil
+	}
+	var payments []domain.Payment
+	err := config.DB.WithContext(ctx).
+		Where("provider = ? AND status IN ? AND created_at < ?", s.Provider.Name(),
+			[]string{domain.PaymentStatusProcessing, domain.PaymentStatusRequiresAction}, cutoff).
+		Find(&payments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for i := range payments {
+		payment := &payments[i]
+		if err := s.Provider.Cancel(ctx, payment.ProviderRef); err != nil {
+			logging.FromContext(ctx).WarnContext(ctx, "could not cancel stale payment", "payment_id", payment.ID, "ref", payment.ProviderRef, "error", err)
+			continue
+		}
+		if err := s.markFailed(ctx, payment, PaymentFailureExpired); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// RunExpiry expires payments pending for longer than timeout, checking every
+// paymentExpiryInterval until ctx is done
+func (s *PaymentService) RunExpiry(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(paymentExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			expired, err := s.ExpirePayments(ctx, time.Now().Add(-timeout))
+			if err != nil {
+				slog.Error("payment expiry failed", "error", err)
+			}
+			if expired > 0 {
+				slog.Info("expired stale payments", "count", expired)
+			}
+		}
+	}
+}
+
+// GetUserPayment returns the payment with the provider reference ref if it
+// belongs to one of userID's orders, and ErrPaymentNotFound otherwise
+func (s *PaymentService) GetUserPayment(ctx context.Context, userID uint, ref string) (*domain.Payment, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.GetUserPayment")
+	defer span.End()
+
+	var payment domain.Payment
+	err := config.DB.WithContext(ctx).
+		Joins("JOIN orders ON orders.id = payments.order_id").
+		Where("payments.provider = ? AND payments.provider_ref = ? AND orders.user_id = ?", s.Provider.Name(), ref, userID).
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// HandleWebhook verifies a webhook delivery and applies it to the payment
+// and its order. Deliveries for payments that already have an outcome are
+// acknowledged without effect, as providers may deliver an event more than
+// once. Unknown payments return ErrPaymentNotFound so the provider retries,
+// in case the checkout that created the intent has not committed yet.
+// Events for another amount or currency than the payment's are rejected
+// with ErrWebhookAmountMismatch.
+func (s *PaymentService) HandleWebhook(ctx context.Context, payload []byte, header http.Header) error {
+	ctx, span := tracing.Start(ctx, "PaymentService.HandleWebhook")
+	defer span.End()
+
+	if s.Provider == nil {
+		return ErrPaymentsUnavailable
+	}
+	event, err := s.Provider.VerifyWebhook(payload, header)
+	if err != nil {
+		return err
+	}
+
+	var payment domain.Payment
+	err = config.DB.WithContext(ctx).
+		Where("provider = ? AND provider_ref = ?", s.Provider.Name(), event.Ref).
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrPaymentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if payment.IsFinal() {
+		return nil
+	}
+	// The outcome must be for what the order was charged, so a webhook for
+	// a cheaper intent cannot mark it paid
+	if roundCents(event.Amount) != roundCents(payment.Amount) || !strings.EqualFold(event.Currency, payment.Currency) {
+		logging.FromContext(ctx).WarnContext(ctx, "payment webhook amount mismatch", "event", event.ID, "payment_id", payment.ID,
+			"amount", event.Amount, "currency", event.Currency, "expected_amount", payment.Amount, "expected_currency", payment.Currency)
+		return ErrWebhookAmountMismatch
+	}
+
+	switch event.Type {
+	case PaymentEventAuthorized:
+		if err := s.Provider.Capture(ctx, payment.ProviderRef, payment.Amount); err != nil {
+			return ErrPaymentProviderFailed.Wrap(err)
+		}
+		return s.markSucceeded(ctx, &payment)
+	case PaymentEventSucceeded:
+		return s.markSucceeded(ctx, &payment)
+	case PaymentEventFailed:
+		return s.markFailed(ctx, &payment, event.FailureReason)
+	default:
+		logging.FromContext(ctx).InfoContext(ctx, "ignoring payment webhook", "event", event.ID, "type", event.Type)
+		return nil
+	}
+}
+
+// markSucceeded records the payment as succeeded and the order as paid
+func (s *PaymentService) markSucceeded(ctx context.Context, payment *domain.Payment) error {
+	settled := false
+	var order domain.Order
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		settled, err = settlePayment(tx, payment, domain.PaymentStatusSucceeded, "")
+		if err != nil || !settled {
+			return err
+		}
+		if err := tx.Select("id", "subtotal").First(&order, payment.OrderID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Order{}).
+			Where("id = ? AND status = ?", payment.OrderID, domain.OrderStatusPending).
+			Update("status", domain.OrderStatusPaid).Error
+	})
+	if err == nil && settled {
+		metrics.Payments.WithLabelValues(domain.PaymentStatusSucceeded).Inc()
+		// Revenue is the wine sold, like refunds; shipping is passed on
+		metrics.Revenue.Add(order.Subtotal)
+	}
+	return err
+}
+
+// markFailed records the payment as failed, cancels the order and releases
+// the stock it reserved
+func (s *PaymentService) markFailed(ctx context.Context, payment *domain.Payment, reason string) error {
+	settled, restocked := false, false
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		settled, err = settlePayment(tx, payment, domain.PaymentStatusFailed, reason)
+		if err != nil || !settled {
+			return err
+		}
+
+		result := tx.Model(&domain.Order{}).
+			Where("id = ? AND status = ?", payment.OrderID, domain.OrderStatusPending).
+			Update("status", domain.OrderStatusCancelled)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		var items []domain.OrderItem
+		if err := tx.Where("order_id = ?", payment.OrderID).Find(&items).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := restock(tx, item.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+		restocked = len(items) > 0
+		return nil
+	})
+	if err == nil && restocked {
+		purgeCatalogue(s.Cache)
+	}
+	if err == nil && settled {
+		metrics.Payments.WithLabelValues(domain.PaymentStatusFailed).Inc()
+	}
+	return err
+}
+
+// settlePayment moves a payment to its final status, reporting false if a
+// concurrent delivery of the same outcome got there first
+func settlePayment(tx *gorm.DB, payment *domain.Payment, status, reason string) (bool, error) {
+	result := tx.Model(&domain.Payment{}).
+		Where("id = ? AND status NOT IN ?", payment.ID, []string{domain.PaymentStatusSucceeded, domain.PaymentStatusFailed}).
+		Updates(map[string]interface{}{"status": status, "failure_reason": reason})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	payment.Status = status
+	payment.FailureReason = reason
+	return result.RowsAffected == 1, nil
+}
+
+// reserveRefund records a pending refund of amount against an order's
+// successful payment. The payment row stays locked in tx until it commits,
+// so concurrent refunds cannot reserve more than was paid. Once tx has
+// committed, settleRefund asks the provider.
+func (s *PaymentService) reserveRefund(tx *gorm.DB, orderID uint, amount float64, returnID *uint, reason string) (*domain.Refund, error) {
+	if s.Provider == nil {
+		return nil, ErrPaymentsUnavailable
+	}
+	var payment domain.Payment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("order_id = ? AND status = ?", orderID, domain.PaymentStatusSucceeded).
+		First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoCapturedPayment
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var refunded float64
+	if err := tx.Model(&domain.Refund{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("payment_id = ? AND status <> ?", payment.ID, domain.RefundStatusFailed).
+		Scan(&refunded).Error; err != nil {
+		return nil, err
+	}
+	if amount > roundCents(payment.Amount-refunded) {
+		return nil, ErrRefundExceedsPayment
+	}
+
+	refund := domain.Refund{
+		OrderID:         orderID,
+		PaymentID:       payment.ID,
+		ReturnRequestID: returnID,
+		Amount:          amount,
+		Currency:        payment.Currency,
+		Status:          domain.RefundStatusPending,
+		Reason:          reason,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// settleRefund asks the provider to pay back a reserved refund and records
+// the outcome. No rows are locked while the provider is asked. A failed
+// refund no longer counts against the payment, so it can be tried again.
+func (s *PaymentService) settleRefund(ctx context.Context, refund *domain.Refund) error {
+	// Once the provider is asked, its answer must be recorded even if the
+	// client has gone away
+	ctx = context.WithoutCancel(ctx)
+	db := config.DB.WithContext(ctx)
+
+	var payment domain.Payment
+	if err := db.First(&payment, refund.PaymentID).Error; err != nil {
+		return err
+	}
+
+	providerRefund, err := s.Provider.Refund(ctx, payment.ProviderRef, refund.Amount)
+	if err != nil {
+		refund.Status = domain.RefundStatusFailed
+		if dbErr := db.Model(refund).Update("status", refund.Status).Error; dbErr != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "refund failed but not recorded",
+				"refund_id", refund.ID, "error", dbErr)
+		}
+		return ErrPaymentProviderFailed.Wrap(err)
+	}
+
+	refund.Status = domain.RefundStatusSucceeded
+	refund.ProviderRef = providerRefund.Ref
+	if err := db.Model(refund).Updates(map[string]interface{}{
+		"status":       refund.Status,
+		"provider_ref": refund.ProviderRef,
+	}).Error; err != nil {
+		// The money has already gone back to the customer
+		logging.FromContext(ctx).ErrorContext(ctx, "refund issued but not recorded",
+			"refund_id", refund.ID, "provider_ref", providerRefund.Ref, "amount", refund.Amount, "error", err)
+		return err
+	}
+	return nil
+}
+
+// roundCents rounds an amount to whole cents
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
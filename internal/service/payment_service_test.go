@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestExpirePayments_CancelsOrderAndRestocks(t *testing.T) {
+	db := useTestDB(t, &domain.Product{}, &domain.Order{}, &domain.OrderItem{}, &domain.Payment{})
+
+	mock := NewMockPaymentProvider(MockScenario3DS, []byte("secret"), "")
+	s := &PaymentService{Provider: mock, Currency: "USD"}
+	ctx := context.Background()
+	intent, _ := mock.CreateIntent(ctx, PaymentIntentRequest{Amount: 40})
+
+	product := domain.Product{Name: "Barolo", Price: 20, Stock: 5}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("Expected to create a product, got %v", err)
+	}
+	order := domain.Order{
+		Status: domain.OrderStatusPending,
+		Total:  40,
+		Items:  []domain.OrderItem{{ProductID: product.ID, Quantity: 2, Price: 20}},
+		Payments: []domain.Payment{{
+			Provider:    mock.Name(),
+			ProviderRef: intent.Ref,
+			Amount:      40,
+			Currency:    "USD",
+			Status:      domain.PaymentStatusRequiresAction,
+		}},
+	}
+	order.Payments[0].CreatedAt = time.Now().Add(-time.Hour)
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("Expected to create an order, got %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("order_id = ?", order.ID).Delete(&domain.Payment{})
+		db.Unscoped().Where("order_id = ?", order.ID).Delete(&domain.OrderItem{})
+		db.Unscoped().Delete(&order)
+		db.Unscoped().Delete(&product)
+	})
+
+	expired, err := s.ExpirePayments(ctx, time.Now().Add(-30*time.Minute))
+	if err != nil || expired != 1 {
+		t.Fatalf("Expected one payment to expire, got %d %v", expired, err)
+	}
+
+	var payment domain.Payment
+	db.Where("order_id = ?", order.ID).First(&payment)
+	db.First(&order, order.ID)
+	db.First(&product, product.ID)
+	if payment.Status != domain.PaymentStatusFailed || payment.FailureReason != PaymentFailureExpired {
+		t.Errorf("Expected the payment to fail as expired, got %s %s", payment.Status, payment.FailureReason)
+	}
+	if order.Status != domain.OrderStatusCancelled || product.Stock != 7 {
+		t.Errorf("Expected the order cancelled and its bottles restocked, got %s with stock %d", order.Status, product.Stock)
+	}
+	if err := mock.CompleteChallenge(intent.Ref, true); err == nil {
+		t.Error("Expected the expired intent to be cancelled at the provider")
+	}
+}
+
+func TestHandleWebhook_RejectsAmountMismatch(t *testing.T) {
+	db := useTestDB(t, &domain.Order{}, &domain.Payment{})
+
+	mock := NewMockPaymentProvider(MockScenarioSuccess, []byte("secret"), "")
+	s := &PaymentService{Provider: mock, Currency: "USD"}
+	order := domain.Order{
+		Status:   domain.OrderStatusPending,
+		Total:    40,
+		Payments: []domain.Payment{{Provider: mock.Name(), ProviderRef: "mock_pi_mismatch", Amount: 40, Currency: "USD", Status: domain.PaymentStatusProcessing}},
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("Expected to create an order, got %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("order_id = ?", order.ID).Delete(&domain.Payment{})
+		db.Unscoped().Delete(&order)
+	})
+
+	for _, payload := range []string{
+		`{"id":"evt_1","type":"payment.succeeded","ref":"mock_pi_mismatch","amount":4,"currency":"USD"}`,
+		`{"id":"evt_2","type":"payment.succeeded","ref":"mock_pi_mismatch","amount":40,"currency":"JPY"}`,
+	} {
+		header := http.Header{}
+		header.Set(MockSignatureHeader, mock.Sign([]byte(payload), time.Now()))
+		if err := s.HandleWebhook(context.Background(), []byte(payload), header); !errors.Is(err, ErrWebhookAmountMismatch) {
+			t.Errorf("%s: expected ErrWebhookAmountMismatch, got %v", payload, err)
+		}
+	}
+
+	db.First(&order, order.ID)
+	if order.Status != domain.OrderStatusPending {
+		t.Errorf("Expected the order to stay pending, got %s", order.Status)
+	}
+}
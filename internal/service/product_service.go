@@ -1,28 +1,58 @@
 package service
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/mergepatch"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrProductVersionMismatch = PreconditionFailed("version_mismatch", "product was changed by someone else, reload it and try again")
+	ErrInvalidMergePatch      = Validation("invalid_merge_patch", "request body is not a valid JSON Merge Patch")
 )
 
-type ProductService struct{}
+// CatalogueCache holds responses derived from products and is purged
+// whenever a product is created, updated or deleted, or its stock moves
+type CatalogueCache interface {
+	Purge()
+}
+
+type ProductService struct {
+	Cache CatalogueCache // optional
+}
+
+func (s *ProductService) CreateProduct(ctx context.Context, product *domain.Product) (*domain.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.CreateProduct")
+	defer span.End()
 
-func (s *ProductService) CreateProduct(product *domain.Product) (*domain.Product, error) {
-	if err := config.DB.Create(&product).Error; err != nil {
+	product.Version = 1
+	if err := config.DB.WithContext(ctx).Create(&product).Error; err != nil {
 		return nil, err
 	}
+	s.invalidate()
 	return product, nil
 }
 
-func (s *ProductService) GetAllProducts(page, limit int, search, category string) ([]domain.Product, int64, error) {
+func (s *ProductService) GetAllProducts(ctx context.Context, page, limit int, search, category string) ([]domain.Product, int64, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetAllProducts")
+	defer span.End()
+
 	var products []domain.Product
 	var total int64
 
 	offset := (page - 1) * limit
 
-	query := config.DB.Model(&domain.Product{})
+	query := config.DB.WithContext(ctx).Model(&domain.Product{})
 
 	// Apply search filter
 	if search != "" {
@@ -45,38 +75,179 @@ func (s *ProductService) GetAllProducts(page, limit int, search, category string
 	return products, total, nil
 }
 
-func (s *ProductService) GetProductByID(id uint) (*domain.Product, error) {
+func (s *ProductService) GetProductByID(ctx context.Context, id uint) (*domain.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.GetProductByID")
+	defer span.End()
+
 	var product domain.Product
-	if err := config.DB.First(&product, id).Error; err != nil {
-		return nil, errors.New("product not found")
+	if err := config.DB.WithContext(ctx).First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
 	}
 	return &product, nil
 }
 
-func (s *ProductService) UpdateProduct(id uint, input *domain.Product) (*domain.Product, error) {
-	var product domain.Product
-	if err := config.DB.First(&product, id).Error; err != nil {
-		return nil, errors.New("product not found")
+// UpdateProduct replaces the editable fields of a product. version is the
+// version the client last read; the update fails with
+// ErrProductVersionMismatch if the product changed since. A zero version
+// (If-Match: *) replaces whatever version is current, but still fails if
+// another write lands between reading it and updating.
+func (s *ProductService) UpdateProduct(ctx context.Context, id, version uint, input *domain.Product) (*domain.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.UpdateProduct")
+	defer span.End()
+
+	if version == 0 {
+		product, err := s.GetProductByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		version = product.Version
+	}
+	return s.update(ctx, id, version, input)
+}
+
+// PatchProduct applies a JSON Merge Patch (RFC 7396) to a product, so fields
+// missing from the patch keep their values. version works as in UpdateProduct.
+func (s *ProductService) PatchProduct(ctx context.Context, id, version uint, patch []byte) (*domain.Product, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.PatchProduct")
+	defer span.End()
+
+	product, err := s.GetProductByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && product.Version != version {
+		return nil, ErrProductVersionMismatch
+	}
+
+	doc, err := json.Marshal(product)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := mergepatch.Apply(doc, patch)
+	if err != nil {
+		return nil, ErrInvalidMergePatch
+	}
+	var input domain.Product
+	if err := json.Unmarshal(merged, &input); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, invalidField(typeErr.Field, "type", fmt.Sprintf("%s must be of type %s", typeErr.Field, typeErr.Type))
+		}
+		return nil, ErrInvalidMergePatch
 	}
 
-	// Update fields
-	product.Name = input.Name
-	product.Description = input.Description
-	product.Price = input.Price
-	product.Stock = input.Stock
-	product.ImageURL = input.ImageURL
-	product.Category = input.Category
+	// Update against the version read above, so a concurrent write between
+	// the read and the update is not lost
+	return s.update(ctx, id, product.Version, &input)
+}
 
-	if err := config.DB.Save(&product).Error; err != nil {
+func (s *ProductService) update(ctx context.Context, id, version uint, input *domain.Product) (*domain.Product, error) {
+	if err := validateProduct(input); err != nil {
 		return nil, err
 	}
 
-	return &product, nil
+	result := config.DB.WithContext(ctx).Model(&domain.Product{}).Where("id = ? AND version = ?", id, version).Updates(map[string]interface{}{
+		"name":         input.Name,
+		"description":  input.Description,
+		"price":        input.Price,
+		"stock":        input.Stock,
+		"image_url":    input.ImageURL,
+		"category":     input.Category,
+		"weight_grams": input.WeightGrams,
+		"volume_ml":    input.VolumeML,
+		"version":      gorm.Expr("version + 1"),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Either the product is gone or its version moved on
+		if _, err := s.GetProductByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrProductVersionMismatch
+	}
+	s.invalidate()
+
+	return s.GetProductByID(ctx, id)
+}
+
+// validateProduct checks the fields an update would store
+func validateProduct(p *domain.Product) error {
+	var fields []FieldError
+	if p.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Code: "required", Message: "is required"})
+	}
+	if p.Price < 0 {
+		fields = append(fields, FieldError{Field: "price", Code: "min", Message: "must be at least 0"})
+	}
+	if p.Stock < 0 {
+		fields = append(fields, FieldError{Field: "stock", Code: "min", Message: "must be at least 0"})
+	}
+	if p.WeightGrams < 0 {
+		fields = append(fields, FieldError{Field: "weight_grams", Code: "min", Message: "must be at least 0"})
+	}
+	if p.VolumeML < 0 {
+		fields = append(fields, FieldError{Field: "volume_ml", Code: "min", Message: "must be at least 0"})
+	}
+	if len(fields) > 0 {
+		return Validation("validation_failed", "One or more fields are invalid", fields...)
+	}
+	return nil
 }
 
-func (s *ProductService) DeleteProduct(id uint) error {
-	if err := config.DB.Delete(&domain.Product{}, id).Error; err != nil {
-		return err
+func (s *ProductService) DeleteProduct(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "ProductService.DeleteProduct")
+	defer span.End()
+
+	result := config.DB.WithContext(ctx).Delete(&domain.Product{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProductNotFound
 	}
+	s.invalidate()
 	return nil
 }
+
+// LastModified returns when any product was last created, changed or
+// deleted, or the zero time for an empty catalogue
+func (s *ProductService) LastModified(ctx context.Context) (time.Time, error) {
+	ctx, span := tracing.Start(ctx, "ProductService.LastModified")
+	defer span.End()
+
+	var lastModified sql.NullTime
+	err := config.DB.WithContext(ctx).Unscoped().Model(&domain.Product{}).
+		Select("MAX(GREATEST(updated_at, COALESCE(deleted_at, updated_at)))").
+		Scan(&lastModified).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	return lastModified.Time, nil
+}
+
+func (s *ProductService) invalidate() {
+	purgeCatalogue(s.Cache)
+}
+
+// purgeCatalogue empties cache, if there is one, after stock or product
+// changes have committed
+func purgeCatalogue(cache CatalogueCache) {
+	if cache != nil {
+		cache.Purge()
+	}
+}
+
+// restock returns quantity bottles to a product's stock
+func restock(tx *gorm.DB, productID uint, quantity int) error {
+	return tx.Model(&domain.Product{}).Where("id = ?", productID).
+		UpdateColumns(map[string]interface{}{
+			"stock":      gorm.Expr("stock + ?", quantity),
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestUpdateProduct_AnyVersionKeepsConcurrentWrites(t *testing.T) {
+	db := useTestDB(t, &domain.Product{})
+
+	product := domain.Product{Name: "Rioja", Price: 20, Stock: 10}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("Expected to create a product, got %v", err)
+	}
+	t.Cleanup(func() { db.Unscoped().Delete(&product) })
+
+	// A checkout takes a bottle right after the update reads the product
+	bumped := false
+	err := db.Callback().Query().After("gorm:query").Register("test:checkout", func(tx *gorm.DB) {
+		if bumped {
+			return
+		}
+		bumped = true
+		tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE products SET stock = stock - 1, version = version + 1 WHERE id = ?", product.ID)
+	})
+	if err != nil {
+		t.Fatalf("Expected to register the callback, got %v", err)
+	}
+
+	s := &ProductService{}
+	_, err = s.UpdateProduct(context.Background(), product.ID, 0, &domain.Product{Name: "Rioja Reserva", Price: 25, Stock: 10})
+	if !errors.Is(err, ErrProductVersionMismatch) {
+		t.Fatalf("Expected If-Match: * to fail against a concurrent write, got %v", err)
+	}
+
+	var stored domain.Product
+	db.First(&stored, product.ID)
+	if stored.Stock != 9 || stored.Name != "Rioja" {
+		t.Errorf("Expected the checkout's stock change to survive, got stock %d name %q", stored.Stock, stored.Name)
+	}
+}
@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxReturnPhotos limits the photos attached to one return
+const MaxReturnPhotos = 5
+
+var (
+	ErrOrderNotFound         = NotFound("order_not_found", "order not found")
+	ErrOrderNotReturnable    = Conflict("order_not_returnable", "only paid orders can be returned")
+	ErrReturnNotFound        = NotFound("return_not_found", "return not found")
+	ErrReturnStatus          = Conflict("invalid_return_status", "the return is not in a state that allows this")
+	ErrTooManyReturnPhotos   = Conflict("too_many_return_photos", fmt.Sprintf("a return can have at most %d photos", MaxReturnPhotos))
+	ErrRefundExceedsReturn   = Conflict("refund_exceeds_return", "refunds cannot exceed the value of the returned items")
+	ErrReturnAlreadyRefunded = Conflict("return_already_refunded", "the returned items have already been refunded in full")
+)
+
+// ReturnService handles return requests (RMAs) for delivered bottles, such as
+// corked or broken wine. Customers request a return of some order items;
+// admins approve or reject it, record when the bottles arrive and refund all
+// or part of their value through the order's payment.
+type ReturnService struct {
+	Payments *PaymentService
+	Cache    CatalogueCache // optional; purged when received bottles are restocked
+}
+
+// ReturnInput is a customer's return request
+type ReturnInput struct {
+	Reason  string
+	Details string
+	Items   []ReturnItemInput
+}
+
+// ReturnItemInput selects a quantity of one order item
+type ReturnItemInput struct {
+	OrderItemID uint
+	Quantity    int
+}
+
+// CreateReturn opens a return against items of one of the user's orders. An
+// item can only be returned up to the quantity bought, less what is already
+// in other returns that were not rejected.
+func (s *ReturnService) CreateReturn(ctx context.Context, userID, orderID uint, input ReturnInput) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.CreateReturn")
+	defer span.End()
+
+	request := domain.ReturnRequest{
+		OrderID: orderID,
+		UserID:  userID,
+		Reason:  input.Reason,
+		Details: input.Details,
+		Status:  domain.ReturnStatusRequested,
+	}
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locking the order serialises returns against it, so two requests
+		// cannot both claim the last bottle
+		var order domain.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", orderID, userID).
+			First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOrderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if order.Status == domain.OrderStatusPending || order.Status == domain.OrderStatusCancelled {
+			return ErrOrderNotReturnable
+		}
+
+		returnable, err := returnableQuantities(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		var fields []FieldError
+		requested := make(map[uint]int)
+		for i, item := range input.Items {
+			field := fmt.Sprintf("items[%d]", i)
+			left, ok := returnable[item.OrderItemID]
+			switch {
+			case !ok:
+				fields = append(fields, FieldError{Field: field + ".order_item_id", Code: "not_in_order", Message: "is not an item of this order"})
+			case item.Quantity > left-requested[item.OrderItemID]:
+				fields = append(fields, FieldError{Field: field + ".quantity", Code: "max", Message: fmt.Sprintf("must be at most %d", left-requested[item.OrderItemID])})
+			}
+			requested[item.OrderItemID] += item.Quantity
+			request.Items = append(request.Items, domain.ReturnItem{OrderItemID: item.OrderItemID, Quantity: item.Quantity})
+		}
+		if len(fields) > 0 {
+			return Validation("validation_failed", "One or more fields are invalid", fields...)
+		}
+
+		return tx.Create(&request).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.load(config.DB.WithContext(ctx), request.ID)
+}
+
+// returnableQuantities maps each item of an order to the quantity that is
+// not yet part of a pending or accepted return
+func returnableQuantities(tx *gorm.DB, orderID uint) (map[uint]int, error) {
+	var items []domain.OrderItem
+	if err := tx.Where("order_id = ?", orderID).Find(&items).Error; err != nil {
+		return nil, err
+	}
+	returnable := make(map[uint]int, len(items))
+	for _, item := range items {
+		returnable[item.ID] = item.Quantity
+	}
+
+	var returned []struct {
+		OrderItemID uint
+		Quantity    int
+	}
+	err := tx.Table("return_items").
+		Select("return_items.order_item_id, SUM(return_items.quantity) AS quantity").
+		Joins("JOIN return_requests ON return_requests.id = return_items.return_request_id").
+		Where("return_requests.order_id = ? AND return_requests.status <> ?", orderID, domain.ReturnStatusRejected).
+		Where("return_items.deleted_at IS NULL AND return_requests.deleted_at IS NULL").
+		Group("return_items.order_item_id").
+		Scan(&returned).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range returned {
+		returnable[r.OrderItemID] -= r.Quantity
+	}
+	return returnable, nil
+}
+
+// AddPhoto attaches a photo, already uploaded to url, to one of the user's
+// returns that is still open
+func (s *ReturnService) AddPhoto(ctx context.Context, userID, returnID uint, url string) (*domain.ReturnPhoto, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.AddPhoto")
+	defer span.End()
+
+	photo := domain.ReturnPhoto{ReturnRequestID: returnID, URL: url}
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		request, err := lockReturn(tx, returnID)
+		if err != nil {
+			return err
+		}
+		if request.UserID != userID {
+			return ErrReturnNotFound
+		}
+		if request.Status != domain.ReturnStatusRequested && request.Status != domain.ReturnStatusApproved {
+			return ErrReturnStatus.WithMessage("photos can only be added to open returns")
+		}
+
+		var count int64
+		if err := tx.Model(&domain.ReturnPhoto{}).Where("return_request_id = ?", returnID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= MaxReturnPhotos {
+			return ErrTooManyReturnPhotos
+		}
+		return tx.Create(&photo).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &photo, nil
+}
+
+// GetUserReturns lists the user's returns, newest first
+func (s *ReturnService) GetUserReturns(ctx context.Context, userID uint) ([]domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.GetUserReturns")
+	defer span.End()
+
+	returns := []domain.ReturnRequest{}
+	if err := preloadReturn(config.DB.WithContext(ctx)).Where("user_id = ?", userID).Order("created_at desc").Find(&returns).Error; err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// GetUserReturn returns one of the user's returns. Other users' returns are
+// reported as not found.
+func (s *ReturnService) GetUserReturn(ctx context.Context, userID, returnID uint) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.GetUserReturn")
+	defer span.End()
+
+	request, err := s.load(config.DB.WithContext(ctx), returnID)
+	if err != nil {
+		return nil, err
+	}
+	if request.UserID != userID {
+		return nil, ErrReturnNotFound
+	}
+	return request, nil
+}
+
+// GetReturns lists all returns for admins, optionally only those in status
+func (s *ReturnService) GetReturns(ctx context.Context, status string) ([]domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.GetReturns")
+	defer span.End()
+
+	query := preloadReturn(config.DB.WithContext(ctx))
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	returns := []domain.ReturnRequest{}
+	if err := query.Order("created_at desc").Find(&returns).Error; err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// GetReturn returns any return, for admins
+func (s *ReturnService) GetReturn(ctx context.Context, returnID uint) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.GetReturn")
+	defer span.End()
+
+	return s.load(config.DB.WithContext(ctx), returnID)
+}
+
+// Approve accepts a requested return, so the customer can send the bottles
+func (s *ReturnService) Approve(ctx context.Context, returnID uint, note string) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.Approve")
+	defer span.End()
+
+	return s.decide(ctx, returnID, domain.ReturnStatusApproved, note)
+}
+
+// Reject declines a requested return. Its items can be returned again.
+func (s *ReturnService) Reject(ctx context.Context, returnID uint, note string) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.Reject")
+	defer span.End()
+
+	return s.decide(ctx, returnID, domain.ReturnStatusRejected, note)
+}
+
+func (s *ReturnService) decide(ctx context.Context, returnID uint, status, note string) (*domain.ReturnRequest, error) {
+	db := config.DB.WithContext(ctx)
+	result := db.Model(&domain.ReturnRequest{}).
+		Where("id = ? AND status = ?", returnID, domain.ReturnStatusRequested).
+		Updates(map[string]interface{}{"status": status, "admin_note": note})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := s.load(db, returnID); err != nil {
+			return nil, err
+		}
+		return nil, ErrReturnStatus.WithMessage("only requested returns can be approved or rejected")
+	}
+	return s.load(db, returnID)
+}
+
+// Receive records that the bottles of an approved return arrived. With
+// restock, the returned quantities go back into stock, e.g. for unopened
+// bottles sent back as the wrong item.
+func (s *ReturnService) Receive(ctx context.Context, returnID uint, restockItems bool) (*domain.ReturnRequest, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.Receive")
+	defer span.End()
+
+	db := config.DB.WithContext(ctx)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		request, err := lockReturn(tx, returnID)
+		if err != nil {
+			return err
+		}
+		if request.Status != domain.ReturnStatusApproved {
+			return ErrReturnStatus.WithMessage("only approved returns can be received")
+		}
+
+		now := time.Now()
+		if err := tx.Model(request).Updates(map[string]interface{}{
+			"status":      domain.ReturnStatusReceived,
+			"received_at": &now,
+			"restocked":   restockItems,
+		}).Error; err != nil {
+			return err
+		}
+		if !restockItems {
+			return nil
+		}
+
+		var items []domain.ReturnItem
+		if err := tx.Preload("OrderItem").Where("return_request_id = ?", returnID).Find(&items).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := restock(tx, item.OrderItem.ProductID, item.Quantity); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if restockItems {
+		purgeCatalogue(s.Cache)
+	}
+	return s.load(db, returnID)
+}
+
+// Refund pays back amount of an approved or received return through the
+// order's payment. A zero amount refunds whatever of the returned items'
+// value has not been refunded yet. The refund is reserved while the return
+// and payment are locked, and the provider is asked after they are released.
+func (s *ReturnService) Refund(ctx context.Context, returnID uint, amount float64, reason string) (*domain.Refund, error) {
+	ctx, span := tracing.Start(ctx, "ReturnService.Refund")
+	defer span.End()
+
+	var refund *domain.Refund
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockReturn(tx, returnID); err != nil {
+			return err
+		}
+		request, err := s.load(tx, returnID)
+		if err != nil {
+			return err
+		}
+		if request.Status != domain.ReturnStatusApproved && request.Status != domain.ReturnStatusReceived {
+			return ErrReturnStatus.WithMessage("only approved or received returns can be refunded")
+		}
+
+		remaining := roundCents(request.Value() - request.Refunded())
+		if remaining <= 0 {
+			return ErrReturnAlreadyRefunded
+		}
+		if amount == 0 {
+			amount = remaining
+		}
+		amount = roundCents(amount)
+		if amount > remaining {
+			return ErrRefundExceedsReturn.WithMessage(fmt.Sprintf("at most %.2f of this return can still be refunded", remaining))
+		}
+
+		returnID := request.ID
+		refund, err = s.Payments.reserveRefund(tx, request.OrderID, amount, &returnID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Payments.settleRefund(ctx, refund); err != nil {
+		return nil, err
+	}
+	metrics.Refunds.Add(refund.Amount)
+	return refund, nil
+}
+
+// lockReturn loads a return and locks it for the rest of tx
+func lockReturn(tx *gorm.DB, returnID uint) (*domain.ReturnRequest, error) {
+	var request domain.ReturnRequest
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&request, returnID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (s *ReturnService) load(db *gorm.DB, returnID uint) (*domain.ReturnRequest, error) {
+	var request domain.ReturnRequest
+	err := preloadReturn(db).First(&request, returnID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func preloadReturn(db *gorm.DB) *gorm.DB {
+	return db.Preload("Items.OrderItem.Product").Preload("Photos").Preload("Refunds")
+}
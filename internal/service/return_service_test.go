@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"wine-shop-api/internal/domain"
+)
+
+// returnFixture is a paid order of one product, with its payment captured
+// by a mock provider unless the fixture was made uncaptured
+type returnFixture struct {
+	db      *gorm.DB
+	mock    *MockPaymentProvider
+	service *ReturnService
+	product domain.Product
+	order   domain.Order
+	ref     string
+}
+
+func newReturnFixture(t *testing.T, quantity int, price, paid float64, capture bool) *returnFixture {
+	t.Helper()
+	db := useTestDB(t, &domain.Product{}, &domain.Order{}, &domain.OrderItem{}, &domain.Payment{}, &domain.Refund{},
+		&domain.ReturnRequest{}, &domain.ReturnItem{}, &domain.ReturnPhoto{})
+
+	mock := NewMockPaymentProvider(MockScenario3DS, []byte("secret"), "")
+	events := webhookReceiver(t, mock)
+	ctx := context.Background()
+	intent, err := mock.CreateIntent(ctx, PaymentIntentRequest{Amount: paid, Currency: "USD"})
+	if err != nil {
+		t.Fatalf("Expected to create an intent, got %v", err)
+	}
+	if capture {
+		mock.CompleteChallenge(intent.Ref, true)
+		awaitEvent(t, events)
+		if err := mock.Capture(ctx, intent.Ref, paid); err != nil {
+			t.Fatalf("Expected to capture the payment, got %v", err)
+		}
+	}
+
+	f := &returnFixture{db: db, mock: mock, ref: intent.Ref}
+	f.service = &ReturnService{Payments: &PaymentService{Provider: mock, Currency: "USD"}}
+	f.product = domain.Product{Name: "Chablis", Price: price, Stock: 10}
+	if err := db.Create(&f.product).Error; err != nil {
+		t.Fatalf("Expected to create a product, got %v", err)
+	}
+	f.order = domain.Order{
+		UserID: 7,
+		Status: domain.OrderStatusPaid,
+		Total:  paid,
+		Items:  []domain.OrderItem{{ProductID: f.product.ID, Quantity: quantity, Price: price}},
+		Payments: []domain.Payment{{
+			Provider:    mock.Name(),
+			ProviderRef: intent.Ref,
+			Amount:      paid,
+			Currency:    "USD",
+			Status:      domain.PaymentStatusSucceeded,
+		}},
+	}
+	if err := db.Create(&f.order).Error; err != nil {
+		t.Fatalf("Expected to create an order, got %v", err)
+	}
+	t.Cleanup(func() {
+		var returnIDs []uint
+		db.Unscoped().Model(&domain.ReturnRequest{}).Where("order_id = ?", f.order.ID).Pluck("id", &returnIDs)
+		db.Unscoped().Where("return_request_id IN ?", append(returnIDs, 0)).Delete(&domain.ReturnItem{})
+		db.Unscoped().Where("return_request_id IN ?", append(returnIDs, 0)).Delete(&domain.ReturnPhoto{})
+		db.Unscoped().Where("order_id = ?", f.order.ID).Delete(&domain.Refund{})
+		db.Unscoped().Where("order_id = ?", f.order.ID).Delete(&domain.ReturnRequest{})
+		db.Unscoped().Where("order_id = ?", f.order.ID).Delete(&domain.Payment{})
+		db.Unscoped().Where("order_id = ?", f.order.ID).Delete(&domain.OrderItem{})
+		db.Unscoped().Delete(&f.order)
+		db.Unscoped().Delete(&f.product)
+	})
+	return f
+}
+
+// approvedReturn opens a return of quantity bottles and approves it
+func (f *returnFixture) approvedReturn(t *testing.T, quantity int) *domain.ReturnRequest {
+	t.Helper()
+	ctx := context.Background()
+	request, err := f.service.CreateReturn(ctx, f.order.UserID, f.order.ID, ReturnInput{
+		Reason: domain.ReturnReasonCorked,
+		Items:  []ReturnItemInput{{OrderItemID: f.order.Items[0].ID, Quantity: quantity}},
+	})
+	if err != nil {
+		t.Fatalf("Expected to create a return, got %v", err)
+	}
+	if request, err = f.service.Approve(ctx, request.ID, ""); err != nil {
+		t.Fatalf("Expected to approve the return, got %v", err)
+	}
+	return request
+}
+
+func TestCreateReturn_RefusesMoreThanBought(t *testing.T) {
+	f := newReturnFixture(t, 3, 20, 60, true)
+	ctx := context.Background()
+	item := f.order.Items[0].ID
+
+	var validation *Error
+	_, err := f.service.CreateReturn(ctx, f.order.UserID, f.order.ID, ReturnInput{
+		Reason: domain.ReturnReasonBroken,
+		Items:  []ReturnItemInput{{OrderItemID: item, Quantity: 2}, {OrderItemID: item, Quantity: 2}},
+	})
+	if !errors.As(err, &validation) || len(validation.Fields) != 1 || validation.Fields[0].Field != "items[1].quantity" {
+		t.Fatalf("Expected items[1].quantity to be refused, got %v", err)
+	}
+
+	first := f.approvedReturn(t, 2)
+	_, err = f.service.CreateReturn(ctx, f.order.UserID, f.order.ID, ReturnInput{
+		Reason: domain.ReturnReasonBroken,
+		Items:  []ReturnItemInput{{OrderItemID: item, Quantity: 2}},
+	})
+	if !errors.As(err, &validation) {
+		t.Errorf("Expected bottles already in a return to be refused, got %v", err)
+	}
+	if _, err := f.service.CreateReturn(ctx, f.order.UserID, f.order.ID, ReturnInput{
+		Reason: domain.ReturnReasonBroken,
+		Items:  []ReturnItemInput{{OrderItemID: item, Quantity: 1}},
+	}); err != nil {
+		t.Errorf("Expected the last bottle to be returnable besides return %d, got %v", first.ID, err)
+	}
+}
+
+func TestRefund_RefusesMoreThanReturnedOrPaid(t *testing.T) {
+	// The customer paid 30 for two bottles listed at 20
+	f := newReturnFixture(t, 2, 20, 30, true)
+	request := f.approvedReturn(t, 2)
+	ctx := context.Background()
+
+	if _, err := f.service.Refund(ctx, request.ID, 45, ""); !errors.Is(err, ErrRefundExceedsReturn) {
+		t.Errorf("Expected ErrRefundExceedsReturn, got %v", err)
+	}
+	if _, err := f.service.Refund(ctx, request.ID, 0, ""); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Errorf("Expected ErrRefundExceedsPayment, got %v", err)
+	}
+	if _, err := f.service.Refund(ctx, request.ID, 30, ""); err != nil {
+		t.Errorf("Expected what was paid to be refundable, got %v", err)
+	}
+
+	var count int64
+	f.db.Model(&domain.Refund{}).Where("order_id = ?", f.order.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected only the allowed refund to be recorded, got %d", count)
+	}
+}
+
+// lockProbeProvider checks, while a refund is asked for, whether its
+// payment row is still locked by the refunding transaction
+type lockProbeProvider struct {
+	*MockPaymentProvider
+	db     *gorm.DB
+	locked error
+}
+
+func (p *lockProbeProvider) Refund(ctx context.Context, ref string, amount float64) (*PaymentRefund, error) {
+	p.locked = p.db.Exec("SELECT id FROM payments WHERE provider_ref = ? FOR UPDATE NOWAIT", ref).Error
+	return p.MockPaymentProvider.Refund(ctx, ref, amount)
+}
+
+func TestRefund_AsksProviderWithoutLocks(t *testing.T) {
+	f := newReturnFixture(t, 2, 20, 40, true)
+	probe := &lockProbeProvider{MockPaymentProvider: f.mock, db: f.db}
+	f.service.Payments.Provider = probe
+	request := f.approvedReturn(t, 2)
+
+	refund, err := f.service.Refund(context.Background(), request.ID, 15, "corked")
+	if err != nil {
+		t.Fatalf("Expected the refund to succeed, got %v", err)
+	}
+	if probe.locked != nil {
+		t.Errorf("Expected the payment not to be locked while the provider is asked, got %v", probe.locked)
+	}
+
+	var stored domain.Refund
+	f.db.First(&stored, refund.ID)
+	if stored.Status != domain.RefundStatusSucceeded || stored.ProviderRef == "" || stored.Amount != 15 {
+		t.Errorf("Expected a succeeded refund of 15 with the provider's ID, got %+v", stored)
+	}
+}
+
+func TestRefund_ProviderFailureFreesTheAmount(t *testing.T) {
+	f := newReturnFixture(t, 2, 20, 40, false)
+	request := f.approvedReturn(t, 2)
+	ctx := context.Background()
+
+	if _, err := f.service.Refund(ctx, request.ID, 0, ""); !errors.Is(err, ErrPaymentProviderFailed) {
+		t.Fatalf("Expected ErrPaymentProviderFailed for an uncaptured payment, got %v", err)
+	}
+	var failed domain.Refund
+	f.db.Where("order_id = ?", f.order.ID).First(&failed)
+	if failed.Status != domain.RefundStatusFailed {
+		t.Errorf("Expected the refund to be recorded as failed, got %q", failed.Status)
+	}
+
+	f.mock.CompleteChallenge(f.ref, true)
+	if err := f.mock.Capture(ctx, f.ref, 40); err != nil {
+		t.Fatalf("Expected to capture the payment, got %v", err)
+	}
+	if refund, err := f.service.Refund(ctx, request.ID, 0, ""); err != nil || refund.Amount != 40 {
+		t.Errorf("Expected the full 40 to be refundable after the failure, got %+v %v", refund, err)
+	}
+}
+
+func TestRefund_ConcurrentRefundsStayWithinReturn(t *testing.T) {
+	f := newReturnFixture(t, 2, 20, 40, true)
+	request := f.approvedReturn(t, 2)
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := f.service.Refund(context.Background(), request.ID, 10, "")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrRefundExceedsReturn), errors.Is(err, ErrReturnAlreadyRefunded):
+		default:
+			t.Errorf("Expected refunds past the return's value to be refused, got %v", err)
+		}
+	}
+
+	var refunded float64
+	f.db.Model(&domain.Refund{}).Select("COALESCE(SUM(amount), 0)").
+		Where("order_id = ? AND status = ?", f.order.ID, domain.RefundStatusSucceeded).Scan(&refunded)
+	if succeeded != 4 || refunded != 40 {
+		t.Errorf("Expected 4 refunds of 10, got %d totalling %.2f", succeeded, refunded)
+	}
+}
+
+func TestReceive_RestocksReturnedBottles(t *testing.T) {
+	tests := []struct {
+		restock bool
+		stock   int
+	}{
+		{false, 10},
+		{true, 12},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("restock=%v", tt.restock), func(t *testing.T) {
+			f := newReturnFixture(t, 2, 20, 40, true)
+			request := f.approvedReturn(t, 2)
+
+			var product domain.Product
+			f.db.First(&product, f.product.ID)
+			if product.Stock != 10 {
+				t.Fatalf("Expected approval to leave stock alone, got %d", product.Stock)
+			}
+
+			received, err := f.service.Receive(context.Background(), request.ID, tt.restock)
+			if err != nil {
+				t.Fatalf("Expected to receive the return, got %v", err)
+			}
+			f.db.First(&product, f.product.ID)
+			if product.Stock != tt.stock || received.Restocked != tt.restock || received.Status != domain.ReturnStatusReceived {
+				t.Errorf("Expected stock %d after receiving, got %d (%+v)", tt.stock, product.Stock, received)
+			}
+		})
+	}
+}
@@ -1,48 +1,75 @@
 package service
 
 import (
+	"context"
 	"errors"
 
 	"wine-shop-api/internal/domain"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyReviewed = Conflict("already_reviewed", "you have already reviewed this product")
+	ErrReviewNotFound  = NotFound("review_not_found", "review not found")
+	ErrNotReviewOwner  = Forbidden("not_review_owner", "you can only delete your own reviews")
 )
 
 type ReviewService struct{}
 
 // CreateReview creates a new review for a product
-func (s *ReviewService) CreateReview(review *domain.Review) (*domain.Review, error) {
+func (s *ReviewService) CreateReview(ctx context.Context, review *domain.Review) (*domain.Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewService.CreateReview")
+	defer span.End()
+
+	var product domain.Product
+	if err := config.DB.WithContext(ctx).Select("id").First(&product, review.ProductID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+
 	// Check if user already reviewed this product
 	var existing domain.Review
-	if err := config.DB.Where("product_id = ? AND user_id = ?", review.ProductID, review.UserID).First(&existing).Error; err == nil {
-		return nil, errors.New("you have already reviewed this product")
+	if err := config.DB.WithContext(ctx).Where("product_id = ? AND user_id = ?", review.ProductID, review.UserID).First(&existing).Error; err == nil {
+		return nil, ErrAlreadyReviewed
 	}
 
-	if err := config.DB.Create(review).Error; err != nil {
+	if err := config.DB.WithContext(ctx).Create(review).Error; err != nil {
 		return nil, err
 	}
 
 	// Load user data
-	config.DB.Preload("User").First(review, review.ID)
+	config.DB.WithContext(ctx).Preload("User").First(review, review.ID)
 	return review, nil
 }
 
 // GetProductReviews gets all reviews for a product
-func (s *ReviewService) GetProductReviews(productID uint) ([]domain.Review, error) {
+func (s *ReviewService) GetProductReviews(ctx context.Context, productID uint) ([]domain.Review, error) {
+	ctx, span := tracing.Start(ctx, "ReviewService.GetProductReviews")
+	defer span.End()
+
 	var reviews []domain.Review
-	if err := config.DB.Preload("User").Where("product_id = ?", productID).Order("created_at desc").Find(&reviews).Error; err != nil {
+	if err := config.DB.WithContext(ctx).Preload("User").Where("product_id = ?", productID).Order("created_at desc").Find(&reviews).Error; err != nil {
 		return nil, err
 	}
 	return reviews, nil
 }
 
 // GetProductAverageRating calculates average rating for a product
-func (s *ReviewService) GetProductAverageRating(productID uint) (float64, int64, error) {
+func (s *ReviewService) GetProductAverageRating(ctx context.Context, productID uint) (float64, int64, error) {
+	ctx, span := tracing.Start(ctx, "ReviewService.GetProductAverageRating")
+	defer span.End()
+
 	var result struct {
 		Avg   float64
 		Count int64
 	}
 
-	if err := config.DB.Model(&domain.Review{}).
+	if err := config.DB.WithContext(ctx).Model(&domain.Review{}).
 		Select("COALESCE(AVG(rating), 0) as avg, COUNT(*) as count").
 		Where("product_id = ?", productID).
 		Scan(&result).Error; err != nil {
@@ -53,15 +80,18 @@ func (s *ReviewService) GetProductAverageRating(productID uint) (float64, int64,
 }
 
 // DeleteReview deletes a review (only by owner)
-func (s *ReviewService) DeleteReview(reviewID, userID uint) error {
+func (s *ReviewService) DeleteReview(ctx context.Context, reviewID, userID uint) error {
+	ctx, span := tracing.Start(ctx, "ReviewService.DeleteReview")
+	defer span.End()
+
 	var review domain.Review
-	if err := config.DB.First(&review, reviewID).Error; err != nil {
-		return errors.New("review not found")
+	if err := config.DB.WithContext(ctx).First(&review, reviewID).Error; err != nil {
+		return ErrReviewNotFound
 	}
 
 	if review.UserID != userID {
-		return errors.New("you can only delete your own reviews")
+		return ErrNotReviewOwner
 	}
 
-	return config.DB.Delete(&review).Error
+	return config.DB.WithContext(ctx).Delete(&review).Error
 }
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"wine-shop-api/internal/domain"
+	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/tracing"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrShippingUnavailable    = Validation("shipping_unavailable", "we do not ship this order to that address")
+	ErrShippingZoneNotFound   = NotFound("shipping_zone_not_found", "shipping zone not found")
+	ErrShippingMethodExists   = Conflict("shipping_method_exists", "the zone already has a method with this code")
+	ErrShippingMethodNotFound = NotFound("shipping_method_not_found", "shipping method not found")
+)
+
+// ShippingService prices delivery. Admins divide destinations into zones and
+// give each zone methods with rates by bottle count or weight; a destination
+// is priced by the most specific zone that contains it.
+type ShippingService struct{}
+
+// Shipment is what a cart would ship
+type Shipment struct {
+	Bottles     int
+	WeightGrams int
+	VolumeML    int
+	Subtotal    float64
+}
+
+// NewShipment sums the bottles, weight, volume and value of cart items. Products
+// must be loaded.
+func NewShipment(items []domain.CartItem) Shipment {
+	var shipment Shipment
+	for _, item := range items {
+		shipment.Bottles += item.Quantity
+		shipment.WeightGrams += item.Product.ShippingWeight() * item.Quantity
+		shipment.VolumeML += item.Product.Volume() * item.Quantity
+		shipment.Subtotal += item.Product.Price * float64(item.Quantity)
+	}
+	return shipment
+}
+
+// ShippingOption is a priced shipping method for a shipment
+type ShippingOption struct {
+	Method  string  `json:"method"`
+	Name    string  `json:"name"`
+	Cost    float64 `json:"cost"`
+	Free    bool    `json:"free"` // the free-shipping threshold was reached
+	MinDays int     `json:"min_days,omitempty"`
+	MaxDays int     `json:"max_days,omitempty"`
+}
+
+// Quote lists the methods that can take shipment to dest, cheapest first
+func (s *ShippingService) Quote(ctx context.Context, dest domain.PostalAddress, shipment Shipment) ([]ShippingOption, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.Quote")
+	defer span.End()
+
+	var zones []domain.ShippingZone
+	if err := config.DB.WithContext(ctx).
+		Preload("Methods", "disabled = ?", false).
+		Order("id").
+		Find(&zones).Error; err != nil {
+		return nil, err
+	}
+
+	zone := bestZone(zones, dest)
+	if zone == nil {
+		return nil, ErrShippingUnavailable.WithMessage("we do not ship to " + dest.Country)
+	}
+	options := quoteMethods(zone.Methods, shipment)
+	if len(options) == 0 {
+		return nil, ErrShippingUnavailable.WithMessage("this order is too large for any shipping method to " + dest.Country)
+	}
+	return options, nil
+}
+
+// Select prices the method with code for shipment to dest, or the cheapest
+// method when code is empty
+func (s *ShippingService) Select(ctx context.Context, dest domain.PostalAddress, shipment Shipment, code string) (*ShippingOption, error) {
+	options, err := s.Quote(ctx, dest, shipment)
+	if err != nil {
+		return nil, err
+	}
+	if code == "" {
+		return &options[0], nil
+	}
+	for _, option := range options {
+		if option.Method == code {
+			return &option, nil
+		}
+	}
+	return nil, invalidField("shipping_method", "unavailable", "is not available for this order and address")
+}
+
+// bestZone returns the most specific zone containing dest, preferring the
+// oldest zone on ties
+func bestZone(zones []domain.ShippingZone, dest domain.PostalAddress) *domain.ShippingZone {
+	var best *domain.ShippingZone
+	bestSpecificity := -1
+	for i := range zones {
+		if specificity, ok := zones[i].Match(dest); ok && specificity > bestSpecificity {
+			best, bestSpecificity = &zones[i], specificity
+		}
+	}
+	return best
+}
+
+// quoteMethods prices each method for shipment, skipping those whose rates
+// do not go high enough, and sorts them cheapest first
+func quoteMethods(methods []domain.ShippingMethod, shipment Shipment) []ShippingOption {
+	options := []ShippingOption{}
+	for _, method := range methods {
+		quantity := float64(shipment.Bottles)
+		if method.RateBasis == domain.RateBasisWeight {
+			quantity = float64(shipment.WeightGrams) / 1000
+		}
+		cost, ok := method.Cost(quantity, shipment.Subtotal)
+		if !ok {
+			continue
+		}
+		options = append(options, ShippingOption{
+			Method:  method.Code,
+			Name:    method.Name,
+			Cost:    cost,
+			Free:    cost == 0 && method.FreeOver > 0,
+			MinDays: method.MinDays,
+			MaxDays: method.MaxDays,
+		})
+	}
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Cost < options[j].Cost })
+	return options
+}
+
+// shippingSeedLockID serialises seeding the default zone across instances
+const shippingSeedLockID = 7208431
+
+// defaultZoneMaxBottles bounds the default zone's single rate tier
+const defaultZoneMaxBottles = 10000
+
+// EnsureDefaultZone creates a zone for countries with free standard shipping
+// when no zone has ever been created, so checkout works on a fresh deploy
+// before an admin sets up shipping. It reports whether the zone was created.
+// Zones an admin deleted are not brought back, and no countries seeds nothing.
+func (s *ShippingService) EnsureDefaultZone(ctx context.Context, countries []string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.EnsureDefaultZone")
+	defer span.End()
+
+	if len(countries) == 0 {
+		return false, nil
+	}
+	zone := domain.ShippingZone{Name: "Default", Countries: append([]string(nil), countries...)}
+	if err := validateZone(&zone); err != nil {
+		return false, err
+	}
+
+	created := false
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", shippingSeedLockID).Error; err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&domain.ShippingZone{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		zone.Methods = []domain.ShippingMethod{{
+			Code:      domain.ShippingMethodStandard,
+			Name:      "Standard",
+			RateBasis: domain.RateBasisBottles,
+			Rates:     []domain.ShippingRate{{UpTo: defaultZoneMaxBottles, Price: 0}},
+		}}
+		if err := tx.Create(&zone).Error; err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	return created, err
+}
+
+// GetZones lists all shipping zones with their methods
+func (s *ShippingService) GetZones(ctx context.Context) ([]domain.ShippingZone, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.GetZones")
+	defer span.End()
+
+	zones := []domain.ShippingZone{}
+	if err := config.DB.WithContext(ctx).Preload("Methods").Order("id").Find(&zones).Error; err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (s *ShippingService) CreateZone(ctx context.Context, zone *domain.ShippingZone) (*domain.ShippingZone, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.CreateZone")
+	defer span.End()
+
+	if err := validateZone(zone); err != nil {
+		return nil, err
+	}
+	zone.ID = 0
+	zone.Methods = nil
+	if err := config.DB.WithContext(ctx).Create(zone).Error; err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
+
+// UpdateZone replaces a zone's name and area. Its methods are kept.
+func (s *ShippingService) UpdateZone(ctx context.Context, id uint, input *domain.ShippingZone) (*domain.ShippingZone, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.UpdateZone")
+	defer span.End()
+
+	if err := validateZone(input); err != nil {
+		return nil, err
+	}
+	zone, err := findZone(config.DB.WithContext(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	zone.Name = input.Name
+	zone.Countries = input.Countries
+	zone.Regions = input.Regions
+	zone.PostcodeRanges = input.PostcodeRanges
+	if err := config.DB.WithContext(ctx).Omit("Methods").Save(zone).Error; err != nil {
+		return nil, err
+	}
+	return zone, nil
+}
+
+// DeleteZone removes a zone and its methods
+func (s *ShippingService) DeleteZone(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "ShippingService.DeleteZone")
+	defer span.End()
+
+	return config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&domain.ShippingZone{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrShippingZoneNotFound
+		}
+		return tx.Where("zone_id = ?", id).Delete(&domain.ShippingMethod{}).Error
+	})
+}
+
+// GetZone returns a zone with its methods
+func (s *ShippingService) GetZone(ctx context.Context, id uint) (*domain.ShippingZone, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.GetZone")
+	defer span.End()
+
+	return findZone(config.DB.WithContext(ctx).Preload("Methods"), id)
+}
+
+// CreateMethod adds a method to a zone. A zone has at most one method per code.
+func (s *ShippingService) CreateMethod(ctx context.Context, zoneID uint, method *domain.ShippingMethod) (*domain.ShippingMethod, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.CreateMethod")
+	defer span.End()
+
+	if err := validateMethod(method); err != nil {
+		return nil, err
+	}
+	method.ID = 0
+	method.ZoneID = zoneID
+
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := findZone(tx, zoneID); err != nil {
+			return err
+		}
+		if err := ensureUniqueMethod(tx, method); err != nil {
+			return err
+		}
+		return tx.Create(method).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+// UpdateMethod replaces a method's settings. It stays in its zone.
+func (s *ShippingService) UpdateMethod(ctx context.Context, id uint, input *domain.ShippingMethod) (*domain.ShippingMethod, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.UpdateMethod")
+	defer span.End()
+
+	if err := validateMethod(input); err != nil {
+		return nil, err
+	}
+
+	var method domain.ShippingMethod
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&method, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrShippingMethodNotFound
+			}
+			return err
+		}
+		method.Code = input.Code
+		method.Name = input.Name
+		method.RateBasis = input.RateBasis
+		method.Rates = input.Rates
+		method.FreeOver = input.FreeOver
+		method.MinDays = input.MinDays
+		method.MaxDays = input.MaxDays
+		method.Disabled = input.Disabled
+		if err := ensureUniqueMethod(tx, &method); err != nil {
+			return err
+		}
+		return tx.Save(&method).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &method, nil
+}
+
+// GetMethod returns a shipping method
+func (s *ShippingService) GetMethod(ctx context.Context, id uint) (*domain.ShippingMethod, error) {
+	ctx, span := tracing.Start(ctx, "ShippingService.GetMethod")
+	defer span.End()
+
+	var method domain.ShippingMethod
+	err := config.DB.WithContext(ctx).First(&method, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShippingMethodNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &method, nil
+}
+
+func (s *ShippingService) DeleteMethod(ctx context.Context, id uint) error {
+	ctx, span := tracing.Start(ctx, "ShippingService.DeleteMethod")
+	defer span.End()
+
+	result := config.DB.WithContext(ctx).Delete(&domain.ShippingMethod{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrShippingMethodNotFound
+	}
+	return nil
+}
+
+func findZone(db *gorm.DB, id uint) (*domain.ShippingZone, error) {
+	var zone domain.ShippingZone
+	err := db.First(&zone, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShippingZoneNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func ensureUniqueMethod(tx *gorm.DB, method *domain.ShippingMethod) error {
+	var count int64
+	if err := tx.Model(&domain.ShippingMethod{}).
+		Where("zone_id = ? AND code = ? AND id <> ?", method.ZoneID, method.Code, method.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrShippingMethodExists
+	}
+	return nil
+}
+
+// validateZone normalises a zone's countries and postcode ranges and checks
+// the zone can match a destination
+func validateZone(z *domain.ShippingZone) error {
+	var fields []FieldError
+	z.Name = strings.TrimSpace(z.Name)
+	if z.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Code: "required", Message: "is required"})
+	}
+
+	if len(z.Countries) == 0 {
+		fields = append(fields, FieldError{Field: "countries", Code: "required", Message: "is required"})
+	}
+	fields = append(fields, normalizeArea("", z.Countries, z.PostcodeRanges)...)
+
+	if len(fields) > 0 {
+		return Validation("validation_failed", "One or more fields are invalid", fields...)
+	}
+	return nil
+}
+
+// normalizeArea upper-cases countries and strips spaces from postcode
+// ranges in place, reporting invalid entries under prefix, e.g. "rules[0]."
+func normalizeArea(prefix string, countries []string, ranges []domain.PostcodeRange) []FieldError {
+	var fields []FieldError
+	for i, country := range countries {
+		countries[i] = strings.ToUpper(strings.TrimSpace(country))
+		if !countryCode.MatchString(countries[i]) {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("%scountries[%d]", prefix, i), Code: "iso3166_1_alpha2", Message: "must be a two-letter ISO 3166-1 country code"})
+		}
+	}
+	for i := range ranges {
+		r := &ranges[i]
+		r.From = strings.ToUpper(strings.ReplaceAll(r.From, " ", ""))
+		r.To = strings.ToUpper(strings.ReplaceAll(r.To, " ", ""))
+		if r.From == "" || len(r.From) != len(r.To) || r.From > r.To {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("%spostcode_ranges[%d]", prefix, i), Code: "invalid", Message: "from and to must have the same length and from must not sort after to"})
+		}
+	}
+	return fields
+}
+
+func validateMethod(m *domain.ShippingMethod) error {
+	var fields []FieldError
+	switch m.Code {
+	case domain.ShippingMethodStandard, domain.ShippingMethodExpress, domain.ShippingMethodChilled:
+	default:
+		fields = append(fields, FieldError{Field: "code", Code: "oneof", Message: "must be one of standard express chilled"})
+	}
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Name == "" {
+		fields = append(fields, FieldError{Field: "name", Code: "required", Message: "is required"})
+	}
+	if m.RateBasis != domain.RateBasisBottles && m.RateBasis != domain.RateBasisWeight {
+		fields = append(fields, FieldError{Field: "rate_basis", Code: "oneof", Message: "must be one of bottles weight"})
+	}
+	if len(m.Rates) == 0 {
+		fields = append(fields, FieldError{Field: "rates", Code: "required", Message: "is required"})
+	}
+	for i, rate := range m.Rates {
+		if rate.UpTo <= 0 || rate.Price < 0 {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("rates[%d]", i), Code: "invalid", Message: "up_to must be positive and price at least 0"})
+		}
+	}
+	if m.FreeOver < 0 {
+		fields = append(fields, FieldError{Field: "free_over", Code: "min", Message: "must be at least 0"})
+	}
+	if m.MinDays < 0 || m.MaxDays < m.MinDays {
+		fields = append(fields, FieldError{Field: "max_days", Code: "invalid", Message: "must be at least min_days"})
+	}
+
+	if len(fields) > 0 {
+		return Validation("validation_failed", "One or more fields are invalid", fields...)
+	}
+	return nil
+}
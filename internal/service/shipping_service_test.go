@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"wine-shop-api/internal/domain"
+)
+
+func TestNewShipment(t *testing.T) {
+	shipment := NewShipment([]domain.CartItem{
+		{Quantity: 2, Product: domain.Product{Price: 30}},
+		{Quantity: 1, Product: domain.Product{Price: 90, WeightGrams: 3200, VolumeML: 1500}}, // magnum
+	})
+
+	if shipment.Bottles != 3 || shipment.WeightGrams != 2*domain.DefaultBottleGrams+3200 || shipment.VolumeML != 3000 || shipment.Subtotal != 150 {
+		t.Errorf("Expected 3 bottles, 5800g, 3000ml and a 150 subtotal, got %+v", shipment)
+	}
+}
+
+func TestBestZone_PrefersMostSpecific(t *testing.T) {
+	zones := []domain.ShippingZone{
+		{Name: "United States", Countries: []string{"US"}},
+		{Name: "West Coast", Countries: []string{"US"}, Regions: []string{"CA", "OR", "WA"}},
+		{Name: "Bay Area", Countries: []string{"US"}, PostcodeRanges: []domain.PostcodeRange{{From: "940", To: "951"}}},
+	}
+
+	tests := []struct {
+		dest domain.PostalAddress
+		zone string
+	}{
+		{domain.PostalAddress{Country: "US", Region: "NY", Postcode: "10001"}, "United States"},
+		{domain.PostalAddress{Country: "US", Region: "CA", Postcode: "90210"}, "West Coast"},
+		{domain.PostalAddress{Country: "US", Region: "CA", Postcode: "94105"}, "Bay Area"},
+	}
+
+	for _, tt := range tests {
+		zone := bestZone(zones, tt.dest)
+		if zone == nil || zone.Name != tt.zone {
+			t.Errorf("%+v: expected zone %s, got %+v", tt.dest, tt.zone, zone)
+		}
+	}
+
+	if zone := bestZone(zones, domain.PostalAddress{Country: "FR"}); zone != nil {
+		t.Errorf("Expected no zone for FR, got %s", zone.Name)
+	}
+}
+
+func TestQuoteMethods(t *testing.T) {
+	methods := []domain.ShippingMethod{
+		{Code: domain.ShippingMethodExpress, RateBasis: domain.RateBasisBottles, Rates: []domain.ShippingRate{{UpTo: 12, Price: 25}}},
+		{Code: domain.ShippingMethodStandard, RateBasis: domain.RateBasisBottles, Rates: []domain.ShippingRate{{UpTo: 6, Price: 10}, {UpTo: 24, Price: 15}}, FreeOver: 100},
+		{Code: domain.ShippingMethodChilled, RateBasis: domain.RateBasisWeight, Rates: []domain.ShippingRate{{UpTo: 5, Price: 30}}},
+	}
+
+	options := quoteMethods(methods, Shipment{Bottles: 3, WeightGrams: 3900, Subtotal: 60})
+	if len(options) != 3 || options[0].Method != "standard" || options[1].Method != "express" || options[2].Method != "chilled" {
+		t.Fatalf("Expected standard, express then chilled, got %+v", options)
+	}
+	if options[0].Cost != 10 || options[0].Free {
+		t.Errorf("Expected standard to cost 10, got %+v", options[0])
+	}
+
+	// 6.5kg is too heavy for chilled; the subtotal earns free standard
+	options = quoteMethods(methods, Shipment{Bottles: 5, WeightGrams: 6500, Subtotal: 150})
+	if len(options) != 2 || options[0].Method != "standard" || !options[0].Free || options[0].Cost != 0 {
+		t.Errorf("Expected free standard and express only, got %+v", options)
+	}
+}
+
+func TestValidateZone(t *testing.T) {
+	zone := domain.ShippingZone{
+		Name:           " Scotland ",
+		Countries:      []string{"gb"},
+		PostcodeRanges: []domain.PostcodeRange{{From: "eh1", To: "EH 9"}},
+	}
+	if err := validateZone(&zone); err != nil {
+		t.Fatalf("Expected a valid zone, got %v", err)
+	}
+	if zone.Name != "Scotland" || zone.Countries[0] != "GB" || zone.PostcodeRanges[0] != (domain.PostcodeRange{From: "EH1", To: "EH9"}) {
+		t.Errorf("Expected a normalised zone, got %+v", zone)
+	}
+
+	tests := []struct {
+		zone  domain.ShippingZone
+		field string
+	}{
+		{domain.ShippingZone{Countries: []string{"GB"}}, "name"},
+		{domain.ShippingZone{Name: "Nowhere"}, "countries"},
+		{domain.ShippingZone{Name: "UK", Countries: []string{"GBR"}}, "countries[0]"},
+		{domain.ShippingZone{Name: "UK", Countries: []string{"GB"}, PostcodeRanges: []domain.PostcodeRange{{From: "EH9", To: "EH1"}}}, "postcode_ranges[0]"},
+		{domain.ShippingZone{Name: "UK", Countries: []string{"GB"}, PostcodeRanges: []domain.PostcodeRange{{From: "EH1", To: "EH10"}}}, "postcode_ranges[0]"},
+	}
+
+	for _, tt := range tests {
+		err := validateZone(&tt.zone)
+		var fields []FieldError
+		if e, ok := err.(*Error); ok {
+			fields = e.Fields
+		}
+		if len(fields) != 1 || fields[0].Field != tt.field {
+			t.Errorf("%+v: expected an error on %s, got %v", tt.zone, tt.field, err)
+		}
+	}
+}
+
+func TestValidateMethod(t *testing.T) {
+	valid := func() domain.ShippingMethod {
+		return domain.ShippingMethod{
+			Code:      domain.ShippingMethodStandard,
+			Name:      "Standard",
+			RateBasis: domain.RateBasisBottles,
+			Rates:     []domain.ShippingRate{{UpTo: 6, Price: 9.95}},
+			MinDays:   2,
+			MaxDays:   4,
+		}
+	}
+
+	method := valid()
+	if err := validateMethod(&method); err != nil {
+		t.Fatalf("Expected a valid method, got %v", err)
+	}
+
+	tests := []struct {
+		modify func(*domain.ShippingMethod)
+		field  string
+	}{
+		{func(m *domain.ShippingMethod) { m.Code = "pigeon" }, "code"},
+		{func(m *domain.ShippingMethod) { m.Name = " " }, "name"},
+		{func(m *domain.ShippingMethod) { m.RateBasis = "volume" }, "rate_basis"},
+		{func(m *domain.ShippingMethod) { m.Rates = nil }, "rates"},
+		{func(m *domain.ShippingMethod) { m.Rates[0].UpTo = 0 }, "rates[0]"},
+		{func(m *domain.ShippingMethod) { m.FreeOver = -1 }, "free_over"},
+		{func(m *domain.ShippingMethod) { m.MaxDays = 1 }, "max_days"},
+	}
+
+	for _, tt := range tests {
+		method := valid()
+		tt.modify(&method)
+		err := validateMethod(&method)
+		var fields []FieldError
+		if e, ok := err.(*Error); ok {
+			fields = e.Fields
+		}
+		if len(fields) != 1 || fields[0].Field != tt.field {
+			t.Errorf("Expected an error on %s, got %v", tt.field, err)
+		}
+	}
+}
+
+func TestEnsureDefaultZone_SeedsFreshDeployOnce(t *testing.T) {
+	db := useTestDB(t, &domain.ShippingZone{}, &domain.ShippingMethod{})
+
+	var existing int64
+	db.Unscoped().Model(&domain.ShippingZone{}).Count(&existing)
+	if existing > 0 {
+		t.Skip("the test database already has shipping zones")
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM shipping_methods")
+		db.Exec("DELETE FROM shipping_zones")
+	})
+
+	s := &ShippingService{}
+	ctx := context.Background()
+	created, err := s.EnsureDefaultZone(ctx, []string{"us", "CA"})
+	if err != nil || !created {
+		t.Fatalf("Expected the default zone to be created, got %v %v", created, err)
+	}
+	option, err := s.Select(ctx, domain.PostalAddress{Country: "CA"}, Shipment{Bottles: 12, Subtotal: 240}, "")
+	if err != nil || option.Method != domain.ShippingMethodStandard || option.Cost != 0 {
+		t.Errorf("Expected free standard shipping to CA, got %+v %v", option, err)
+	}
+
+	// Once an admin has deleted it, it is not recreated
+	zones, _ := s.GetZones(ctx)
+	if err := s.DeleteZone(ctx, zones[0].ID); err != nil {
+		t.Fatalf("Expected to delete the zone, got %v", err)
+	}
+	if created, err := s.EnsureDefaultZone(ctx, []string{"US"}); err != nil || created {
+		t.Errorf("Expected no zone to be created again, got %v %v", created, err)
+	}
+}
@@ -1,28 +1,66 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"html"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"wine-shop-api/internal/domain"
+	"wine-shop-api/internal/metrics"
 	"wine-shop-api/pkg/config"
+	"wine-shop-api/pkg/logging"
+	"wine-shop-api/pkg/tracing"
 	"wine-shop-api/pkg/utils"
 )
 
-type UserService struct{}
+var (
+	ErrInvalidCredentials = Unauthorized("invalid_credentials", "invalid email or password")
+	ErrAccountLocked      = &Error{Kind: KindLocked, Code: "account_locked", Message: "account temporarily locked after too many failed login attempts"}
+	ErrEmailInUse         = Conflict("email_in_use", "email already in use")
+	ErrAgeAlreadyVerified = Conflict("age_already_verified", "date of birth has already been verified")
+)
+
+type UserService struct {
+	AgePolicy            *AgePolicy
+	Notifier             Notifier
+	MFARequiredForAdmins bool
+}
+
+// LoginResult is returned by Login. When the account has MFA enabled, Token is
+// empty and MFAToken must be exchanged for an access token with a TOTP code.
+type LoginResult struct {
+	Token                 string `json:"token,omitempty"`
+	MFARequired           bool   `json:"mfa_required,omitempty"`
+	MFAToken              string `json:"mfa_token,omitempty"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required,omitempty"`
+	// CSRFToken replaces Token in cookie session mode and must be sent back
+	// in the X-CSRF-Token header on mutating requests
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
 
-func (s *UserService) Register(user *domain.User) (*domain.User, error) {
-	// 1. Check if email exists
+func (s *UserService) Register(ctx context.Context, user *domain.User) (*domain.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Register")
+	defer span.End()
+
+	// 1. Validate date of birth
+	if err := s.validateDateOfBirth(user.DateOfBirth); err != nil {
+		return nil, err
+	}
+
+	// 2. Check if email exists
 	var existingUser domain.User
-	if err := config.DB.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		return nil, errors.New("email already in use")
+	if err := config.DB.WithContext(ctx).Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
+		return nil, ErrEmailInUse
 	}
 
-	// 2. Hash Password
+	// 3. Hash Password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
@@ -30,8 +68,8 @@ func (s *UserService) Register(user *domain.User) (*domain.User, error) {
 	user.Password = string(hashedPassword)
 	user.Email = html.EscapeString(strings.TrimSpace(user.Email))
 
-	// 3. Create User
-	if err := config.DB.Create(&user).Error; err != nil {
+	// 4. Create User
+	if err := config.DB.WithContext(ctx).Create(&user).Error; err != nil {
 		return nil, err
 	}
 
@@ -40,47 +78,256 @@ func (s *UserService) Register(user *domain.User) (*domain.User, error) {
 	return user, nil
 }
 
-func (s *UserService) Login(email, password string) (string, error) {
+func (s *UserService) Login(ctx context.Context, email, password, ipAddress, userAgent string) (*LoginResult, error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer span.End()
+
 	var user domain.User
 
 	// 1. Find User
-	if err := config.DB.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := config.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return "", errors.New("invalid email or password")
+			s.recordLogin(ctx, nil, email, ipAddress, userAgent, "unknown email")
+			return nil, ErrInvalidCredentials
 		}
-		return "", err
+		return nil, err
+	}
+
+	// 2. Refuse locked accounts before checking the password. The caller gets
+	// the same error as for a wrong password, so a lockout does not reveal
+	// that the email has an account; the owner is told by notification.
+	now := time.Now()
+	if user.IsLocked(now) {
+		s.recordLogin(ctx, &user, email, ipAddress, userAgent, "account locked")
+		return nil, ErrInvalidCredentials
+	}
+
+	// 3. Verify Password
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			s.registerFailedLogin(ctx, &user, now)
+			s.recordLogin(ctx, &user, email, ipAddress, userAgent, "invalid password")
+			return nil, ErrInvalidCredentials
+		}
+		// Corrupt or unsupported hash - never treat as a successful login
+		s.recordLogin(ctx, &user, email, ipAddress, userAgent, "password verification error")
+		return nil, fmt.Errorf("verify password: %w", err)
 	}
 
-	// 2. Verify Password
-	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
-	if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
-		return "", errors.New("invalid email or password")
+	// 4. Issue the access token, or an MFA challenge if a second factor is required
+	return s.issueLogin(ctx, &user, ipAddress, userAgent)
+}
+
+// accountLocked tells a caller who has already proved who they are, e.g.
+// with a password or an OAuth provider, when a locked account can try again
+func accountLocked(user *domain.User) *Error {
+	return ErrAccountLocked.WithMessage(ErrAccountLocked.Message + " until " + user.LockedUntil.Format(time.RFC3339))
+}
+
+// issueLogin is called once the first factor has been verified. It returns an
+// MFA challenge when the account has two-factor enabled.
+func (s *UserService) issueLogin(ctx context.Context, user *domain.User, ipAddress, userAgent string) (*LoginResult, error) {
+	if user.MFAEnabled {
+		mfaToken, err := utils.GenerateMFAChallengeToken(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &LoginResult{MFARequired: true, MFAToken: mfaToken}, nil
 	}
 
-	// 3. Generate Token
+	return s.completeLogin(ctx, user, ipAddress, userAgent)
+}
+
+// completeLogin issues the access token once all factors have been verified
+func (s *UserService) completeLogin(ctx context.Context, user *domain.User, ipAddress, userAgent string) (*LoginResult, error) {
 	token, err := utils.GenerateToken(user.ID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	// Reset failed attempts and record the login
+	if user.FailedLoginAttempts > 0 || user.LockedUntil != nil {
+		config.DB.WithContext(ctx).Model(user).Updates(map[string]interface{}{
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		})
 	}
+	s.recordSuccessfulLogin(ctx, user, ipAddress, userAgent)
+
+	return &LoginResult{
+		Token:                 token,
+		MFAEnrollmentRequired: s.MFARequiredForAdmins && user.IsAdmin() && !user.MFAEnabled,
+	}, nil
+}
 
-	return token, nil
+// GetLoginHistory returns the most recent login attempts for a user
+func (s *UserService) GetLoginHistory(ctx context.Context, userID uint, limit int) ([]domain.LoginEvent, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetLoginHistory")
+	defer span.End()
+
+	events := []domain.LoginEvent{}
+	if err := config.DB.WithContext(ctx).Where("user_id = ?", userID).Order("created_at desc").Limit(limit).Find(&events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// registerFailedLogin increments the failed attempt counter and locks the
+// account with exponential backoff once the threshold is reached. The
+// increment happens in SQL and holds the row lock until the lockout is
+// stored, so concurrent wrong passwords each count. The owner is notified
+// of each lockout.
+func (s *UserService) registerFailedLogin(ctx context.Context, user *domain.User, now time.Time) {
+	var lockedUntil time.Time
+	err := config.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var updated domain.User
+		if err := tx.Model(&updated).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "failed_login_attempts"}}}).
+			Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"failed_login_attempts": gorm.Expr("failed_login_attempts + 1")}).Error; err != nil {
+			return err
+		}
+		user.FailedLoginAttempts = updated.FailedLoginAttempts
+
+		lockout := domain.LockoutDuration(user.FailedLoginAttempts)
+		if lockout == 0 {
+			return nil
+		}
+		lockedUntil = now.Add(lockout)
+		user.LockedUntil = &lockedUntil
+		return tx.Model(&domain.User{}).Where("id = ?", user.ID).Update("locked_until", lockedUntil).Error
+	})
+	if err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to record failed login", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if !lockedUntil.IsZero() && s.Notifier != nil {
+		message := fmt.Sprintf("Your account is locked until %s after %d failed sign-in attempts. If this wasn't you, change your password once it unlocks.",
+			lockedUntil.Format(time.RFC1123), user.FailedLoginAttempts)
+		if err := s.Notifier.Notify(ctx, user, "Your account has been locked", message); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to send lockout notification", "user_id", user.ID, "error", err)
+		}
+	}
+}
+
+// recordLogin stores a failed login attempt in the login history
+func (s *UserService) recordLogin(ctx context.Context, user *domain.User, email, ipAddress, userAgent, reason string) {
+	metrics.FailedLogins.WithLabelValues(reason).Inc()
+	event := domain.LoginEvent{
+		Email:     email,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Reason:    reason,
+	}
+	if user != nil {
+		event.UserID = &user.ID
+	}
+	if err := config.DB.WithContext(ctx).Create(&event).Error; err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to record login event", "error", err)
+	}
+}
+
+// recordSuccessfulLogin stores a successful login and notifies the user when
+// it comes from a device that has not signed in to the account before
+func (s *UserService) recordSuccessfulLogin(ctx context.Context, user *domain.User, ipAddress, userAgent string) {
+	var previousLogins, knownDevice int64
+	config.DB.WithContext(ctx).Model(&domain.LoginEvent{}).Where("user_id = ? AND success = ?", user.ID, true).Count(&previousLogins)
+	config.DB.WithContext(ctx).Model(&domain.LoginEvent{}).Where("user_id = ? AND success = ? AND user_agent = ?", user.ID, true, userAgent).Count(&knownDevice)
+
+	event := domain.LoginEvent{
+		UserID:    &user.ID,
+		Email:     user.Email,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Success:   true,
+		NewDevice: previousLogins > 0 && knownDevice == 0,
+	}
+	if err := config.DB.WithContext(ctx).Create(&event).Error; err != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "failed to record login event", "user_id", user.ID, "error", err)
+	}
+
+	if event.NewDevice && s.Notifier != nil {
+		message := fmt.Sprintf("New sign-in from %s (IP %s) at %s. If this wasn't you, change your password.",
+			userAgent, ipAddress, event.CreatedAt.Format(time.RFC1123))
+		if err := s.Notifier.Notify(ctx, user, "New sign-in to your account", message); err != nil {
+			logging.FromContext(ctx).ErrorContext(ctx, "failed to send new device notification", "user_id", user.ID, "error", err)
+		}
+	}
+}
+
+// VerifyAge records the date of birth for an existing account that registered
+// before it was required. An attested date of birth cannot be changed.
+func (s *UserService) VerifyAge(ctx context.Context, userID uint, dateOfBirth time.Time) (*domain.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.VerifyAge")
+	defer span.End()
+
+	var user domain.User
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	if user.IsAgeVerified() {
+		return nil, ErrAgeAlreadyVerified
+	}
+
+	if err := s.validateDateOfBirth(&dateOfBirth); err != nil {
+		return nil, err
+	}
+
+	user.DateOfBirth = &dateOfBirth
+	if err := config.DB.WithContext(ctx).Model(&user).Update("date_of_birth", dateOfBirth).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// validateDateOfBirth rejects missing or implausible dates and customers who are
+// too young to buy alcohol in any destination we ship to
+func (s *UserService) validateDateOfBirth(dob *time.Time) error {
+	if dob == nil {
+		return invalidField("date_of_birth", "required", "date of birth is required")
+	}
+
+	now := time.Now()
+	if dob.After(now) {
+		return invalidField("date_of_birth", "in_future", "date of birth cannot be in the future")
+	}
+	if domain.AgeOn(*dob, now) > 130 {
+		return invalidField("date_of_birth", "invalid", "invalid date of birth")
+	}
+
+	minimumAge := DefaultMinimumAge
+	if s.AgePolicy != nil {
+		minimumAge = s.AgePolicy.LowestMinimumAge()
+	}
+	if domain.AgeOn(*dob, now) < minimumAge {
+		return invalidField("date_of_birth", "underage", fmt.Sprintf("you must be at least %d years old to register", minimumAge))
+	}
+	return nil
 }
 
 // PromoteToAdmin promotes a user to admin role
-func (s *UserService) PromoteToAdmin(userID uint) error {
+func (s *UserService) PromoteToAdmin(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "UserService.PromoteToAdmin")
+	defer span.End()
+
 	var user domain.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
-		return errors.New("user not found")
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return ErrUserNotFound
 	}
 	user.Role = "admin"
-	return config.DB.Save(&user).Error
+	return config.DB.WithContext(ctx).Save(&user).Error
 }
 
 // GetUserByID returns a user by ID
-func (s *UserService) GetUserByID(userID uint) (*domain.User, error) {
+func (s *UserService) GetUserByID(ctx context.Context, userID uint) (*domain.User, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetUserByID")
+	defer span.End()
+
 	var user domain.User
-	if err := config.DB.First(&user, userID).Error; err != nil {
-		return nil, errors.New("user not found")
+	if err := config.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, ErrUserNotFound
 	}
 	return &user, nil
 }
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"wine-shop-api/internal/domain"
+)
+
+// recordingNotifier keeps the subjects of the notifications it was asked to send
+type recordingNotifier struct {
+	subjects []string
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, _ *domain.User, subject, _ string) error {
+	n.subjects = append(n.subjects, subject)
+	return nil
+}
+
+func TestRegisterFailedLogin_CountsConcurrentFailures(t *testing.T) {
+	db := useTestDB(t, &domain.User{})
+
+	user := domain.User{Email: fmt.Sprintf("brute-%d@example.com", time.Now().UnixNano()), Password: "x"}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Expected to create a user, got %v", err)
+	}
+	t.Cleanup(func() { db.Unscoped().Delete(&user) })
+
+	const failures = 20
+	s := &UserService{}
+	now := time.Now()
+	var wg sync.WaitGroup
+	for range failures {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Every request read the user before any failure was stored
+			stale := user
+			s.registerFailedLogin(context.Background(), &stale, now)
+		}()
+	}
+	wg.Wait()
+
+	var stored domain.User
+	if err := db.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("Expected to reload the user, got %v", err)
+	}
+	if stored.FailedLoginAttempts != failures {
+		t.Errorf("Expected %d failed attempts, got %d", failures, stored.FailedLoginAttempts)
+	}
+	if !stored.IsLocked(now) {
+		t.Errorf("Expected the account to be locked, locked until %v", stored.LockedUntil)
+	}
+	if want := now.Add(domain.LockoutDuration(failures)); stored.LockedUntil.Before(want.Add(-time.Second)) {
+		t.Errorf("Expected the lockout for %d failures (until %v), got %v", failures, want, stored.LockedUntil)
+	}
+}
+
+func TestLogin_LockedAccountLooksLikeWrongPassword(t *testing.T) {
+	db := useTestDB(t, &domain.User{}, &domain.LoginEvent{})
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := domain.User{
+		Email:               fmt.Sprintf("locked-%d@example.com", time.Now().UnixNano()),
+		Password:            string(hash),
+		FailedLoginAttempts: domain.MaxFailedLogins - 1,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("Expected to create a user, got %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Where("email = ?", user.Email).Delete(&domain.LoginEvent{})
+		db.Unscoped().Delete(&user)
+	})
+
+	notifier := &recordingNotifier{}
+	s := &UserService{Notifier: notifier}
+	ctx := context.Background()
+	if _, err := s.Login(ctx, user.Email, "wrong", "127.0.0.1", "test"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Expected ErrInvalidCredentials for a wrong password, got %v", err)
+	}
+	if len(notifier.subjects) != 1 {
+		t.Errorf("Expected the owner to be notified of the lockout, got %v", notifier.subjects)
+	}
+
+	// The right password on a locked account gets the same answer
+	if _, err := s.Login(ctx, user.Email, "correct horse", "127.0.0.1", "test"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected ErrInvalidCredentials for a locked account, got %v", err)
+	}
+	var event domain.LoginEvent
+	db.Where("email = ?", user.Email).Order("id desc").First(&event)
+	if event.Reason != "account locked" {
+		t.Errorf("Expected the lockout to be recorded in the login history, got %q", event.Reason)
+	}
+}
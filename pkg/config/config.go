@@ -0,0 +1,568 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the application configuration. Values come from the defaults,
+// then the YAML file named by CONFIG_FILE, then environment variables (a .env
+// file is loaded into the environment first). Fields tagged secret are
+// redacted by Redacted.
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Log         LogConfig         `yaml:"log"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Session     SessionConfig     `yaml:"session"`
+	CORS        CORSConfig        `yaml:"cors"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Payment     PaymentConfig     `yaml:"payment"`
+	Shipping    ShippingConfig    `yaml:"shipping"`
+	Age         AgeConfig         `yaml:"age"`
+	OIDC        OIDCConfig        `yaml:"oidc"`
+	Cloudinary  CloudinaryConfig  `yaml:"cloudinary"`
+}
+
+type ServerConfig struct {
+	// Addr is the listen address; PORT is used when only it is set
+	Addr              string        `yaml:"addr" env:"LISTEN_ADDR"`
+	TrustedProxies    []string      `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// DrainDelay is how long /readyz fails on SIGTERM before the listener
+	// closes; ShutdownTimeout then bounds how long in-flight requests may drain
+	DrainDelay      time.Duration `yaml:"drain_delay" env:"SERVER_DRAIN_DELAY"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+}
+
+// LogConfig controls structured logging. Attributes whose key contains one
+// of RedactKeys are replaced, and email addresses, JWTs and API keys are
+// masked wherever they appear.
+type LogConfig struct {
+	Level  string `yaml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+	// RedactKeys are matched case-insensitively as substrings of attribute keys
+	RedactKeys   []string `yaml:"redact_keys" env:"LOG_REDACT_KEYS"`
+	RedactEmails bool     `yaml:"redact_emails" env:"LOG_REDACT_EMAILS"`
+	// SlowQuery is the duration above which SQL queries are logged as warnings
+	SlowQuery time.Duration `yaml:"slow_query" env:"LOG_SLOW_QUERY"`
+	// SQLParams includes bound values in logged queries instead of placeholders
+	SQLParams bool `yaml:"sql_params" env:"LOG_SQL_PARAMS"`
+}
+
+// MetricsConfig controls the Prometheus endpoint. It is served on Addr, a
+// listener separate from the API, or on the API's own /metrics when Addr is
+// empty; Token, when set, must be sent as a bearer token in either case.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED"`
+	Addr    string `yaml:"addr" env:"METRICS_ADDR"`
+	Token   string `yaml:"token" env:"METRICS_TOKEN" secret:"true"`
+}
+
+// TracingConfig controls OpenTelemetry. Exporter is "none", "stdout" (for
+// local verification) or "otlp"; with an empty OTLPEndpoint the OTLP exporter
+// falls back to the standard OTEL_EXPORTER_OTLP_* variables.
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER"`
+	OTLPEndpoint string  `yaml:"otlp_endpoint" env:"TRACING_OTLP_ENDPOINT"`
+	ServiceName  string  `yaml:"service_name" env:"TRACING_SERVICE_NAME"`
+	SampleRatio  float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+type DatabaseConfig struct {
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DB_SSLMODE"`
+	TimeZone        string        `yaml:"time_zone" env:"DB_TIMEZONE"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	// ConnectAttempts is how often to try connecting at startup, backing off
+	// exponentially up to ConnectMaxBackoff between attempts
+	ConnectAttempts   int           `yaml:"connect_attempts" env:"DB_CONNECT_ATTEMPTS"`
+	ConnectMaxBackoff time.Duration `yaml:"connect_max_backoff" env:"DB_CONNECT_MAX_BACKOFF"`
+}
+
+type AuthConfig struct {
+	APISecret            string `yaml:"api_secret" env:"API_SECRET" secret:"true"`
+	TokenHourLifespan    int    `yaml:"token_hour_lifespan" env:"TOKEN_HOUR_LIFESPAN"`
+	MFAIssuer            string `yaml:"mfa_issuer" env:"MFA_ISSUER"`
+	MFARequiredForAdmins bool   `yaml:"mfa_required_for_admins" env:"MFA_REQUIRED_FOR_ADMINS"`
+}
+
+type SessionConfig struct {
+	Mode           string `yaml:"mode" env:"SESSION_MODE"` // bearer or cookie
+	CookieSecure   bool   `yaml:"cookie_secure" env:"SESSION_COOKIE_SECURE"`
+	CookieSameSite string `yaml:"cookie_same_site" env:"SESSION_COOKIE_SAMESITE"` // lax, strict or none
+	CookieDomain   string `yaml:"cookie_domain" env:"SESSION_COOKIE_DOMAIN"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+}
+
+type RateLimitConfig struct {
+	Store      string `yaml:"store" env:"RATE_LIMIT_STORE"` // memory or postgres
+	PolicyFile string `yaml:"policy_file" env:"RATE_LIMIT_POLICY_FILE"`
+}
+
+// IdempotencyConfig controls Idempotency-Key handling. Responses are replayed
+// for TTL; a request still in progress after LockTimeout is presumed lost
+// (e.g. the instance died) and its key may be retried. LockTimeout must be
+// longer than the server write timeout, or a slow request that is still
+// running could be executed a second time by a retry. Bodies of requests
+// with a key are buffered to fingerprint them, up to MaxBodyBytes.
+type IdempotencyConfig struct {
+	TTL          time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL"`
+	LockTimeout  time.Duration `yaml:"lock_timeout" env:"IDEMPOTENCY_LOCK_TIMEOUT"`
+	MaxBodyBytes int           `yaml:"max_body_bytes" env:"IDEMPOTENCY_MAX_BODY_BYTES"`
+}
+
+// CacheConfig controls caching of the public catalogue. Browsers and CDNs may
+// reuse product responses for MaxAge. The in-process response cache keeps up
+// to Entries anonymous responses for TTL and is disabled when Entries is 0.
+type CacheConfig struct {
+	MaxAge  time.Duration `yaml:"max_age" env:"CACHE_MAX_AGE"`
+	Entries int           `yaml:"entries" env:"CACHE_ENTRIES"`
+	TTL     time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+}
+
+// PaymentConfig selects the payment provider. Only "mock" is built in: it
+// keeps intents in memory, so it suits a single local instance, plays out
+// MockScenario (success, failure or 3ds) and posts webhooks signed with
+// WebhookSecret to MockAPIURL/payments/webhook. Without a WebhookSecret a
+// random one is used per process. The mock takes no money and lets
+// customers pick the outcome, so it only runs when MockEnabled is set, for
+// development and tests; without it payments are disabled and checkout
+// answers 503. Payments without an outcome after PendingTimeout
+// are cancelled, which cancels their order and releases its stock.
+type PaymentConfig struct {
+	Provider       string        `yaml:"provider" env:"PAYMENT_PROVIDER"`
+	Currency       string        `yaml:"currency" env:"PAYMENT_CURRENCY"`
+	WebhookSecret  string        `yaml:"webhook_secret" env:"PAYMENT_WEBHOOK_SECRET" secret:"true"`
+	PendingTimeout time.Duration `yaml:"pending_timeout" env:"PAYMENT_PENDING_TIMEOUT"`
+	MockEnabled    bool          `yaml:"mock_enabled" env:"PAYMENT_MOCK_ENABLED"`
+	MockScenario   string        `yaml:"mock_scenario" env:"PAYMENT_MOCK_SCENARIO"`
+	MockAPIURL     string        `yaml:"mock_api_url" env:"PAYMENT_MOCK_API_URL"`
+}
+
+// ShippingConfig seeds a shipping zone on first start, so checkout works
+// before an admin sets up shipping: DefaultCountries get free standard
+// shipping. The zone is only created while no zone has ever existed; an
+// empty list seeds nothing.
+type ShippingConfig struct {
+	DefaultCountries []string `yaml:"default_countries" env:"SHIPPING_DEFAULT_COUNTRIES"`
+}
+
+type AgeConfig struct {
+	MinimumAge int            `yaml:"minimum_age" env:"MIN_DRINKING_AGE"`
+	ByCountry  map[string]int `yaml:"by_country" env:"MIN_DRINKING_AGE_BY_COUNTRY"` // env: "US:21,JP:20"
+}
+
+type OIDCConfig struct {
+	FrontendRedirectURL string `yaml:"frontend_redirect_url" env:"OIDC_FRONTEND_REDIRECT_URL"`
+	// Providers are keyed by name. From the environment, OIDC_PROVIDERS lists
+	// the names and each reads OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+	// _REDIRECT_URL and _SCOPES.
+	Providers map[string]OIDCProviderConfig `yaml:"providers"`
+}
+
+type OIDCProviderConfig struct {
+	Issuer       string   `yaml:"issuer" env:"ISSUER"`
+	ClientID     string   `yaml:"client_id" env:"CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" env:"CLIENT_SECRET" secret:"true"`
+	RedirectURL  string   `yaml:"redirect_url" env:"REDIRECT_URL"`
+	Scopes       []string `yaml:"scopes" env:"SCOPES"`
+}
+
+type CloudinaryConfig struct {
+	URL       string `yaml:"url" env:"CLOUDINARY_URL" secret:"true"`
+	CloudName string `yaml:"cloud_name" env:"CLOUDINARY_CLOUD_NAME"`
+	APIKey    string `yaml:"api_key" env:"CLOUDINARY_API_KEY"`
+	APISecret string `yaml:"api_secret" env:"CLOUDINARY_API_SECRET" secret:"true"`
+}
+
+// Default returns the configuration used for anything not set explicitly
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Host:            "localhost",
+			Port:            5432,
+			User:            "postgres",
+			Name:            "wine_shop",
+			SSLMode:         "disable",
+			TimeZone:        "UTC",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+
+			ConnectAttempts:   10,
+			ConnectMaxBackoff: 30 * time.Second,
+		},
+		Log: LogConfig{
+			Level:        "info",
+			Format:       "json",
+			RedactKeys:   []string{"password", "secret", "token", "authorization", "cookie", "api_key"},
+			RedactEmails: true,
+			SlowQuery:    200 * time.Millisecond,
+		},
+		Metrics: MetricsConfig{Enabled: true, Addr: ":9090"},
+		Tracing: TracingConfig{Exporter: "none", ServiceName: "wine-shop-api", SampleRatio: 1},
+		Auth: AuthConfig{
+			TokenHourLifespan: 24,
+			MFAIssuer:         "Wine Shop",
+		},
+		Session: SessionConfig{
+			Mode:           "bearer",
+			CookieSecure:   true,
+			CookieSameSite: "lax",
+		},
+		CORS:        CORSConfig{AllowedOrigins: []string{"http://localhost:5173", "http://localhost:3000"}},
+		RateLimit:   RateLimitConfig{Store: "memory"},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour, LockTimeout: time.Minute, MaxBodyBytes: 1 << 20},
+		Cache:       CacheConfig{MaxAge: time.Minute, Entries: 1000, TTL: 30 * time.Second},
+		Shipping:    ShippingConfig{DefaultCountries: []string{"US"}},
+		Age:         AgeConfig{MinimumAge: 18},
+		Payment: PaymentConfig{
+			Provider:       "mock",
+			Currency:       "USD",
+			PendingTimeout: 30 * time.Minute,
+			MockScenario:   "success",
+			MockAPIURL:     "http://localhost:8080/api",
+		},
+	}
+}
+
+// Load reads and validates the configuration
+func Load() (*Config, error) {
+	cfg, err := Read()
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Read builds the configuration from the defaults, CONFIG_FILE, .env and the
+// environment without validating it
+func Read() (*Config, error) {
+	// A missing .env is fine; the environment may be set directly
+	_ = godotenv.Load()
+
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+	if err := cfg.applyOIDCEnv(); err != nil {
+		return nil, err
+	}
+	if os.Getenv("LISTEN_ADDR") == "" && os.Getenv("PORT") != "" {
+		cfg.Server.Addr = ":" + os.Getenv("PORT")
+	}
+	return cfg, nil
+}
+
+// applyOIDCEnv adds or overrides the providers listed in OIDC_PROVIDERS
+func (c *Config) applyOIDCEnv() error {
+	for _, name := range splitList(os.Getenv("OIDC_PROVIDERS")) {
+		name = strings.ToLower(name)
+		if c.OIDC.Providers == nil {
+			c.OIDC.Providers = make(map[string]OIDCProviderConfig)
+		}
+		provider := c.OIDC.Providers[name]
+		if err := applyEnv(reflect.ValueOf(&provider).Elem(), "OIDC_"+strings.ToUpper(name)+"_"); err != nil {
+			return err
+		}
+		c.OIDC.Providers[name] = provider
+	}
+	return nil
+}
+
+// applyEnv sets each field tagged env from the environment variable
+// prefix+tag, recursing into nested structs. Empty variables are ignored.
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		name, ok := field.Tag.Lookup("env")
+		if !ok {
+			if field.Type.Kind() == reflect.Struct {
+				if err := applyEnv(value, prefix); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		raw := strings.TrimSpace(os.Getenv(prefix + name))
+		if raw == "" {
+			continue
+		}
+		if err := setFromString(value, raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", prefix+name, err)
+		}
+	}
+	return nil
+}
+
+func setFromString(v reflect.Value, raw string) error {
+	switch {
+	case v.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(splitList(raw)))
+	case v.Kind() == reflect.Map && v.Type() == reflect.TypeOf(map[string]int{}):
+		m := make(map[string]int)
+		for _, pair := range splitList(raw) {
+			key, value, ok := strings.Cut(pair, ":")
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if !ok || err != nil {
+				return fmt.Errorf("%q is not KEY:NUMBER", pair)
+			}
+			m[strings.TrimSpace(key)] = n
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported config type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList splits a comma or space separated list
+func splitList(raw string) []string {
+	return strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server address is required (LISTEN_ADDR)")
+	check(c.Server.ReadTimeout >= 0 && c.Server.ReadHeaderTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0 && c.Server.DrainDelay >= 0,
+		"server timeouts must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "SERVER_SHUTDOWN_TIMEOUT must be positive")
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("invalid LOG_LEVEL %q", c.Log.Level))
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "invalid LOG_FORMAT %q", c.Log.Format)
+	check(c.Log.SlowQuery >= 0, "LOG_SLOW_QUERY must not be negative")
+
+	if c.Metrics.Enabled {
+		check(c.Metrics.Addr != "" || c.Metrics.Token != "",
+			"metrics on the API address need METRICS_TOKEN; set METRICS_ADDR or METRICS_TOKEN")
+		check(c.Metrics.Addr != c.Server.Addr, "METRICS_ADDR must differ from LISTEN_ADDR")
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("invalid TRACING_EXPORTER %q", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	check(c.Tracing.ServiceName != "", "TRACING_SERVICE_NAME is required")
+
+	db := c.Database
+	check(db.Host != "" && db.Name != "" && db.User != "", "database host, name and user are required (DB_HOST, DB_NAME, DB_USER)")
+	check(db.Port > 0 && db.Port < 65536, "invalid database port %d", db.Port)
+	switch db.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		errs = append(errs, fmt.Errorf("invalid DB_SSLMODE %q", db.SSLMode))
+	}
+	if _, err := time.LoadLocation(db.TimeZone); err != nil || db.TimeZone == "" {
+		errs = append(errs, fmt.Errorf("invalid DB_TIMEZONE %q", db.TimeZone))
+	}
+	check(db.MaxOpenConns >= 0 && db.MaxIdleConns >= 0 && db.ConnMaxLifetime >= 0, "database pool settings must not be negative")
+	check(db.ConnectAttempts > 0 && db.ConnectMaxBackoff > 0, "DB_CONNECT_ATTEMPTS and DB_CONNECT_MAX_BACKOFF must be positive")
+	check(db.MaxOpenConns == 0 || db.MaxIdleConns <= db.MaxOpenConns, "DB_MAX_IDLE_CONNS (%d) must not exceed DB_MAX_OPEN_CONNS (%d)", db.MaxIdleConns, db.MaxOpenConns)
+
+	check(c.Auth.APISecret != "", "API_SECRET is required")
+	check(c.Auth.TokenHourLifespan > 0, "TOKEN_HOUR_LIFESPAN must be a positive number of hours")
+
+	check(c.Session.Mode == "bearer" || c.Session.Mode == "cookie", "invalid SESSION_MODE %q", c.Session.Mode)
+	switch c.Session.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		check(c.Session.CookieSecure, "SESSION_COOKIE_SAMESITE=none requires SESSION_COOKIE_SECURE")
+	default:
+		errs = append(errs, fmt.Errorf("invalid SESSION_COOKIE_SAMESITE %q", c.Session.CookieSameSite))
+	}
+
+	check(len(c.CORS.AllowedOrigins) > 0, "at least one CORS origin is required (CORS_ALLOWED_ORIGINS)")
+	check(c.RateLimit.Store == "memory" || c.RateLimit.Store == "postgres", "invalid RATE_LIMIT_STORE %q", c.RateLimit.Store)
+	check(c.Idempotency.TTL > 0 && c.Idempotency.LockTimeout > 0, "IDEMPOTENCY_TTL and IDEMPOTENCY_LOCK_TIMEOUT must be positive")
+	check(c.Idempotency.MaxBodyBytes > 0, "IDEMPOTENCY_MAX_BODY_BYTES must be positive")
+	check(c.Idempotency.LockTimeout > c.Server.WriteTimeout,
+		"IDEMPOTENCY_LOCK_TIMEOUT (%s) must be longer than SERVER_WRITE_TIMEOUT (%s)", c.Idempotency.LockTimeout, c.Server.WriteTimeout)
+	check(c.Cache.MaxAge >= 0 && c.Cache.Entries >= 0, "CACHE_MAX_AGE and CACHE_ENTRIES must not be negative")
+	check(c.Cache.Entries == 0 || c.Cache.TTL > 0, "CACHE_TTL must be positive when the response cache is enabled")
+
+	check(c.Payment.Provider == "mock", "invalid PAYMENT_PROVIDER %q", c.Payment.Provider)
+	check(len(c.Payment.Currency) == 3, "PAYMENT_CURRENCY must be a 3-letter ISO 4217 code")
+	check(c.Payment.PendingTimeout > 0, "PAYMENT_PENDING_TIMEOUT must be positive")
+	if c.Payment.Provider == "mock" {
+		switch c.Payment.MockScenario {
+		case "success", "failure", "3ds":
+		default:
+			errs = append(errs, fmt.Errorf("invalid PAYMENT_MOCK_SCENARIO %q", c.Payment.MockScenario))
+		}
+		check(strings.HasPrefix(c.Payment.MockAPIURL, "http://") || strings.HasPrefix(c.Payment.MockAPIURL, "https://"),
+			"PAYMENT_MOCK_API_URL must be an http(s) URL")
+	}
+
+	for _, country := range c.Shipping.DefaultCountries {
+		check(len(strings.TrimSpace(country)) == 2, "invalid SHIPPING_DEFAULT_COUNTRIES entry %q, expected a two-letter country code", country)
+	}
+
+	check(c.Age.MinimumAge > 0, "MIN_DRINKING_AGE must be positive")
+	for country, age := range c.Age.ByCountry {
+		check(age > 0, "invalid minimum drinking age %d for %s", age, country)
+	}
+
+	for name, provider := range c.OIDC.Providers {
+		check(provider.Issuer != "" && provider.ClientID != "" && provider.RedirectURL != "",
+			"OIDC provider %s needs an issuer, client ID and redirect URL", name)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SameSite returns the session cookie SameSite mode
+func (s SessionConfig) SameSite() http.SameSite {
+	switch s.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// TokenLifespan is how long access tokens are valid
+func (a AuthConfig) TokenLifespan() time.Duration {
+	return time.Duration(a.TokenHourLifespan) * time.Hour
+}
+
+// Redacted returns the configuration as YAML with secrets masked
+func (c *Config) Redacted() ([]byte, error) {
+	// Round-trip through YAML for a deep copy that shares no maps
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	clone := &Config{}
+	if err := yaml.Unmarshal(data, clone); err != nil {
+		return nil, err
+	}
+	redact(reflect.ValueOf(clone).Elem())
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(clone); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := v.Field(i)
+			if t.Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String {
+				if field.String() != "" {
+					field.SetString("[REDACTED]")
+				}
+				continue
+			}
+			redact(field)
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			redact(elem)
+			v.SetMapIndex(key, elem)
+		}
+	}
+}
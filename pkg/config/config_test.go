@@ -0,0 +1,213 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRead_Defaults(t *testing.T) {
+	t.Setenv("API_SECRET", "secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.Database.SSLMode != "disable" || cfg.Database.TimeZone != "UTC" {
+		t.Errorf("Unexpected defaults: %+v", cfg)
+	}
+	if cfg.Auth.TokenLifespan() != 24*time.Hour {
+		t.Errorf("Expected a 24h token lifespan, got %v", cfg.Auth.TokenLifespan())
+	}
+	if cfg.Payment.MockEnabled {
+		t.Error("Expected the mock payment provider to be off unless enabled")
+	}
+	if len(cfg.Shipping.DefaultCountries) != 1 || cfg.Shipping.DefaultCountries[0] != "US" {
+		t.Errorf("Expected a default shipping zone for US, got %v", cfg.Shipping.DefaultCountries)
+	}
+}
+
+func TestRead_FileThenEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	file := `
+server:
+  addr: ":9000"
+database:
+  host: db.internal
+  ssl_mode: require
+  max_open_conns: 50
+  conn_max_lifetime: 10m
+auth:
+  api_secret: from-file
+cors:
+  allowed_origins: [https://shop.example.com]
+age:
+  by_country:
+    US: 21
+oidc:
+  providers:
+    google:
+      issuer: https://accounts.google.com
+      client_id: file-client
+      redirect_url: https://api.example.com/callback
+`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("DB_HOST", "db.env")
+	t.Setenv("DB_MAX_IDLE_CONNS", "7")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("MIN_DRINKING_AGE_BY_COUNTRY", "JP:20,KR:19")
+	t.Setenv("MFA_REQUIRED_FOR_ADMINS", "true")
+	t.Setenv("OIDC_PROVIDERS", "google")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "env-secret")
+	t.Setenv("OIDC_GOOGLE_SCOPES", "openid email")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Server.Addr != ":9000" || cfg.Database.SSLMode != "require" || cfg.Database.ConnMaxLifetime != 10*time.Minute {
+		t.Errorf("File values not applied: %+v", cfg)
+	}
+	if cfg.Database.Host != "db.env" || cfg.Database.MaxIdleConns != 7 || cfg.Database.MaxOpenConns != 50 {
+		t.Errorf("Environment should override the file: %+v", cfg.Database)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://b.example.com" {
+		t.Errorf("Unexpected CORS origins %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.Age.ByCountry["JP"] != 20 || cfg.Age.ByCountry["KR"] != 19 || len(cfg.Age.ByCountry) != 2 {
+		t.Errorf("Unexpected country ages %v", cfg.Age.ByCountry)
+	}
+	if !cfg.Auth.MFARequiredForAdmins || cfg.Auth.APISecret != "from-file" {
+		t.Errorf("Unexpected auth config %+v", cfg.Auth)
+	}
+
+	google := cfg.OIDC.Providers["google"]
+	if google.ClientID != "file-client" || google.ClientSecret != "env-secret" || len(google.Scopes) != 2 {
+		t.Errorf("Provider should merge file and environment values, got %+v", google)
+	}
+}
+
+func TestRead_PortFallback(t *testing.T) {
+	t.Setenv("PORT", "10000")
+	cfg, err := Read()
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if cfg.Server.Addr != ":10000" {
+		t.Errorf("Expected PORT to set the listen address, got %q", cfg.Server.Addr)
+	}
+}
+
+func TestRead_InvalidEnvironment(t *testing.T) {
+	t.Setenv("DB_MAX_OPEN_CONNS", "lots")
+	if _, err := Read(); err == nil || !strings.Contains(err.Error(), "DB_MAX_OPEN_CONNS") {
+		t.Errorf("Expected an error naming DB_MAX_OPEN_CONNS, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APISecret = ""
+	cfg.Auth.TokenHourLifespan = 0
+	cfg.Database.SSLMode = "sometimes"
+	cfg.Database.TimeZone = "Mars/Olympus"
+	cfg.Database.MaxIdleConns = 100
+	cfg.Session.CookieSameSite = "none"
+	cfg.Session.CookieSecure = false
+	cfg.RateLimit.Store = "redis"
+	cfg.Server.ShutdownTimeout = 0
+	cfg.Database.ConnectAttempts = 0
+	cfg.Metrics.Addr = ""
+	cfg.Idempotency.TTL = 0
+	cfg.Idempotency.MaxBodyBytes = 0
+	cfg.Cache.TTL = 0
+	cfg.Payment.PendingTimeout = 0
+	cfg.Payment.MockScenario = "maybe"
+	cfg.Shipping.DefaultCountries = []string{"USA"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"API_SECRET", "TOKEN_HOUR_LIFESPAN", "DB_SSLMODE", "DB_TIMEZONE", "DB_MAX_IDLE_CONNS", "SESSION_COOKIE_SECURE", "RATE_LIMIT_STORE", "SERVER_SHUTDOWN_TIMEOUT", "DB_CONNECT_ATTEMPTS", "METRICS_TOKEN", "IDEMPOTENCY_TTL", "IDEMPOTENCY_MAX_BODY_BYTES", "CACHE_TTL", "PAYMENT_PENDING_TIMEOUT", "PAYMENT_MOCK_SCENARIO", "SHIPPING_DEFAULT_COUNTRIES"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected an error mentioning %s, got:\n%v", want, err)
+		}
+	}
+}
+
+func TestValidate_IdempotencyLockTimeout(t *testing.T) {
+	cfg := Default()
+	cfg.Server.WriteTimeout = 2 * time.Minute
+	cfg.Idempotency.LockTimeout = time.Minute
+
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "IDEMPOTENCY_LOCK_TIMEOUT") {
+		t.Errorf("Expected a lock timeout shorter than the write timeout to be rejected, got %v", err)
+	}
+
+	cfg.Idempotency.LockTimeout = 3 * time.Minute
+	if err := cfg.Validate(); err != nil && strings.Contains(err.Error(), "IDEMPOTENCY_LOCK_TIMEOUT") {
+		t.Errorf("Expected a lock timeout longer than the write timeout to be valid, got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APISecret = "super-secret"
+	cfg.Database.Password = "db-password"
+	cfg.OIDC.Providers = map[string]OIDCProviderConfig{"google": {ClientID: "client", ClientSecret: "oidc-secret"}}
+
+	out, err := cfg.Redacted()
+	if err != nil {
+		t.Fatalf("Redacted failed: %v", err)
+	}
+	for _, secret := range []string{"super-secret", "db-password", "oidc-secret"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("Output leaks %q:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(out), "client_id: client") {
+		t.Errorf("Non-secret values should be shown:\n%s", out)
+	}
+	if cfg.OIDC.Providers["google"].ClientSecret != "oidc-secret" {
+		t.Error("Redacted must not modify the configuration")
+	}
+}
+
+func TestDatabaseConfig_DSN(t *testing.T) {
+	cfg := Default().Database
+	cfg.Password = `it's a \ secret`
+
+	dsn := cfg.DSN()
+	if !strings.Contains(dsn, `password='it\'s a \\ secret'`) {
+		t.Errorf("Password should be quoted and escaped, got %s", dsn)
+	}
+	if !strings.Contains(dsn, "sslmode='disable'") || !strings.Contains(dsn, "TimeZone='UTC'") {
+		t.Errorf("Expected the configured SSL mode and timezone, got %s", dsn)
+	}
+}
+
+func TestConnectBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{6, 30 * time.Second},
+		{60, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := connectBackoff(tt.attempt, 30*time.Second); got != tt.want {
+			t.Errorf("connectBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
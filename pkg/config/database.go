@@ -1,29 +1,109 @@
 package config
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"log/slog"
+	"strings"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
 )
 
 var DB *gorm.DB
 
-func ConnectDatabase() {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Shanghai",
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
+// connectBaseBackoff is the wait after the first failed connection attempt
+const connectBaseBackoff = time.Second
+
+// ConnectDatabase opens the connection pool, retrying with exponential
+// backoff while the database is unreachable. It gives up after
+// cfg.ConnectAttempts or when ctx is cancelled.
+func ConnectDatabase(ctx context.Context, cfg DatabaseConfig, logger gormlogger.Interface) error {
+	attempts := max(cfg.ConnectAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = connect(ctx, cfg, logger); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			return fmt.Errorf("failed to connect to database after %d attempts: %w", attempt, err)
+		}
+
+		wait := connectBackoff(attempt, cfg.ConnectMaxBackoff)
+		slog.WarnContext(ctx, "database connection failed, retrying",
+			"attempt", attempt, "attempts", attempts, "error", err, "retry_in", wait.String())
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect to database: %w", ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+func connect(ctx context.Context, cfg DatabaseConfig, logger gormlogger.Interface) error {
+	database, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{Logger: logger})
+	if err != nil {
+		return err
+	}
 
-	database, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := database.DB()
 	if err != nil {
-		panic("Failed to connect to database!")
+		return err
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return err
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	DB = database
+	return nil
+}
+
+// connectBackoff doubles the wait after each failed attempt, capped at limit
+func connectBackoff(attempt int, limit time.Duration) time.Duration {
+	wait := connectBaseBackoff
+	for i := 1; i < attempt && wait < limit; i++ {
+		wait *= 2
+	}
+	if limit > 0 && wait > limit {
+		return limit
+	}
+	return wait
+}
+
+// CloseDatabase closes the connection pool opened by ConnectDatabase
+func CloseDatabase() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// DSN returns the libpq connection string for the database
+func (cfg DatabaseConfig) DSN() string {
+	return fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		dsnValue(cfg.Host),
+		dsnValue(cfg.User),
+		dsnValue(cfg.Password),
+		dsnValue(cfg.Name),
+		cfg.Port,
+		dsnValue(cfg.SSLMode),
+		dsnValue(cfg.TimeZone),
+	)
+}
+
+// dsnValue quotes a connection string value so spaces and quotes in
+// passwords survive
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
 }
@@ -0,0 +1,52 @@
+package httpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WeakETag is a weak validator derived from a modification time, for
+// representations that are equivalent but not byte-for-byte stable
+func WeakETag(modified time.Time) string {
+	return `W/"` + strconv.FormatInt(modified.UnixNano(), 36) + `"`
+}
+
+// NotModified reports whether a GET or HEAD request can be answered with 304
+// Not Modified (RFC 9110 section 13.2.2). If-None-Match is compared weakly
+// against etag and, when present, If-Modified-Since is ignored.
+func NotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && matchesWeakly(ifNoneMatch, etag)
+	}
+
+	ifModifiedSince := r.Header.Get("If-Modified-Since")
+	if ifModifiedSince == "" || lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ifModifiedSince)
+	if err != nil {
+		return false
+	}
+	// Last-Modified is sent with second precision
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+// matchesWeakly reports whether any entity tag in a list header matches etag,
+// ignoring the weakness indicator
+func matchesWeakly(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLRU_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[string, int](2, time.Minute)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	c.Get("a")
+	c.Add("c", 3)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted as least recently used")
+	}
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected a=1 to survive, got %d %v", v, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", c.Len())
+	}
+
+	c.Purge()
+	if _, ok := c.Get("a"); ok || c.Len() != 0 {
+		t.Error("Expected Purge to remove every entry")
+	}
+}
+
+func TestLRU_Expires(t *testing.T) {
+	now := time.Now()
+	c := NewLRU[string, int](2, time.Minute)
+	c.now = func() time.Time { return now }
+	c.Add("a", 1)
+
+	now = now.Add(59 * time.Second)
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected the entry before its TTL")
+	}
+	now = now.Add(time.Second)
+	if _, ok := c.Get("a"); ok {
+		t.Error("Expected the entry to expire after its TTL")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2026, 3, 1, 12, 0, 0, 500, time.UTC)
+	etag := `"7"`
+
+	tests := []struct {
+		name   string
+		method string
+		header map[string]string
+		want   bool
+	}{
+		{"no validators", "GET", nil, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": `"7"`}, true},
+		{"weak matches strong", "GET", map[string]string{"If-None-Match": `W/"6", W/"7"`}, true},
+		{"star", "GET", map[string]string{"If-None-Match": `*`}, true},
+		{"other etag", "GET", map[string]string{"If-None-Match": `"6"`}, false},
+		{"etag wins over date", "GET", map[string]string{"If-None-Match": `"6"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, false},
+		{"same second", "GET", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"modified since", "GET", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"invalid date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"not a read", "POST", map[string]string{"If-None-Match": `"7"`}, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/products/1", nil)
+		for name, value := range tt.header {
+			r.Header.Set(name, value)
+		}
+		if got := NotModified(r, etag, modified); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
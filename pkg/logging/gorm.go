@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"wine-shop-api/pkg/config"
+)
+
+// GormLogger sends GORM's logs to the request-scoped slog logger, so every
+// query carries the request ID of the request that issued it. Failed queries
+// are logged as errors, slow ones as warnings and the rest at debug level.
+type GormLogger struct {
+	level     gormlogger.LogLevel
+	slowQuery time.Duration
+	params    bool
+}
+
+func NewGormLogger(cfg config.LogConfig) *GormLogger {
+	return &GormLogger{level: gormlogger.Info, slowQuery: cfg.SlowQuery, params: cfg.SQLParams}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, gormlogger.Info, slog.LevelInfo, msg, args...)
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, gormlogger.Warn, slog.LevelWarn, msg, args...)
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.log(ctx, gormlogger.Error, slog.LevelError, msg, args...)
+}
+
+func (l *GormLogger) log(ctx context.Context, min gormlogger.LogLevel, level slog.Level, msg string, args ...interface{}) {
+	if l.level >= min {
+		FromContext(ctx).Log(ctx, level, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs a finished query. The SQL is only rendered when the entry
+// will actually be written.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+	elapsed := time.Since(begin)
+	logger := FromContext(ctx)
+
+	var level slog.Level
+	var msg string
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		level, msg = slog.LevelError, "query failed"
+	case l.slowQuery > 0 && elapsed > l.slowQuery && l.level >= gormlogger.Warn:
+		level, msg = slog.LevelWarn, "slow query"
+	case l.level >= gormlogger.Info:
+		level, msg = slog.LevelDebug, "query"
+	default:
+		return
+	}
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if err != nil && level == slog.LevelError {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter keeps bound values out of logged SQL unless SQLParams is set,
+// so password hashes and emails in queries are never written
+func (l *GormLogger) ParamsFilter(_ context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if l.params {
+		return sql, params
+	}
+	return sql, nil
+}
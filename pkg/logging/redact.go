@@ -0,0 +1,83 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces values that must never reach the logs
+const Redacted = "[REDACTED]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	jwtPattern   = regexp.MustCompile(`eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`)
+	// API keys carry domain.APIKeyPrefix
+	apiKeyPattern = regexp.MustCompile(`wsk_[A-Za-z0-9_\-]+`)
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)\S+`)
+)
+
+// Redactor scrubs log attributes: keys matching a sensitive name are
+// replaced outright, and tokens or email addresses embedded in any string
+// value are masked
+type Redactor struct {
+	keys   []string
+	emails bool
+}
+
+func NewRedactor(keys []string, emails bool) *Redactor {
+	r := &Redactor{emails: emails}
+	for _, key := range keys {
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			r.keys = append(r.keys, key)
+		}
+	}
+	return r
+}
+
+// ReplaceAttr implements slog.HandlerOptions.ReplaceAttr
+func (r *Redactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.MessageKey && r.sensitiveKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.String(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, r.String(err.Error()))
+		}
+	}
+	return a
+}
+
+// String masks tokens, API keys and (optionally) email addresses in s
+func (r *Redactor) String(s string) string {
+	s = jwtPattern.ReplaceAllString(s, Redacted)
+	s = apiKeyPattern.ReplaceAllString(s, Redacted)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Redacted)
+	if r.emails {
+		s = emailPattern.ReplaceAllStringFunc(s, maskEmail)
+	}
+	return s
+}
+
+func (r *Redactor) sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, k := range r.keys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskEmail keeps the first character and the domain so support can still
+// tell accounts apart: jane@example.com becomes j***@example.com
+func maskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 1 {
+		return Redacted
+	}
+	return email[:1] + "***" + email[at:]
+}
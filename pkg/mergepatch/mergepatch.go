@@ -0,0 +1,47 @@
+// Package mergepatch applies JSON Merge Patch documents (RFC 7396)
+package mergepatch
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// ContentType is the media type of a merge patch
+const ContentType = "application/merge-patch+json"
+
+// ErrInvalidPatch is returned when the patch is not valid JSON
+var ErrInvalidPatch = errors.New("invalid merge patch")
+
+// Apply returns doc with patch applied. Members of patch replace those of
+// doc, null members remove them and nested objects are merged recursively;
+// a patch that is not an object replaces doc entirely.
+func Apply(doc, patch []byte) ([]byte, error) {
+	var patchValue any
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, ErrInvalidPatch
+	}
+	var docValue any
+	if err := json.Unmarshal(doc, &docValue); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(docValue, patchValue))
+}
+
+func merge(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+		} else {
+			targetObject[name] = merge(targetObject[name], value)
+		}
+	}
+	return targetObject
+}
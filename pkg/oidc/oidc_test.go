@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockProvider is a minimal local OpenID provider for tests
+type mockProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	// values captured from the authorization request and used by /token
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims // overrides applied to the issued ID token
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	m := &mockProvider{key: key, clientID: "wine-shop"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": "test-key",
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "valid-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		// PKCE: the verifier must hash to the challenge sent to /authorize
+		if CodeChallenge(r.Form.Get("code_verifier")) != m.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken(t),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) idToken(t *testing.T) string {
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            m.clientID,
+		"sub":            "user-123",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"nonce":          m.nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatalf("sign id token: %v", err)
+	}
+	return signed
+}
+
+// authorize simulates the browser visiting the authorization URL
+func (m *mockProvider) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth URL: %v", err)
+	}
+	m.challenge = u.Query().Get("code_challenge")
+	m.nonce = u.Query().Get("nonce")
+}
+
+func newTestProvider(t *testing.T, m *mockProvider) *Provider {
+	p, err := NewProvider(Config{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    m.clientID,
+		RedirectURL: "http://localhost:8080/api/auth/oidc/mock/callback",
+	}, m.server.Client())
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	return p
+}
+
+func TestProvider_AuthorizationCodeFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Errorf("Unexpected authorization endpoint: %s", authURL)
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") != CodeChallenge(verifier) {
+		t.Error("Authorization URL should carry the S256 PKCE challenge")
+	}
+	if q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" {
+		t.Error("Authorization URL should carry state and nonce")
+	}
+
+	m.authorize(t, authURL)
+	claims, err := p.Exchange(ctx, "valid-code", verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if claims.Subject != "user-123" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+}
+
+func TestProvider_RejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	authURL, _ := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	m.authorize(t, authURL)
+
+	if _, err := p.Exchange(ctx, "valid-code", "some-other-verifier", "nonce"); err == nil {
+		t.Error("Exchange should fail when the PKCE verifier does not match")
+	}
+}
+
+func TestProvider_IDTokenValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+	}{
+		{"Nonce mismatch", nil, "other-nonce"},
+		{"Wrong audience", jwt.MapClaims{"aud": "someone-else"}, "nonce"},
+		{"Wrong issuer", jwt.MapClaims{"iss": "https://evil.example.com"}, "nonce"},
+		{"Expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "nonce"},
+		{"Missing subject", jwt.MapClaims{"sub": ""}, "nonce"},
+		{"Foreign authorized party", jwt.MapClaims{"aud": []string{"wine-shop", "other"}, "azp": "other"}, "nonce"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			p := newTestProvider(t, m)
+			ctx := context.Background()
+
+			verifier, _ := RandomString()
+			authURL, _ := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+			m.authorize(t, authURL)
+			m.claims = tt.claims
+
+			if _, err := p.Exchange(ctx, "valid-code", verifier, tt.nonce); err == nil {
+				t.Error("Exchange should reject the ID token")
+			}
+		})
+	}
+}
+
+func TestProvider_StringEmailVerified(t *testing.T) {
+	m := newMockProvider(t)
+	p := newTestProvider(t, m)
+	ctx := context.Background()
+
+	verifier, _ := RandomString()
+	authURL, _ := p.AuthCodeURL(ctx, "state", "nonce", verifier)
+	m.authorize(t, authURL)
+	m.claims = jwt.MapClaims{"email_verified": "true"}
+
+	claims, err := p.Exchange(ctx, "valid-code", verifier, "nonce")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if !claims.EmailVerified {
+		t.Error(`email_verified "true" should be treated as verified`)
+	}
+}
+
+func TestProvider_InvalidIssuer(t *testing.T) {
+	m := newMockProvider(t)
+	p, _ := NewProvider(Config{
+		Name:        "mock",
+		Issuer:      m.server.URL + "/tenant",
+		ClientID:    m.clientID,
+		RedirectURL: "http://localhost/callback",
+	}, m.server.Client())
+
+	if _, err := p.AuthCodeURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Error("Discovery should fail for an unknown issuer")
+	}
+}
@@ -0,0 +1,99 @@
+// Package postcode validates and normalises postal codes by country
+package postcode
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for a postcode that does not match its country's format
+	ErrInvalid = errors.New("invalid postcode")
+	// ErrRequired is returned when a country that uses postcodes gets none
+	ErrRequired = errors.New("postcode is required")
+)
+
+// formats holds the postcode pattern of each country, by ISO 3166-1 alpha-2
+// code, matched against the normalised postcode
+var formats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^\d{4}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"BE": regexp.MustCompile(`^\d{4}$`),
+	"CA": regexp.MustCompile(`^[ABCEGHJ-NPRSTVXY]\d[ABCEGHJ-NPRSTV-Z] \d[ABCEGHJ-NPRSTV-Z]\d$`),
+	"CH": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"DK": regexp.MustCompile(`^\d{4}$`),
+	"ES": regexp.MustCompile(`^(0[1-9]|[1-4]\d|5[0-2])\d{3}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"GB": regexp.MustCompile(`^([A-Z]{1,2}\d[A-Z\d]?|GIR) \d[A-Z]{2}$`),
+	"IE": regexp.MustCompile(`^([AC-FHKNPRTV-Y]\d{2}|D6W) [0-9AC-FHKNPRTV-Y]{4}$`),
+	"IT": regexp.MustCompile(`^\d{5}$`),
+	"JP": regexp.MustCompile(`^\d{3}-\d{4}$`),
+	"NL": regexp.MustCompile(`^\d{4} [A-Z]{2}$`),
+	"NO": regexp.MustCompile(`^\d{4}$`),
+	"NZ": regexp.MustCompile(`^\d{4}$`),
+	"PT": regexp.MustCompile(`^\d{4}-\d{3}$`),
+	"SE": regexp.MustCompile(`^\d{3} \d{2}$`),
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"ZA": regexp.MustCompile(`^\d{4}$`),
+}
+
+// withoutPostcodes lists countries that do not use postcodes
+var withoutPostcodes = map[string]bool{
+	"AE": true,
+	"HK": true,
+	"QA": true,
+}
+
+// fallback accepts postcodes of countries without a known format
+var fallback = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,10}$`)
+
+// Normalize upper-cases a postcode, trims it and collapses inner whitespace,
+// and puts the space back into postcodes that are usually written with one
+// (e.g. "sw1a1aa" becomes "SW1A 1AA" for GB)
+func Normalize(country, postcode string) string {
+	postcode = strings.Join(strings.Fields(strings.ToUpper(postcode)), " ")
+	compact := strings.ReplaceAll(postcode, " ", "")
+	switch strings.ToUpper(country) {
+	case "GB", "CA":
+		if len(compact) > 3 {
+			return compact[:len(compact)-3] + " " + compact[len(compact)-3:]
+		}
+	case "IE":
+		if len(compact) > 4 {
+			return compact[:len(compact)-4] + " " + compact[len(compact)-4:]
+		}
+	case "NL":
+		if len(compact) == 6 {
+			return compact[:4] + " " + compact[4:]
+		}
+	case "SE":
+		if len(compact) == 5 {
+			return compact[:3] + " " + compact[3:]
+		}
+	}
+	return postcode
+}
+
+// Validate checks a postcode against the format of country and returns it
+// normalised. Countries without postcodes accept an empty one.
+func Validate(country, postcode string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	normalized := Normalize(country, postcode)
+	if normalized == "" {
+		if withoutPostcodes[country] {
+			return "", nil
+		}
+		return "", ErrRequired
+	}
+
+	format, ok := formats[country]
+	if !ok {
+		format = fallback
+	}
+	if !format.MatchString(normalized) {
+		return "", ErrInvalid
+	}
+	return normalized, nil
+}
@@ -0,0 +1,44 @@
+package postcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		country  string
+		postcode string
+		want     string
+		err      error
+	}{
+		{"US", "94103", "94103", nil},
+		{"us", " 94103-1234 ", "94103-1234", nil},
+		{"US", "9410", "", ErrInvalid},
+		{"GB", "sw1a1aa", "SW1A 1AA", nil},
+		{"GB", "EC1A  1BB", "EC1A 1BB", nil},
+		{"GB", "12345", "", ErrInvalid},
+		{"CA", "k1a0b1", "K1A 0B1", nil},
+		{"CA", "D1A 0B1", "", ErrInvalid},
+		{"NL", "1012ab", "1012 AB", nil},
+		{"IE", "d02x285", "D02 X285", nil},
+		{"DE", "10115", "10115", nil},
+		{"DE", "1011", "", ErrInvalid},
+		{"FR", "75001", "75001", nil},
+		{"ES", "60001", "", ErrInvalid},
+		{"SE", "11455", "114 55", nil},
+		{"JP", "100-0001", "100-0001", nil},
+		{"AU", "2000", "2000", nil},
+		{"US", "", "", ErrRequired},
+		{"HK", "", "", nil},
+		{"BR", "01310-100", "01310-100", nil},
+		{"BR", "<script>", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := Validate(tt.country, tt.postcode)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("Validate(%q, %q): expected %q %v, got %q %v", tt.country, tt.postcode, tt.want, tt.err, got, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package problem writes RFC 7807 application/problem+json error responses
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes the error code to form the problem type URI
+const TypeBase = "urn:problem-type:wine-shop:"
+
+// Codes shared by handlers and middleware. Domain errors define their own.
+const (
+	CodeMalformedBody    = "malformed_body"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeNotFound         = "not_found"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+)
+
+// FieldError describes why a single request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier clients can switch on; Detail is for humans.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Extensions are additional members serialised next to the standard ones
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON inlines the extension members; standard members win on conflict
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type plain Problem
+	body, err := json.Marshal(plain(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return body, err
+	}
+
+	members := make(map[string]any, len(p.Extensions))
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+	var standard map[string]json.RawMessage
+	if err := json.Unmarshal(body, &standard); err != nil {
+		return nil, err
+	}
+	for key, value := range standard {
+		members[key] = value
+	}
+	return json.Marshal(members)
+}
+
+// Write fills in the type, title, instance and request ID when unset, sends
+// p and aborts the request
+func Write(c *gin.Context, p Problem) {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Code == "" {
+		p.Code = CodeInternal
+	}
+	if p.Type == "" {
+		p.Type = TypeBase + p.Code
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = c.GetString("request_id")
+	}
+
+	// Errors describe one request and must not be reused by caches, even on
+	// routes whose successful responses are cacheable
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Error writes a problem with just a status, code and detail
+func Error(c *gin.Context, status int, code, detail string) {
+	Write(c, Problem{Status: status, Code: code, Detail: detail})
+}
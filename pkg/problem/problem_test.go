@@ -0,0 +1,73 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrite_FillsStandardMembers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/products/:id", func(c *gin.Context) {
+		c.Set("request_id", "req-1")
+		Error(c, http.StatusNotFound, "product_not_found", "product not found")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/products/7", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Expected Content-Type %q, got %q", ContentType, got)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %q: %v", w.Body.String(), err)
+	}
+	want := map[string]any{
+		"type":       TypeBase + "product_not_found",
+		"title":      "Not Found",
+		"status":     float64(404),
+		"detail":     "product not found",
+		"instance":   "/products/7",
+		"code":       "product_not_found",
+		"request_id": "req-1",
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, body[key])
+		}
+	}
+}
+
+func TestMarshalJSON_Extensions(t *testing.T) {
+	p := Problem{
+		Type:       TypeBase + "insufficient_scope",
+		Title:      "Forbidden",
+		Status:     http.StatusForbidden,
+		Code:       "insufficient_scope",
+		Extensions: map[string]any{"required_scope": "orders:read", "status": 200},
+	}
+	out, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(out, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body["required_scope"] != "orders:read" {
+		t.Errorf("Expected extension member required_scope, got %s", out)
+	}
+	if body["status"] != float64(http.StatusForbidden) {
+		t.Errorf("Expected standard members to win over extensions, got %s", out)
+	}
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"wine-shop-api/pkg/config"
+)
+
+type widget struct {
+	ID   uint
+	Name string
+}
+
+// setupRecorder installs a tracer provider that keeps spans in memory
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// dryRunDB builds SQL without a database connection
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1"}), &gorm.Config{DisableAutomaticPing: true, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to open gorm: %v", err)
+	}
+	if err := db.Use(GormPlugin{}); err != nil {
+		t.Fatalf("Failed to register plugin: %v", err)
+	}
+	return db
+}
+
+func TestGormPlugin_QuerySpans(t *testing.T) {
+	recorder := setupRecorder(t)
+	db := dryRunDB(t)
+
+	ctx, parent := Start(context.Background(), "CartService.GetCart")
+	db.WithContext(ctx).Where("name = ?", "Merlot").First(&widget{})
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a query span and its parent, got %d spans", len(spans))
+	}
+	query := spans[0]
+	if query.Name() != "gorm.query" || query.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected gorm.query under the service span, got %s", query.Name())
+	}
+	for _, attr := range query.Attributes() {
+		if attr.Key == "db.query.text" {
+			if sql := attr.Value.AsString(); !strings.Contains(sql, "$1") || strings.Contains(sql, "Merlot") {
+				t.Errorf("Expected SQL with placeholders only, got %q", sql)
+			}
+		}
+	}
+}
+
+func TestGormPlugin_SkipsUntracedQueries(t *testing.T) {
+	recorder := setupRecorder(t)
+	db := dryRunDB(t)
+
+	db.WithContext(context.Background()).First(&widget{})
+	if len(recorder.Ended()) != 0 {
+		t.Error("Queries outside a trace should not start new traces")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	cfg := config.Default().Tracing
+	for _, exporter := range []string{"none", "stdout"} {
+		cfg.Exporter = exporter
+		shutdown, err := Setup(context.Background(), cfg)
+		if err != nil {
+			t.Fatalf("Setup(%s) failed: %v", exporter, err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("Shutdown(%s) failed: %v", exporter, err)
+		}
+	}
+
+	cfg.Exporter = "zipkin"
+	if _, err := Setup(context.Background(), cfg); err == nil {
+		t.Error("Expected an unknown exporter to be rejected")
+	}
+}
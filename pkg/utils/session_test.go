@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSetSessionCookies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ConfigureTokens("testsecret123", 24*time.Hour)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/login", nil)
+
+	cfg := &SessionCookieConfig{Enabled: true, Secure: true, SameSite: http.SameSiteStrictMode}
+	csrfToken, err := SetSessionCookies(c, cfg, "access-token")
+	if err != nil || len(csrfToken) != 64 {
+		t.Fatalf("Expected a 64 character CSRF token, got %q (%v)", csrfToken, err)
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session := cookies[SessionCookieName]
+	if session == nil || session.Value != "access-token" || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Errorf("Session cookie should be HttpOnly, Secure and SameSite=Strict, got %+v", session)
+	}
+	if session != nil && session.MaxAge != 24*60*60 {
+		t.Errorf("Session cookie should last as long as the token, got %d", session.MaxAge)
+	}
+	if csrf := cookies[CSRFCookieName]; csrf == nil || csrf.Value != csrfToken || csrf.HttpOnly {
+		t.Errorf("CSRF cookie should hold the token and be readable, got %+v", csrf)
+	}
+}
+
+func TestValidCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+		want   bool
+	}{
+		{"matching", "abc123", "abc123", true},
+		{"mismatch", "abc123", "abc124", false},
+		{"missing header", "abc123", "", false},
+		{"missing cookie", "", "abc123", false},
+	}
+
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/cart", strings.NewReader("{}"))
+		if tt.cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			c.Request.Header.Set(CSRFHeaderName, tt.header)
+		}
+		if got := ValidCSRF(c); got != tt.want {
+			t.Errorf("%s: ValidCSRF() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
-	"os"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -11,65 +12,229 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// MFAChallengeLifespan is how long a user has to enter their second factor
+const MFAChallengeLifespan = 5 * time.Minute
+
+// DownloadTokenLifespan is how long a signed download link stays valid
+const DownloadTokenLifespan = 5 * time.Minute
+
+// OAuthFlowLifespan is how long a user has to complete a social login redirect
+const OAuthFlowLifespan = 10 * time.Minute
+
+// OAuthFlow is the state kept between starting a social login and its callback
+type OAuthFlow struct {
+	Provider     string
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+var (
+	tokenSecret   []byte
+	tokenLifespan time.Duration
+)
+
+// ConfigureTokens sets the signing secret and the access token lifespan. It
+// is called once at startup, before any token is issued or parsed.
+func ConfigureTokens(secret string, lifespan time.Duration) {
+	tokenSecret = []byte(secret)
+	tokenLifespan = lifespan
+}
+
+// TokenLifespan returns how long access tokens are valid
+func TokenLifespan() time.Duration {
+	return tokenLifespan
+}
+
 func GenerateToken(user_id uint) (string, error) {
-	token_lifespan, err := strconv.Atoi(os.Getenv("TOKEN_HOUR_LIFESPAN"))
-	if err != nil {
-		return "", err
+	if tokenLifespan <= 0 {
+		return "", errors.New("token lifespan is not configured")
 	}
 
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Hour * time.Duration(token_lifespan)).Unix()
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	claims["exp"] = time.Now().Add(tokenLifespan).Unix()
+	return signToken(claims)
+}
 
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+// signToken signs claims with the configured secret
+func signToken(claims jwt.MapClaims) (string, error) {
+	if len(tokenSecret) == 0 {
+		return "", errors.New("token secret is not configured")
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokenSecret)
 }
 
-func ValidateToken(c *gin.Context) error {
-	tokenString := ExtractToken(c)
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+// GenerateMFAChallengeToken issues a short-lived token that only proves the
+// password step succeeded. It is not accepted as an access token.
+func GenerateMFAChallengeToken(user_id uint) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["mfa_challenge"] = true
+	claims["user_id"] = user_id
+	claims["exp"] = time.Now().Add(MFAChallengeLifespan).Unix()
+	return signToken(claims)
+}
+
+// ParseMFAChallengeToken validates an MFA challenge token and returns its user ID
+func ParseMFAChallengeToken(tokenString string) (uint, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if challenge, _ := claims["mfa_challenge"].(bool); !challenge {
+		return 0, errors.New("not an MFA challenge token")
+	}
+	return userIDFromClaims(claims)
+}
+
+// GenerateOAuthFlowToken signs the social login state so it can be kept in a
+// cookie. It is not accepted as an access token.
+func GenerateOAuthFlowToken(flow OAuthFlow) (string, error) {
+	claims := jwt.MapClaims{}
+	claims["oauth_flow"] = true
+	claims["provider"] = flow.Provider
+	claims["state"] = flow.State
+	claims["nonce"] = flow.Nonce
+	claims["code_verifier"] = flow.CodeVerifier
+	claims["exp"] = time.Now().Add(OAuthFlowLifespan).Unix()
+	return signToken(claims)
+}
+
+// ParseOAuthFlowToken validates a social login state token
+func ParseOAuthFlowToken(tokenString string) (*OAuthFlow, error) {
+	claims, err := parseToken(tokenString)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if flow, _ := claims["oauth_flow"].(bool); !flow {
+		return nil, errors.New("not an OAuth flow token")
 	}
-	return nil
+	f := &OAuthFlow{}
+	f.Provider, _ = claims["provider"].(string)
+	f.State, _ = claims["state"].(string)
+	f.Nonce, _ = claims["nonce"].(string)
+	f.CodeVerifier, _ = claims["code_verifier"].(string)
+	return f, nil
 }
 
+func ValidateToken(c *gin.Context) error {
+	_, err := parseAccessToken(ExtractToken(c))
+	return err
+}
+
+// ExtractToken returns the bearer token from the Authorization header, or the
+// session cookie in cookie session mode. Tokens in the query string are never
+// accepted as they leak into access logs and browser history; see
+// ParseDownloadToken for signed download links.
 func ExtractToken(c *gin.Context) string {
-	token := c.Query("token")
-	if token != "" {
+	if token := bearerToken(c); token != "" {
 		return token
 	}
-	bearerToken := c.Request.Header.Get("Authorization")
-	if len(strings.Split(bearerToken, " ")) == 2 {
-		return strings.Split(bearerToken, " ")[1]
+	return sessionCookie(c)
+}
+
+func bearerToken(c *gin.Context) string {
+	scheme, token, found := strings.Cut(c.Request.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// GenerateDownloadToken signs a short-lived token that grants user_id a GET
+// on path with query only. It is meant for the ?token= query parameter of
+// download links and is not accepted as an access token.
+func GenerateDownloadToken(user_id uint, path string, query url.Values) (string, time.Time, error) {
+	expiresAt := time.Now().Add(DownloadTokenLifespan)
+	claims := jwt.MapClaims{}
+	claims["download"] = downloadTarget(path, query)
+	claims["user_id"] = user_id
+	claims["exp"] = expiresAt.Unix()
+	signed, err := signToken(claims)
+	return signed, expiresAt, err
+}
+
+// ParseDownloadToken validates a download token for path and query and
+// returns its user ID. The token parameter itself is ignored in query.
+func ParseDownloadToken(tokenString, path string, query url.Values) (uint, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if download, _ := claims["download"].(string); download == "" || download != downloadTarget(path, query) {
+		return 0, errors.New("not a download token for this URL")
 	}
-	return ""
+	return userIDFromClaims(claims)
+}
+
+// downloadTarget is the URL a download token is bound to: path and the
+// sorted query without the token, so a link cannot be reused with other
+// parameters
+func downloadTarget(path string, query url.Values) string {
+	canonical := url.Values{}
+	for name, values := range query {
+		if name != "token" {
+			canonical[name] = values
+		}
+	}
+	if len(canonical) == 0 {
+		return path
+	}
+	return path + "?" + canonical.Encode()
 }
 
 func ExtractTokenID(c *gin.Context) (uint, error) {
-	tokenString := ExtractToken(c)
+	claims, err := parseAccessToken(ExtractToken(c))
+	if err != nil {
+		return 0, err
+	}
+	return userIDFromClaims(claims)
+}
+
+// parseAccessToken parses a token and rejects MFA challenge, OAuth flow and
+// download tokens
+func parseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if challenge, _ := claims["mfa_challenge"].(bool); challenge {
+		return nil, errors.New("MFA challenge token cannot be used for access")
+	}
+	if flow, _ := claims["oauth_flow"].(bool); flow {
+		return nil, errors.New("OAuth flow token cannot be used for access")
+	}
+	if _, download := claims["download"]; download {
+		return nil, errors.New("download token cannot be used for access")
+	}
+	return claims, nil
+}
+
+func parseToken(tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("API_SECRET")), nil
+		if len(tokenSecret) == 0 {
+			return nil, errors.New("token secret is not configured")
+		}
+		return tokenSecret, nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
-		}
-		return uint(uid), nil
+	if !ok || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	return claims, nil
+}
+
+func userIDFromClaims(claims jwt.MapClaims) (uint, error) {
+	uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
+	if err != nil {
+		return 0, err
 	}
-	return 0, nil
+	return uint(uid), nil
 }
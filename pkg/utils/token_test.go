@@ -1,14 +1,18 @@
 package utils
 
 import (
-	"os"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 func TestGenerateToken(t *testing.T) {
 	// Setup
-	os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
-	os.Setenv("API_SECRET", "testsecret123")
+	ConfigureTokens("testsecret123", 24*time.Hour)
 
 	// Test token generation
 	userID := uint(1)
@@ -35,21 +39,19 @@ func TestGenerateToken(t *testing.T) {
 }
 
 func TestGenerateToken_InvalidLifespan(t *testing.T) {
-	// Setup with invalid lifespan
-	os.Setenv("TOKEN_HOUR_LIFESPAN", "invalid")
-	os.Setenv("API_SECRET", "testsecret123")
+	// Setup without a lifespan
+	ConfigureTokens("testsecret123", 0)
 
 	_, err := GenerateToken(1)
 
 	if err == nil {
-		t.Error("GenerateToken should fail with invalid TOKEN_HOUR_LIFESPAN")
+		t.Error("GenerateToken should fail without a token lifespan")
 	}
 }
 
 func TestGenerateToken_DifferentUsers(t *testing.T) {
 	// Setup
-	os.Setenv("TOKEN_HOUR_LIFESPAN", "24")
-	os.Setenv("API_SECRET", "testsecret123")
+	ConfigureTokens("testsecret123", 24*time.Hour)
 
 	// Generate tokens for different users
 	token1, _ := GenerateToken(1)
@@ -59,3 +61,130 @@ func TestGenerateToken_DifferentUsers(t *testing.T) {
 		t.Error("Tokens for different users should be different")
 	}
 }
+
+func TestMFAChallengeToken(t *testing.T) {
+	ConfigureTokens("testsecret123", 24*time.Hour)
+
+	token, err := GenerateMFAChallengeToken(42)
+	if err != nil {
+		t.Fatalf("GenerateMFAChallengeToken failed: %v", err)
+	}
+
+	userID, err := ParseMFAChallengeToken(token)
+	if err != nil {
+		t.Fatalf("ParseMFAChallengeToken failed: %v", err)
+	}
+	if userID != 42 {
+		t.Errorf("Expected user ID 42, got %d", userID)
+	}
+
+	// A challenge token must not be usable as an access token
+	if _, err := parseAccessToken(token); err == nil {
+		t.Error("MFA challenge token should be rejected as an access token")
+	}
+}
+
+func TestParseMFAChallengeToken_RejectsAccessToken(t *testing.T) {
+	ConfigureTokens("testsecret123", 24*time.Hour)
+
+	token, _ := GenerateToken(1)
+	if _, err := ParseMFAChallengeToken(token); err == nil {
+		t.Error("Access token should not be accepted as an MFA challenge token")
+	}
+}
+
+func TestOAuthFlowToken(t *testing.T) {
+	ConfigureTokens("testsecret123", 24*time.Hour)
+
+	flow := OAuthFlow{Provider: "google", State: "s", Nonce: "n", CodeVerifier: "v"}
+	token, err := GenerateOAuthFlowToken(flow)
+	if err != nil {
+		t.Fatalf("GenerateOAuthFlowToken failed: %v", err)
+	}
+
+	parsed, err := ParseOAuthFlowToken(token)
+	if err != nil {
+		t.Fatalf("ParseOAuthFlowToken failed: %v", err)
+	}
+	if *parsed != flow {
+		t.Errorf("Expected %+v, got %+v", flow, *parsed)
+	}
+
+	if _, err := parseAccessToken(token); err == nil {
+		t.Error("OAuth flow token should be rejected as an access token")
+	}
+}
+
+func TestExtractToken_IgnoresQueryString(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/me?token=leaked", nil)
+	if token := ExtractToken(c); token != "" {
+		t.Errorf("Query string token should be ignored, got %q", token)
+	}
+
+	c.Request.Header.Set("Authorization", "Bearer header-token")
+	if token := ExtractToken(c); token != "header-token" {
+		t.Errorf("Expected the bearer token, got %q", token)
+	}
+
+	c.Request.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if token := ExtractToken(c); token != "" {
+		t.Errorf("Non-bearer schemes should be ignored, got %q", token)
+	}
+}
+
+func TestExtractToken_SessionCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/cart", nil)
+	c.Request.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "cookie-token"})
+
+	if token := ExtractToken(c); token != "cookie-token" || !IsCookieSession(c) {
+		t.Errorf("Expected the session cookie to be used, got %q", token)
+	}
+
+	// An Authorization header takes precedence and is not a cookie session
+	c.Request.Header.Set("Authorization", "Bearer header-token")
+	if token := ExtractToken(c); token != "header-token" || IsCookieSession(c) {
+		t.Errorf("Expected the bearer token to win, got %q", token)
+	}
+}
+
+func TestDownloadToken(t *testing.T) {
+	ConfigureTokens("testsecret123", 24*time.Hour)
+
+	query := url.Values{"from": {"2026-01-01"}, "to": {"2026-02-01"}}
+	token, expiresAt, err := GenerateDownloadToken(5, "/api/admin/audit/export", query)
+	if err != nil {
+		t.Fatalf("GenerateDownloadToken failed: %v", err)
+	}
+	if time.Until(expiresAt) > DownloadTokenLifespan {
+		t.Errorf("Download token should expire within %v", DownloadTokenLifespan)
+	}
+
+	// The link carries the token next to the signed parameters, in any order
+	link, _ := url.ParseQuery("token=" + token + "&to=2026-02-01&from=2026-01-01")
+	userID, err := ParseDownloadToken(token, "/api/admin/audit/export", link)
+	if err != nil || userID != 5 {
+		t.Fatalf("Expected user 5, got %d (%v)", userID, err)
+	}
+	if _, err := ParseDownloadToken(token, "/api/admin/api-keys", link); err == nil {
+		t.Error("Download token should only be valid for its path")
+	}
+	for _, tampered := range []string{"from=2025-01-01&to=2026-02-01", "from=2026-01-01", "from=2026-01-01&to=2026-02-01&actor_id=1"} {
+		values, _ := url.ParseQuery(tampered)
+		if _, err := ParseDownloadToken(token, "/api/admin/audit/export", values); err == nil {
+			t.Errorf("Download token should not be valid with query %s", tampered)
+		}
+	}
+	if _, err := parseAccessToken(token); err == nil {
+		t.Error("Download token should be rejected as an access token")
+	}
+
+	access, _ := GenerateToken(5)
+	if _, err := ParseDownloadToken(access, "/api/admin/audit/export", nil); err == nil {
+		t.Error("Access token should be rejected as a download token")
+	}
+}
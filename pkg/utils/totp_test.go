@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 test secret "12345678901234567890" (SHA1)
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestGenerateTOTPCode_RFC6238Vectors(t *testing.T) {
+	// Last six digits of the RFC 6238 Appendix B SHA1 values
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := GenerateTOTPCode(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatalf("GenerateTOTPCode failed: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("GenerateTOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := GenerateTOTPCode(rfcSecret, now)
+
+	if !ValidateTOTPCode(rfcSecret, code, now) {
+		t.Error("Current code should be valid")
+	}
+	if !ValidateTOTPCode(rfcSecret, code, now.Add(TOTPPeriod)) {
+		t.Error("Code from previous step should be accepted")
+	}
+	if ValidateTOTPCode(rfcSecret, code, now.Add(3*TOTPPeriod)) {
+		t.Error("Code from three steps ago should be rejected")
+	}
+	if ValidateTOTPCode(rfcSecret, "12345", now) {
+		t.Error("Short code should be rejected")
+	}
+}
+
+func TestMatchTOTPCode_ReturnsStep(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := GenerateTOTPCode(rfcSecret, now)
+
+	step, ok := MatchTOTPCode(rfcSecret, code, now.Add(TOTPPeriod))
+	if !ok || step != TOTPStep(now) {
+		t.Errorf("Expected the code to match step %d, got %d (%v)", TOTPStep(now), step, ok)
+	}
+	if _, ok := MatchTOTPCode(rfcSecret, "000000", now); ok {
+		t.Error("Wrong code should not match")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret failed: %v", err)
+	}
+
+	uri := TOTPProvisioningURI("Wine Shop", "admin@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/Wine%20Shop:admin@example.com?") {
+		t.Errorf("Unexpected provisioning URI: %s", uri)
+	}
+	if !strings.Contains(uri, "secret="+secret) {
+		t.Error("Provisioning URI should contain the secret")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes failed: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes, got %d", len(codes))
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("Duplicate recovery code %s", code)
+		}
+		seen[code] = true
+	}
+
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(codes[0])+" ") {
+		t.Error("Recovery code hash should ignore case and surrounding whitespace")
+	}
+}
@@ -28,7 +28,7 @@ echo "🔧 Setup: Creating Admin User"
 # Register user
 curl -s -X POST "$BASE_URL/register" \
   -H "Content-Type: application/json" \
-  -d "{\"email\": \"$ADMIN_EMAIL\", \"password\": \"$PASSWORD\"}" > /dev/null
+  -d "{\"email\": \"$ADMIN_EMAIL\", \"password\": \"$PASSWORD\", \"date_of_birth\": \"1990-01-01\"}" > /dev/null
 
 # Login to get token
 LOGIN_RESPONSE=$(curl -s -X POST "$BASE_URL/login" \
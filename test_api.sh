@@ -36,7 +36,7 @@ echo ""
 echo "📋 Test 2: User Registration"
 REG_RESPONSE=$(curl -s -X POST "$BASE_URL/register" \
   -H "Content-Type: application/json" \
-  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\"}")
+  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\", \"date_of_birth\": \"1990-01-01\"}")
 
 if echo "$REG_RESPONSE" | grep -q "registration success\|already exists"; then
   test_result "pass" "User registration works"
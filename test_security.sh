@@ -41,7 +41,7 @@ echo "-------------------------------------"
 echo "   Registering user: $EMAIL"
 curl -s -X POST "$BASE_URL/register" \
   -H "Content-Type: application/json" \
-  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\"}" | head -c 100
+  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\", \"date_of_birth\": \"1990-01-01\"}" | head -c 100
 echo ""
 
 echo "   Logging in..."
@@ -26,7 +26,7 @@ echo ""
 echo "📊 Setup: Register & Login"
 curl -s -X POST "$BASE_URL/register" \
   -H "Content-Type: application/json" \
-  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\"}" > /dev/null
+  -d "{\"email\": \"$EMAIL\", \"password\": \"$PASSWORD\", \"date_of_birth\": \"1990-01-01\"}" > /dev/null
 
 LOGIN_RESPONSE=$(curl -s -X POST "$BASE_URL/login" \
   -H "Content-Type: application/json" \